@@ -0,0 +1,123 @@
+// Package account keeps the account-level age bracket flag a platform derives
+// from AAVP session credentials (PROTOCOL.md section 7.7).
+//
+// AAVP is additive: an account that never presented a credential is not
+// restricted. Once a minor bracket is seen, the account is flagged with the
+// most restrictive bracket seen so far, and the flag outlives the session
+// credential and the Device Agent. Only a valid OVER_18 credential lifts it.
+package account
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// Store persists the flag of each account. Only minor brackets are stored;
+// an account without an entry is not flagged.
+type Store interface {
+	// Get returns the flagged bracket of account. ok is false if the account
+	// is not flagged.
+	Get(ctx context.Context, account string) (bracket uint8, ok bool, err error)
+	// Set flags account with bracket.
+	Set(ctx context.Context, account string, bracket uint8) error
+	// Delete removes the flag of account, if any.
+	Delete(ctx context.Context, account string) error
+}
+
+// Source tells where the effective bracket of a Decision comes from.
+type Source uint8
+
+const (
+	SourceNone        Source = iota // no AAVP signal: no restrictions
+	SourceCredential                // a valid session credential
+	SourceAccountFlag               // the persisted account flag
+)
+
+// String returns the name of the source.
+func (s Source) String() string {
+	switch s {
+	case SourceNone:
+		return "none"
+	case SourceCredential:
+		return "credential"
+	case SourceAccountFlag:
+		return "account_flag"
+	default:
+		return "unknown"
+	}
+}
+
+// Decision is the effective age bracket of an account for one request.
+type Decision struct {
+	AgeBracket uint8 // meaningful unless Source is SourceNone
+	Source     Source
+}
+
+// Restricted reports whether minor restrictions apply.
+func (d Decision) Restricted() bool {
+	return d.Source != SourceNone && d.AgeBracket != token.AgeBracketOver18
+}
+
+// Policy applies the account-level persistence rules of PROTOCOL.md section
+// 7.7 on top of a Store. It is safe for concurrent use; the read-modify-write
+// of a flag is serialised within the process so that concurrent handshakes
+// from several tabs (section 7.8) keep the most restrictive bracket.
+type Policy struct {
+	Store Store
+
+	mu sync.Mutex
+}
+
+// NewPolicy creates a Policy backed by s.
+func NewPolicy(s Store) *Policy {
+	return &Policy{Store: s}
+}
+
+// Apply records the credential presented for account, if any, and returns
+// the effective bracket. cred must have been verified by the caller; an
+// expired credential is ignored.
+//
+//   - A valid OVER_18 credential lifts the flag; the account is unrestricted.
+//   - A valid minor credential flags the account with the most restrictive of
+//     its bracket and the current flag; restrictions follow the credential.
+//   - Without a valid credential, a flagged account keeps its restrictions and
+//     an unflagged one has none.
+func (p *Policy) Apply(ctx context.Context, account string, cred *session.Credential, now time.Time) (Decision, error) {
+	if cred != nil && (!now.Before(cred.ExpiresAt) || !token.ValidAgeBracket(cred.AgeBracket)) {
+		cred = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	flag, flagged, err := p.Store.Get(ctx, account)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	switch {
+	case cred == nil && flagged:
+		return Decision{AgeBracket: flag, Source: SourceAccountFlag}, nil
+	case cred == nil:
+		return Decision{Source: SourceNone}, nil
+	case cred.AgeBracket == token.AgeBracketOver18:
+		if flagged {
+			if err := p.Store.Delete(ctx, account); err != nil {
+				return Decision{}, err
+			}
+		}
+	case !flagged || cred.AgeBracket < flag:
+		if err := p.Store.Set(ctx, account, cred.AgeBracket); err != nil {
+			return Decision{}, err
+		}
+	}
+	return Decision{AgeBracket: cred.AgeBracket, Source: SourceCredential}, nil
+}
+
+// Flag returns the flagged bracket of account without applying a credential.
+func (p *Policy) Flag(ctx context.Context, account string) (uint8, bool, error) {
+	return p.Store.Get(ctx, account)
+}
@@ -0,0 +1,183 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func credential(bracket uint8) *session.Credential {
+	return &session.Credential{AgeBracket: bracket, ExpiresAt: now.Add(session.DefaultTTL)}
+}
+
+func apply(t *testing.T, p *Policy, account string, cred *session.Credential, at time.Time) Decision {
+	t.Helper()
+	d, err := p.Apply(context.Background(), account, cred, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestApplyWithoutSignal(t *testing.T) {
+	// New account on a device without DA (section 7.8): no restrictions.
+	p := NewPolicy(NewMemoryStore())
+	d := apply(t, p, "alice", nil, now)
+	if d.Source != SourceNone || d.Restricted() {
+		t.Fatalf("decision = %+v, want no restrictions", d)
+	}
+	if _, ok, _ := p.Flag(context.Background(), "alice"); ok {
+		t.Fatal("missing signal flagged the account")
+	}
+}
+
+func TestApplyFlagsMinor(t *testing.T) {
+	p := NewPolicy(NewMemoryStore())
+	d := apply(t, p, "alice", credential(token.AgeBracketAge13_15), now)
+	if d.Source != SourceCredential || d.AgeBracket != token.AgeBracketAge13_15 || !d.Restricted() {
+		t.Fatalf("decision = %+v", d)
+	}
+
+	// Cookies cleared or session expired without DA (section 7.8): the flag
+	// keeps the restrictions.
+	for _, tc := range []struct {
+		name string
+		cred *session.Credential
+	}{
+		{"cookies cleared", nil},
+		{"session expired", credential(token.AgeBracketAge13_15)},
+	} {
+		d := apply(t, p, "alice", tc.cred, now.Add(time.Hour))
+		if d.Source != SourceAccountFlag || d.AgeBracket != token.AgeBracketAge13_15 || !d.Restricted() {
+			t.Errorf("%s: decision = %+v", tc.name, d)
+		}
+	}
+}
+
+func TestApplyKeepsMostRestrictive(t *testing.T) {
+	p := NewPolicy(NewMemoryStore())
+	apply(t, p, "alice", credential(token.AgeBracketAge13_15), now)
+
+	// An active credential drives the restrictions, but a less restrictive
+	// minor bracket does not relax the flag.
+	d := apply(t, p, "alice", credential(token.AgeBracketAge16_17), now)
+	if d.AgeBracket != token.AgeBracketAge16_17 || d.Source != SourceCredential {
+		t.Fatalf("decision = %+v", d)
+	}
+	if b, _, _ := p.Flag(context.Background(), "alice"); b != token.AgeBracketAge13_15 {
+		t.Fatalf("flag = %s, want AGE_13_15", token.AgeBracketName(b))
+	}
+
+	apply(t, p, "alice", credential(token.AgeBracketUnder13), now)
+	if b, _, _ := p.Flag(context.Background(), "alice"); b != token.AgeBracketUnder13 {
+		t.Fatalf("flag = %s, want UNDER_13", token.AgeBracketName(b))
+	}
+}
+
+func TestApplyConcurrentTabs(t *testing.T) {
+	// Several tabs complete handshakes at once (section 7.8); whatever the
+	// order, the flag ends at the most restrictive bracket.
+	p := NewPolicy(NewMemoryStore())
+	brackets := []uint8{token.AgeBracketAge16_17, token.AgeBracketUnder13, token.AgeBracketAge13_15, token.AgeBracketAge16_17}
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Apply(context.Background(), "alice", credential(brackets[i%len(brackets)]), now); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if b, _, _ := p.Flag(context.Background(), "alice"); b != token.AgeBracketUnder13 {
+		t.Fatalf("flag = %s, want UNDER_13", token.AgeBracketName(b))
+	}
+}
+
+func TestApplyOver18Lifts(t *testing.T) {
+	// The minor turns 18 (section 7.8): a valid OVER_18 credential lifts the
+	// flag for good.
+	p := NewPolicy(NewMemoryStore())
+	apply(t, p, "alice", credential(token.AgeBracketAge16_17), now)
+
+	expired := credential(token.AgeBracketOver18)
+	expired.ExpiresAt = now
+	if d := apply(t, p, "alice", expired, now); d.Source != SourceAccountFlag || !d.Restricted() {
+		t.Fatalf("expired OVER_18: decision = %+v, want flag", d)
+	}
+
+	d := apply(t, p, "alice", credential(token.AgeBracketOver18), now)
+	if d.Source != SourceCredential || d.AgeBracket != token.AgeBracketOver18 || d.Restricted() {
+		t.Fatalf("decision = %+v", d)
+	}
+	if d := apply(t, p, "alice", nil, now.Add(time.Hour)); d.Source != SourceNone || d.Restricted() {
+		t.Fatalf("after lift: decision = %+v", d)
+	}
+}
+
+func TestApplyOver18NeverFlags(t *testing.T) {
+	p := NewPolicy(NewMemoryStore())
+	apply(t, p, "alice", credential(token.AgeBracketOver18), now)
+	if _, ok, _ := p.Flag(context.Background(), "alice"); ok {
+		t.Fatal("OVER_18 credential flagged the account")
+	}
+}
+
+func TestApplyInvalidBracketIgnored(t *testing.T) {
+	p := NewPolicy(NewMemoryStore())
+	if d := apply(t, p, "alice", credential(4), now); d.Source != SourceNone {
+		t.Fatalf("decision = %+v", d)
+	}
+}
+
+type failingStore struct{ *MemoryStore }
+
+func (failingStore) Set(context.Context, string, uint8) error { return errors.New("down") }
+
+func TestApplyStoreError(t *testing.T) {
+	p := NewPolicy(failingStore{NewMemoryStore()})
+	if _, err := p.Apply(context.Background(), "alice", credential(token.AgeBracketUnder13), now); err == nil {
+		t.Fatal("store error was not reported")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPolicy(s)
+	apply(t, p, "alice", credential(token.AgeBracketAge13_15), now)
+	apply(t, p, "bob", credential(token.AgeBracketUnder13), now)
+	apply(t, p, "bob", credential(token.AgeBracketOver18), now)
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok, _ := s.Get(ctx, "alice"); !ok || b != token.AgeBracketAge13_15 {
+		t.Fatalf("alice = %d, %v", b, ok)
+	}
+	if _, ok, _ := s.Get(ctx, "bob"); ok {
+		t.Fatal("lifted flag persisted")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"accounts":{"alice":"AGE_99"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFileStore(path); err == nil {
+		t.Fatal("invalid bracket name accepted")
+	}
+}
@@ -0,0 +1,151 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// MemoryStore is a Store kept in memory.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	flags map[string]uint8
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: make(map[string]uint8)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, account string) (uint8, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.flags[account]
+	return b, ok, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, account string, bracket uint8) error {
+	if !token.ValidAgeBracket(bracket) {
+		return errors.New("account: invalid age bracket")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flags[account] = bracket
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.flags, account)
+	return nil
+}
+
+// FileStore is a Store persisted as a JSON file mapping account identifiers
+// to bracket names. Every change rewrites the file atomically.
+type FileStore struct {
+	path string
+	mem  *MemoryStore
+	mu   sync.Mutex // serialises writes
+}
+
+type storeFile struct {
+	Accounts map[string]string `json:"accounts"`
+}
+
+// OpenFileStore loads the store at path, or starts an empty one if the file
+// does not exist.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, mem: NewMemoryStore()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f storeFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("account: invalid store file: %w", err)
+	}
+	for account, name := range f.Accounts {
+		b, ok := token.ParseAgeBracket(name)
+		if !ok {
+			return nil, fmt.Errorf("account: invalid bracket %q in store file", name)
+		}
+		s.mem.flags[account] = b
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, account string) (uint8, bool, error) {
+	return s.mem.Get(ctx, account)
+}
+
+func (s *FileStore) Set(ctx context.Context, account string, bracket uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had, _ := s.mem.Get(ctx, account)
+	if err := s.mem.Set(ctx, account, bracket); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		if had {
+			s.mem.Set(ctx, account, prev)
+		} else {
+			s.mem.Delete(ctx, account)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had, _ := s.mem.Get(ctx, account)
+	if !had {
+		return nil
+	}
+	s.mem.Delete(ctx, account)
+	if err := s.save(); err != nil {
+		s.mem.Set(ctx, account, prev)
+		return err
+	}
+	return nil
+}
+
+// save writes the store to a temporary file and renames it over path.
+// s.mu must be held.
+func (s *FileStore) save() error {
+	f := storeFile{Accounts: make(map[string]string)}
+	s.mem.mu.RLock()
+	for account, b := range s.mem.flags {
+		f.Accounts[account] = token.AgeBracketName(b)
+	}
+	s.mem.mu.RUnlock()
+	data, err := json.MarshalIndent(&f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".accounts-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
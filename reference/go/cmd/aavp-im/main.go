@@ -0,0 +1,166 @@
+// Command aavp-im runs the Implementor signing service: the signing endpoint
+// (/aavp/v1/sign) and the key publication endpoint (/.well-known/aavp-issuer).
+// With -reports it also accepts the aggregate verification reports of VGs
+// (/aavp/v1/reports) and logs the alerts they raise. Reports are kept in
+// memory within the default limits of im.MemoryReportStore.
+//
+// Keys are read from a JSON configuration file:
+//
+//	{
+//	  "domain": "im.example",
+//	  "keys": [
+//	    {"private_key": "key-2026a.pem", "not_before": "2026-01-01T00:00:00Z", "not_after": "2026-06-30T00:00:00Z"}
+//	  ]
+//	}
+//
+// Private keys are PEM-encoded RSA-2048 keys (PKCS #1 or PKCS #8). The service
+// does not log requests (IM-06); only startup errors are reported.
+//
+// Usage:
+//
+//	go run ./cmd/aavp-im -config im.json -addr :8443 -tls-cert cert.pem -tls-key key.pem
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+type config struct {
+	Domain string      `json:"domain"`
+	Keys   []keyConfig `json:"keys"`
+}
+
+type keyConfig struct {
+	PrivateKey string    `json:"private_key"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to the JSON key configuration")
+	addr := flag.String("addr", ":8443", "listen address")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate (PEM); plain HTTP if empty")
+	tlsKey := flag.String("tls-key", "", "TLS private key (PEM)")
+	reports := flag.Bool("reports", false, "accept aggregate verification reports from VGs")
+	flag.Parse()
+
+	if *configPath == "" {
+		fatalf("-config is required")
+	}
+	keys, err := loadKeys(*configPath, time.Now())
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	s := im.NewServer(keys)
+	if *reports {
+		s.Reports = im.NewReportMonitor(keys.Domain, im.NewMemoryReportStore())
+		// Alerts carry aggregate ratios only; logging them is compatible with IM-06.
+		s.Reports.OnAlert = func(a im.Alert) {
+			log.Printf("alert: vg=%s key=%s %s ratio=%.4f threshold=%.4f", a.VGDomain, a.TokenKeyID, a.Class, a.Ratio, a.Threshold)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Connection-level errors carry client addresses; discard them (IM-06).
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	if *tlsCert != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	fatalf("%v", err)
+}
+
+func loadKeys(path string, now time.Time) (*im.KeyManager, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.Domain == "" {
+		return nil, errors.New("config: domain is required")
+	}
+
+	m := im.NewKeyManager(cfg.Domain)
+	for i, kc := range cfg.Keys {
+		keyPath := kc.PrivateKey
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(filepath.Dir(path), keyPath)
+		}
+		sk, err := readPrivateKey(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		if !now.Before(kc.NotAfter) {
+			continue // expired keys are no longer published
+		}
+		if _, err := m.LoadKey(sk, kc.NotBefore, kc.NotAfter, now); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+	}
+	if _, ok := m.CurrentKey(now); !ok {
+		return nil, errors.New("config: no key valid for signing")
+	}
+	return m, nil
+}
+
+func readPrivateKey(path string) (*pbrsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var sk *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		sk, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if sk, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = errors.New("not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pbrsa.FromStdPrivateKey(sk), nil
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "ERROR: "+format+"\n", args...)
+	os.Exit(1)
+}
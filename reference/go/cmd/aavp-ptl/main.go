@@ -0,0 +1,252 @@
+// Command aavp-ptl runs a Policy Transparency Log (PROTOCOL.md section 8.3).
+// Platforms POST their signed SPDs to /ptl/v1/add-spd and receive a Signed
+// Policy Timestamp; monitors and DAs read tree heads, entries and proofs
+// from the other /ptl/v1/ endpoints.
+//
+// The log is configured with a JSON file:
+//
+//	{
+//	  "log_key": "log-key.pem",
+//	  "storage": "ptl.log",
+//	  "sth_file": "sth.json",
+//	  "retention": "P730D",
+//	  "platforms": {
+//	    "platform.example": "platform-vg.pem"
+//	  }
+//	}
+//
+// The log key is a PEM-encoded Ed25519 private key (PKCS #8). Entries are
+// appended to the storage file and never removed; retention, an ISO 8601
+// duration published in /ptl/v1/get-log-info, defaults to and may not be
+// shorter than two years (PROTOCOL.md section 8.3.3). Only the platforms
+// listed are accepted, each with the PEM-encoded RSA public key (PKIX) of
+// its VG. The latest signed tree head is written to sth_file; on startup the
+// log refuses to serve if the storage no longer matches it. Relative paths
+// are resolved against the directory of the configuration file.
+//
+// Usage:
+//
+//	go run ./cmd/aavp-ptl -config ptl.json -addr :8443 -tls-cert cert.pem -tls-key key.pem
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/ptl"
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+type config struct {
+	LogKey    string            `json:"log_key"`
+	Storage   string            `json:"storage"`
+	STHFile   string            `json:"sth_file"`
+	Retention string            `json:"retention"`
+	Platforms map[string]string `json:"platforms"`
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to the JSON log configuration")
+	addr := flag.String("addr", ":8443", "listen address")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate (PEM); plain HTTP if empty")
+	tlsKey := flag.String("tls-key", "", "TLS private key (PEM)")
+	flag.Parse()
+
+	if *configPath == "" {
+		fatalf("-config is required")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	// Appends are synced to the storage, which stays open until exit.
+	s, _, err := newServer(cfg, filepath.Dir(*configPath))
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if *tlsCert != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	fatalf("%v", err)
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.LogKey == "" || cfg.Storage == "" || cfg.STHFile == "" {
+		return nil, errors.New("config: log_key, storage and sth_file are required")
+	}
+	if len(cfg.Platforms) == 0 {
+		return nil, errors.New("config: platforms is required")
+	}
+	return &cfg, nil
+}
+
+// newServer opens the log storage, checks it against the saved tree head and
+// builds the server. The caller closes the storage.
+func newServer(cfg *config, dir string) (*ptl.Server, *ptl.FileStorage, error) {
+	retention := ptl.MinRetention
+	if cfg.Retention != "" {
+		var err error
+		if retention, err = spd.ParseDuration(cfg.Retention); err != nil {
+			return nil, nil, fmt.Errorf("config: retention: %w", err)
+		}
+		if retention < ptl.MinRetention {
+			return nil, nil, fmt.Errorf("config: %w", ptl.ErrShortRetention)
+		}
+	}
+	key, err := readEd25519Key(resolve(dir, cfg.LogKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	vgKeys := make(map[string]*rsa.PublicKey, len(cfg.Platforms))
+	for platform, path := range cfg.Platforms {
+		if vgKeys[platform], err = readRSAPublicKey(resolve(dir, path)); err != nil {
+			return nil, nil, fmt.Errorf("platform %s: %w", platform, err)
+		}
+	}
+
+	storage, err := ptl.OpenFileStorage(resolve(dir, cfg.Storage))
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := openLog(storage, key, vgKeys, resolve(dir, cfg.STHFile))
+	if err != nil {
+		storage.Close()
+		return nil, nil, err
+	}
+	s.Retention = retention
+	return s, storage, nil
+}
+
+func openLog(storage ptl.Storage, key ed25519.PrivateKey, vgKeys map[string]*rsa.PublicKey, sthPath string) (*ptl.Server, error) {
+	l, err := ptl.NewLog(storage, key)
+	if err != nil {
+		return nil, err
+	}
+	switch data, err := os.ReadFile(sthPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		if l.Size() != 0 {
+			return nil, fmt.Errorf("%s: missing for a log with %d entries", sthPath, l.Size())
+		}
+	case err != nil:
+		return nil, err
+	default:
+		var sth ptl.SignedTreeHead
+		if err := json.Unmarshal(data, &sth); err != nil {
+			return nil, fmt.Errorf("%s: %w", sthPath, err)
+		}
+		if err := l.VerifyTreeHead(&sth); err != nil {
+			return nil, fmt.Errorf("%s: %w", sthPath, err)
+		}
+	}
+
+	s, err := ptl.NewServer(l, ptl.StaticVGKeys(vgKeys))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSTH(sthPath, l.SignedTreeHead()); err != nil {
+		return nil, err
+	}
+	s.OnAppend = func(sth *ptl.SignedTreeHead) {
+		if err := writeSTH(sthPath, sth); err != nil {
+			fmt.Fprintf(os.Stderr, "sth: %v\n", err)
+		}
+	}
+	return s, nil
+}
+
+// writeSTH replaces the tree head saved at path.
+func writeSTH(path string, sth *ptl.SignedTreeHead) error {
+	data, err := json.Marshal(sth)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readEd25519Key(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PKCS #8 PEM block", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+func readRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: no PKIX PEM block", path)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA key", path)
+	}
+	if pub.N.BitLen() < spd.MinKeySize {
+		return nil, fmt.Errorf("%s: %w", path, spd.ErrWeakKey)
+	}
+	return pub, nil
+}
+
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "ERROR: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aavp-protocol/aavp-go/ptl"
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+const testSPD = `{
+  "spd_version": "1.0",
+  "platform": "platform.example",
+  "published": "2026-02-01T00:00:00Z",
+  "taxonomy_version": "aavp-content-taxonomy-v1",
+  "segmentation": {
+    "UNDER_13": {"restricted": ["explicit-sexual", "violence-graphic", "gambling", "substances", "self-harm"], "adapted": ["profanity"]},
+    "AGE_13_15": {"restricted": ["explicit-sexual", "violence-graphic", "gambling"]},
+    "AGE_16_17": {"restricted": ["explicit-sexual"]},
+    "OVER_18": {"unrestricted": ["*"]}
+  },
+  "policy_url": "https://platform.example/age-policy",
+  "signature": "c2lnbmF0dXJl"
+}`
+
+// writeConfig writes a log configuration with a fresh log key and one
+// platform to a temporary directory and returns its path and the VG key of
+// the platform.
+func writeConfig(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	_, logKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(logKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "log-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	vgKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(&vgKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "vg.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	data, _ := json.Marshal(config{
+		LogKey:    "log-key.pem",
+		Storage:   "ptl.log",
+		STHFile:   "sth.json",
+		Platforms: map[string]string{"platform.example": "vg.pem"},
+	})
+	path := filepath.Join(dir, "ptl.json")
+	writeFile(t, path, data)
+	return path, vgKey
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startServer(t *testing.T, path string) (*ptl.Server, *ptl.FileStorage, error) {
+	t.Helper()
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newServer(cfg, filepath.Dir(path))
+}
+
+func TestServerRestart(t *testing.T) {
+	path, vgKey := writeConfig(t)
+	s, storage, err := startServer(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := spd.Parse([]byte(testSPD), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sign(vgKey); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(d)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("POST", ptl.AddSPDPath, bytes.NewReader(data)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add-spd = %d %s", rec.Code, rec.Body)
+	}
+	var spt spd.SPT
+	json.Unmarshal(rec.Body.Bytes(), &spt)
+	if err := ptl.VerifySPT(&spt, data, s.Log.PublicKey()); err != nil {
+		t.Fatalf("VerifySPT: %v", err)
+	}
+	storage.Close()
+
+	// The saved tree head matches the storage: the log restarts with its
+	// entry.
+	s, storage, err = startServer(t, path)
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if s.Log.Size() != 1 {
+		t.Fatalf("log size after restart = %d", s.Log.Size())
+	}
+	storage.Close()
+
+	// A storage that lost entries no longer matches the saved tree head.
+	dir := filepath.Dir(path)
+	if err := os.Remove(filepath.Join(dir, "ptl.log")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := startServer(t, path); err == nil {
+		t.Error("log started over a storage that lost its entries")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	path, _ := writeConfig(t)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Retention = "P365D"
+	if _, _, err := newServer(cfg, filepath.Dir(path)); err == nil {
+		t.Error("retention of one year accepted")
+	}
+	cfg.Retention = "P1000D"
+	s, storage, err := newServer(cfg, filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if info, err := s.Info(); err != nil || info.Retention != "P1000D" {
+		t.Errorf("log info = %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,295 @@
+// Command aavp-vg-proxy runs a Verification Gate as a reverse proxy in front
+// of an origin that cannot embed the Go library. It serves the handshake
+// endpoint and /.well-known/aavp itself, verifies the session credential of
+// every other request and forwards it to the origin with the AAVP-Age-Bracket
+// header set to the verified bracket. Tokens and session credentials are
+// stripped before proxying; requests without a valid credential are forwarded
+// without the header (additive model, PROTOCOL.md section 7.7).
+//
+// The proxy is configured with a JSON file:
+//
+//	{
+//	  "upstream": "http://127.0.0.1:8080",
+//	  "public_url": "https://platform.example",
+//	  "handshake_path": "/aavp/verify",
+//	  "accepted_ims": ["im.example"],
+//	  "trust_file": "",
+//	  "age_policy": "https://platform.example/.well-known/aavp-age-policy.json",
+//	  "session": {
+//	    "ttl": "20m",
+//	    "keys": [
+//	      {"ed25519_key": "session-2026a.pem", "not_before": "2026-01-01T00:00:00Z", "not_after": "2026-04-01T00:00:00Z"}
+//	    ]
+//	  }
+//	}
+//
+// IM keys are synchronised from the .well-known/aavp-issuer documents of
+// accepted_ims unless trust_file is set, in which case the trust file is
+// loaded and reloaded whenever it changes. Session credential keys are
+// PEM-encoded Ed25519 private keys (PKCS #8) or, with "hmac_secret", files
+// holding an HMAC-SHA256 secret of at least 32 bytes. Relative paths are
+// resolved against the directory of the configuration file. Requests are not
+// logged; only startup and trust synchronisation errors are reported.
+//
+// The -txt flag prints the _aavp DNS TXT record matching the served
+// /.well-known/aavp document and exits.
+//
+// Usage:
+//
+//	go run ./cmd/aavp-vg-proxy -config proxy.json -addr :8443 -tls-cert cert.pem -tls-key key.pem
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/edge"
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/vg"
+)
+
+// defaultHandshakePath is the handshake path used when none is configured.
+const defaultHandshakePath = "/aavp/verify"
+
+// trustWatchInterval is how often the trust file is checked for changes.
+const trustWatchInterval = time.Minute
+
+type config struct {
+	Upstream      string        `json:"upstream"`
+	PublicURL     string        `json:"public_url"`
+	HandshakePath string        `json:"handshake_path"`
+	AcceptedIMs   []string      `json:"accepted_ims"`
+	TrustFile     string        `json:"trust_file"`
+	AgePolicy     string        `json:"age_policy"`
+	Session       sessionConfig `json:"session"`
+}
+
+type sessionConfig struct {
+	TTL  string             `json:"ttl"`
+	Keys []sessionKeyConfig `json:"keys"`
+}
+
+type sessionKeyConfig struct {
+	Ed25519Key string    `json:"ed25519_key"`
+	HMACSecret string    `json:"hmac_secret"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to the JSON proxy configuration")
+	addr := flag.String("addr", ":8443", "listen address")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate (PEM); plain HTTP if empty")
+	tlsKey := flag.String("tls-key", "", "TLS private key (PEM)")
+	printTXT := flag.Bool("txt", false, "print the _aavp DNS TXT record matching /.well-known/aavp and exit")
+	flag.Parse()
+
+	if *configPath == "" {
+		fatalf("-config is required")
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	handler, gate, err := newProxy(cfg, filepath.Dir(*configPath))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *printTXT {
+		fmt.Println(handler.wellKnown.TXTRecord())
+		return
+	}
+
+	ctx := context.Background()
+	if cfg.TrustFile != "" {
+		path := resolve(filepath.Dir(*configPath), cfg.TrustFile)
+		if err := gate.TrustStore.LoadFile(path); err != nil {
+			fatalf("trust file: %v", err)
+		}
+		go gate.TrustStore.Watch(ctx, path, trustWatchInterval, func(err error) {
+			fmt.Fprintf(os.Stderr, "trust file: %v\n", err)
+		})
+	} else {
+		syncer := vg.NewSyncer(gate.TrustStore, cfg.AcceptedIMs)
+		syncer.OnError = func(domain string, err error) {
+			fmt.Fprintf(os.Stderr, "sync %s: %v\n", domain, err)
+		}
+		go syncer.Run(ctx)
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Connection-level errors carry client addresses; discard them.
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	if *tlsCert != "" {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	fatalf("%v", err)
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if cfg.Upstream == "" || cfg.PublicURL == "" {
+		return nil, errors.New("config: upstream and public_url are required")
+	}
+	if len(cfg.AcceptedIMs) == 0 {
+		return nil, errors.New("config: accepted_ims is required")
+	}
+	if cfg.HandshakePath == "" {
+		cfg.HandshakePath = defaultHandshakePath
+	}
+	if !strings.HasPrefix(cfg.HandshakePath, "/") || cfg.HandshakePath == vg.WellKnownPath {
+		return nil, fmt.Errorf("config: invalid handshake_path %q", cfg.HandshakePath)
+	}
+	return &cfg, nil
+}
+
+// newProxy builds the proxy handler and the VG it verifies tokens with. The
+// trust store of the VG is empty; the caller fills it.
+func newProxy(cfg *config, dir string) (*proxy, *vg.VerificationGate, error) {
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		return nil, nil, fmt.Errorf("config: invalid upstream %q", cfg.Upstream)
+	}
+	public, err := url.Parse(cfg.PublicURL)
+	if err != nil || public.Scheme != "https" || public.Host == "" {
+		return nil, nil, fmt.Errorf("config: public_url %q is not an HTTPS URL", cfg.PublicURL)
+	}
+
+	keys, err := loadSessionKeys(cfg.Session.Keys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuer := session.NewIssuer(keys)
+	if cfg.Session.TTL != "" {
+		if issuer.TTL, err = time.ParseDuration(cfg.Session.TTL); err != nil {
+			return nil, nil, fmt.Errorf("config: session ttl: %w", err)
+		}
+	}
+	if issuer.TTL < session.MinTTL || issuer.TTL > session.MaxTTL {
+		return nil, nil, fmt.Errorf("config: session ttl %v outside [%v, %v]", issuer.TTL, session.MinTTL, session.MaxTTL)
+	}
+
+	gate := vg.NewVerificationGate()
+	wellKnown := vg.NewDiscovery(gate, strings.TrimSuffix(cfg.PublicURL, "/")+cfg.HandshakePath, cfg.AcceptedIMs)
+	wellKnown.AgePolicy = cfg.AgePolicy
+	if err := wellKnown.Document().Validate(public.Hostname()); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			pr.SetXForwarded()
+		},
+		// Responses depend on the forwarded bracket; caches must keep one
+		// variant per bracket (PROTOCOL.md section 7.9).
+		ModifyResponse: func(resp *http.Response) error {
+			edge.AddVary(resp.Header)
+			return nil
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	return &proxy{
+		handshakePath: cfg.HandshakePath,
+		handshake:     vg.NewHandshakeHandler(gate, issuer),
+		wellKnown:     wellKnown,
+		keys:          keys,
+		upstream:      rp,
+		now:           time.Now,
+	}, gate, nil
+}
+
+func loadSessionKeys(entries []sessionKeyConfig, dir string) (*session.Keyset, error) {
+	ks := session.NewKeyset()
+	for i, kc := range entries {
+		if kc.NotBefore.IsZero() || !kc.NotAfter.After(kc.NotBefore) {
+			return nil, fmt.Errorf("session key %d: invalid validity window", i)
+		}
+		switch {
+		case kc.Ed25519Key != "" && kc.HMACSecret == "":
+			priv, err := readEd25519Key(resolve(dir, kc.Ed25519Key))
+			if err != nil {
+				return nil, fmt.Errorf("session key %d: %w", i, err)
+			}
+			ks.Add(session.NewEd25519Key(priv, kc.NotBefore, kc.NotAfter))
+		case kc.HMACSecret != "" && kc.Ed25519Key == "":
+			secret, err := os.ReadFile(resolve(dir, kc.HMACSecret))
+			if err != nil {
+				return nil, fmt.Errorf("session key %d: %w", i, err)
+			}
+			k, err := session.NewHMACKey(secret, kc.NotBefore, kc.NotAfter)
+			if err != nil {
+				return nil, fmt.Errorf("session key %d: %w", i, err)
+			}
+			ks.Add(k)
+		default:
+			return nil, fmt.Errorf("session key %d: exactly one of ed25519_key and hmac_secret is required", i)
+		}
+	}
+	if _, ok := ks.SigningKey(time.Now()); !ok {
+		return nil, errors.New("config: no session key valid for signing")
+	}
+	return ks, nil
+}
+
+func readEd25519Key(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PKCS #8 PEM block", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "ERROR: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/edge"
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/vg"
+)
+
+// proxy serves the AAVP endpoints itself and forwards every other request to
+// the origin with the age bracket of a valid session credential in
+// edge.BracketHeader. Token and credential material never reaches the
+// origin. Requests without a valid credential are forwarded without the
+// header: no signal means no restriction (PROTOCOL.md section 7.7). Origin
+// responses carry Vary: AAVP-Age-Bracket either way.
+type proxy struct {
+	handshakePath string
+	handshake     http.Handler
+	wellKnown     *vg.Discovery
+	keys          *session.Keyset
+	upstream      http.Handler
+	now           func() time.Time
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case p.handshakePath:
+		p.handshake.ServeHTTP(w, r)
+		return
+	case vg.WellKnownPath:
+		p.wellKnown.ServeHTTP(w, r)
+		return
+	}
+
+	var cred *edge.Credential
+	if encoded, ok := session.FromRequest(r); ok {
+		if c, err := p.keys.Verify(encoded, p.now()); err == nil {
+			cred = &edge.Credential{AgeBracket: c.AgeBracket, ExpiresAt: c.ExpiresAt}
+		}
+	}
+	out := r.Clone(r.Context())
+	stripAAVP(out.Header)
+	edge.SetBracket(out, cred)
+	p.upstream.ServeHTTP(w, out)
+}
+
+// stripAAVP removes tokens and session credentials from h.
+func stripAAVP(h http.Header) {
+	h.Del(vg.TokenHeader)
+	h.Del(session.Header)
+	removeCookie(h, session.CookieName)
+}
+
+// removeCookie deletes the cookie called name from the Cookie headers of h,
+// leaving the other cookies as sent.
+func removeCookie(h http.Header, name string) {
+	values := h.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+	h.Del("Cookie")
+	for _, v := range values {
+		var kept []string
+		for _, part := range strings.Split(v, ";") {
+			n, _, _ := strings.Cut(part, "=")
+			if strings.TrimSpace(n) != name && strings.TrimSpace(part) != "" {
+				kept = append(kept, strings.TrimSpace(part))
+			}
+		}
+		if len(kept) > 0 {
+			h.Add("Cookie", strings.Join(kept, "; "))
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+	"github.com/aavp-protocol/aavp-go/edge"
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/vg"
+)
+
+// writeConfig writes a proxy configuration with one Ed25519 session key to a
+// temporary directory and returns its path.
+func writeConfig(t *testing.T, upstream string) string {
+	t.Helper()
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "session.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cfg := config{
+		Upstream:    upstream,
+		PublicURL:   "https://platform.example",
+		AcceptedIMs: []string{"im.example"},
+		Session: sessionConfig{Keys: []sessionKeyConfig{
+			{Ed25519Key: "session.pem", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)},
+		}},
+	}
+	data, err := json.Marshal(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "proxy.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func setupProxy(t *testing.T) (*proxy, *http.Header) {
+	t.Helper()
+	var seen http.Header
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.Header().Set("Vary", "Accept-Encoding")
+	}))
+	t.Cleanup(origin.Close)
+
+	path := writeConfig(t, origin.URL)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := newProxy(cfg, filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, &seen
+}
+
+func TestProxyForwardsBracket(t *testing.T) {
+	p, seen := setupProxy(t)
+	cred, _, err := session.NewIssuer(p.keys).Issue(token.AgeBracketAge13_15, time.Now().Add(time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	r.AddCookie(&http.Cookie{Name: "lang", Value: "es"})
+	r.AddCookie(session.Cookie(cred, time.Now().Add(time.Hour)))
+	r.Header.Set(vg.TokenHeader, "AAEC")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := seen.Get(edge.BracketHeader); got != "AGE_13_15" {
+		t.Errorf("%s = %q, want AGE_13_15", edge.BracketHeader, got)
+	}
+	if seen.Get(vg.TokenHeader) != "" || seen.Get("Cookie") != "lang=es" {
+		t.Errorf("token material forwarded: %v", *seen)
+	}
+}
+
+func TestProxyAdditive(t *testing.T) {
+	p, seen := setupProxy(t)
+	for _, value := range []string{"", "not-a-credential"} {
+		r := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		// A client cannot choose its own bracket.
+		r.Header.Set(edge.BracketHeader, "OVER_18")
+		if value != "" {
+			r.Header.Set(session.Header, value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		if _, ok := (*seen)[edge.BracketHeader]; ok || seen.Get(session.Header) != "" {
+			t.Errorf("credential %q: forwarded headers %v", value, *seen)
+		}
+	}
+}
+
+func TestProxyVary(t *testing.T) {
+	// Every origin response is cached per bracket, with or without one.
+	p, _ := setupProxy(t)
+	cred, _, err := session.NewIssuer(p.keys).Issue(token.AgeBracketUnder13, time.Now().Add(time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"", cred} {
+		r := httptest.NewRequest(http.MethodGet, "/feed", nil)
+		if value != "" {
+			r.Header.Set(session.Header, value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if got := w.Header().Values("Vary"); !slices.Equal(got, []string{"Accept-Encoding", edge.BracketHeader}) {
+			t.Errorf("credential %q: Vary = %q", value, got)
+		}
+	}
+}
+
+func TestProxyServesAAVPEndpoints(t *testing.T) {
+	p, seen := setupProxy(t)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, vg.WellKnownPath, nil))
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("headers = %v", w.Header())
+	}
+	doc, err := discovery.ParseDocument(w.Body.Bytes(), "platform.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.VGEndpoint != "https://platform.example"+defaultHandshakePath {
+		t.Errorf("vg_endpoint = %q", doc.VGEndpoint)
+	}
+	if got := p.wellKnown.TXTRecord().String(); got != "v=aavp1; e=https://platform.example/aavp/verify; im=im.example" {
+		t.Errorf("TXT record = %q", got)
+	}
+
+	// The handshake is answered by the proxy, never by the origin.
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, defaultHandshakePath, nil))
+	if w.Code != http.StatusBadRequest || *seen != nil {
+		t.Errorf("handshake: status = %d, origin saw %v", w.Code, *seen)
+	}
+}
+
+func TestRemoveCookie(t *testing.T) {
+	h := http.Header{"Cookie": {"a=1; " + session.CookieName + "=x; b=2", session.CookieName + "=y"}}
+	removeCookie(h, session.CookieName)
+	if got := h.Values("Cookie"); len(got) != 1 || got[0] != "a=1; b=2" {
+		t.Fatalf("Cookie = %q", got)
+	}
+}
+
+func TestLoadConfigRejects(t *testing.T) {
+	path := writeConfig(t, "http://127.0.0.1:1")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Session.TTL = "2h"
+	if _, _, err := newProxy(cfg, filepath.Dir(path)); err == nil {
+		t.Error("session ttl above MaxTTL accepted")
+	}
+	cfg.Session.TTL = ""
+	cfg.PublicURL = "http://platform.example"
+	if _, _, err := newProxy(cfg, filepath.Dir(path)); err == nil {
+		t.Error("plain HTTP public_url accepted")
+	}
+}
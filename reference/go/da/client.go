@@ -0,0 +1,304 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+// Issuance client defaults.
+const (
+	DefaultMaxAttempts = 4
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = 30 * time.Second
+
+	maxResponseSize = 1 << 20
+)
+
+// SignError is returned when the IM rejects a signing request. Code is the
+// error field of the IM response, if any.
+type SignError struct {
+	StatusCode int
+	Code       string
+}
+
+func (e *SignError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("da: signing request rejected (%d): %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("da: signing request rejected (%d)", e.StatusCode)
+}
+
+// FetchIssuer retrieves the .well-known/aavp-issuer document of an IM and
+// checks that its issuer matches domain (PROTOCOL.md section 5.2.3).
+func FetchIssuer(ctx context.Context, client *http.Client, domain string) (*im.WellKnownIssuer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+im.WellKnownIssuerPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("da: %s%s returned %s", domain, im.WellKnownIssuerPath, resp.Status)
+	}
+	var doc im.WellKnownIssuer
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("da: invalid issuer document from %s: %w", domain, err)
+	}
+	if !strings.EqualFold(doc.Issuer, domain) {
+		return nil, fmt.Errorf("da: issuer %q does not match domain %q", doc.Issuer, domain)
+	}
+	return &doc, nil
+}
+
+// IssuanceClient sends blinded messages to an IM signing endpoint over HTTP.
+// Requests are padded to 2 KiB multiples (PROTOCOL.md section 4.5.2). 429 and
+// 5xx responses, as well as transport errors, are retried with exponential
+// backoff capped at MaxBackoff, honouring Retry-After: a response asking to
+// wait longer than MaxBackoff ends the retries with its error.
+type IssuanceClient struct {
+	HTTPClient  *http.Client
+	Endpoint    string
+	TokenKeyID  [32]byte
+	TokenType   uint16
+	MaxAttempts int
+	Backoff     time.Duration // delay before the first retry; doubled on each retry
+	MaxBackoff  time.Duration
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewIssuanceClient creates a client for the IM described by doc. The document
+// must list the agent's TokenKeyID with the same public key as
+// agent.IMPublicKey, valid at now, and its signing_endpoint must be an HTTPS
+// URI on the issuer domain or a subdomain of it.
+func NewIssuanceClient(agent *DeviceAgent, doc *im.WellKnownIssuer, now time.Time) (*IssuanceClient, error) {
+	endpoint, err := url.Parse(doc.SigningEndpoint)
+	if err != nil || endpoint.Scheme != "https" || !discovery.SameOrSubdomain(endpoint.Hostname(), doc.Issuer) {
+		return nil, fmt.Errorf("da: signing_endpoint %q is not an HTTPS URI under %s", doc.SigningEndpoint, doc.Issuer)
+	}
+	key, err := findKey(doc, agent.TokenKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !samePublicKey(key.PublicKey, agent.IMPublicKey) {
+		return nil, errors.New("da: issuer public key does not match the agent's key")
+	}
+	if now.Before(key.NotBefore) || !now.Before(key.NotAfter) {
+		return nil, errors.New("da: issuer key is not valid at this time")
+	}
+	return &IssuanceClient{
+		HTTPClient:  http.DefaultClient,
+		Endpoint:    doc.SigningEndpoint,
+		TokenKeyID:  agent.TokenKeyID,
+		TokenType:   key.TokenType,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}, nil
+}
+
+func findKey(doc *im.WellKnownIssuer, keyID [32]byte) (*im.IssuerKey, error) {
+	for i := range doc.Keys {
+		key, err := doc.Keys[i].ParseKey()
+		if err != nil {
+			continue
+		}
+		if key.TokenKeyID == keyID {
+			return key, nil
+		}
+	}
+	return nil, errors.New("da: token_key_id not published by the issuer")
+}
+
+func samePublicKey(a, b *pbrsa.PublicKey) bool {
+	return a.N.Cmp(b.N) == 0 && a.E.Cmp(b.E) == 0
+}
+
+// Sign sends one signing request and returns the blind signature.
+func (c *IssuanceClient) Sign(ctx context.Context, blindedMsg, metadata []byte) ([]byte, error) {
+	data, err := c.send(ctx, &im.SignRequest{
+		TokenType:  c.TokenType,
+		TokenKeyID: base64.RawURLEncoding.EncodeToString(c.TokenKeyID[:]),
+		BlindedMsg: base64.RawURLEncoding.EncodeToString(blindedMsg),
+		Metadata:   base64.RawURLEncoding.EncodeToString(metadata),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sr im.SignResponse
+	if err := json.Unmarshal(data, &sr); err != nil {
+		return nil, fmt.Errorf("da: invalid signing response: %w", err)
+	}
+	blindSig, err := base64.RawURLEncoding.DecodeString(sr.BlindSig)
+	if err != nil || len(blindSig) == 0 {
+		return nil, errors.New("da: invalid blind_sig encoding")
+	}
+	return blindSig, nil
+}
+
+// SignBatch sends the items in one batched signing request (PROTOCOL.md
+// section 4.5.1) and returns one result per item, in order. Items rejected by
+// the IM carry a *SignError with the item's error code.
+func (c *IssuanceClient) SignBatch(ctx context.Context, items []im.BatchItem) ([]im.BatchResult, error) {
+	if len(items) == 0 || len(items) > im.MaxBatchSize {
+		return nil, im.ErrBatchSize
+	}
+	req := &im.SignRequest{
+		TokenType:  c.TokenType,
+		TokenKeyID: base64.RawURLEncoding.EncodeToString(c.TokenKeyID[:]),
+		Items:      make([]im.SignItem, len(items)),
+	}
+	for i, it := range items {
+		req.Items[i] = im.SignItem{
+			BlindedMsg: base64.RawURLEncoding.EncodeToString(it.BlindedMsg),
+			Metadata:   base64.RawURLEncoding.EncodeToString(it.Metadata),
+		}
+	}
+	data, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var sr im.SignResponse
+	if err := json.Unmarshal(data, &sr); err != nil {
+		return nil, fmt.Errorf("da: invalid signing response: %w", err)
+	}
+	if len(sr.Items) != len(items) {
+		return nil, fmt.Errorf("da: batch response has %d items, want %d", len(sr.Items), len(items))
+	}
+	results := make([]im.BatchResult, len(items))
+	for i, it := range sr.Items {
+		if it.Error != "" {
+			results[i].Err = &SignError{StatusCode: http.StatusOK, Code: it.Error}
+			continue
+		}
+		blindSig, err := base64.RawURLEncoding.DecodeString(it.BlindSig)
+		if err != nil || len(blindSig) == 0 {
+			results[i].Err = errors.New("da: invalid blind_sig encoding")
+			continue
+		}
+		results[i].BlindSig = blindSig
+	}
+	return results, nil
+}
+
+// SignerFunc returns a SignerFunc for DeviceAgent.IssueToken bound to ctx.
+func (c *IssuanceClient) SignerFunc(ctx context.Context) SignerFunc {
+	return func(blindedMsg, metadata []byte) ([]byte, error) {
+		return c.Sign(ctx, blindedMsg, metadata)
+	}
+}
+
+// BatchSignerFunc returns a BatchSignerFunc for DeviceAgent.IssueTokens bound
+// to ctx.
+func (c *IssuanceClient) BatchSignerFunc(ctx context.Context) BatchSignerFunc {
+	return func(items []im.BatchItem) ([]im.BatchResult, error) {
+		return c.SignBatch(ctx, items)
+	}
+}
+
+// send posts a padded request, retrying as described on IssuanceClient, and
+// returns the body of the successful response.
+func (c *IssuanceClient) send(ctx context.Context, req *im.SignRequest) ([]byte, error) {
+	body, err := padding.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	backoff := c.Backoff
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		var data []byte
+		data, retryAfter, lastErr = c.post(ctx, body)
+		if lastErr == nil {
+			return data, nil
+		}
+		if retryAfter < 0 || attempt >= c.MaxAttempts {
+			return nil, lastErr
+		}
+		// Never retry before the server asks to; if it asks for longer than
+		// MaxBackoff, give up instead.
+		if retryAfter > c.MaxBackoff {
+			return nil, lastErr
+		}
+		wait := max(min(backoff, c.MaxBackoff), retryAfter)
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// post performs one attempt. retryAfter is negative when the error must not be
+// retried, and otherwise holds the server's Retry-After (zero if absent).
+func (c *IssuanceClient) post(ctx context.Context, body []byte) (data []byte, retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, ctx.Err()
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e im.ErrorResponse
+		json.Unmarshal(data, &e)
+		err := &SignError{StatusCode: resp.StatusCode, Code: e.Error}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, parseRetryAfter(resp.Header.Get("Retry-After")), err
+		}
+		return nil, -1, err
+	}
+	return data, 0, nil
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,239 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/internal/testkeys"
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// handlerClient returns an HTTP client that serves every request with h.
+func handlerClient(h http.Handler) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Result(), nil
+	})}
+}
+
+func setupIM(t *testing.T) (*im.Server, *im.ManagedKey) {
+	t.Helper()
+	m := im.NewKeyManager("im.example")
+	now := time.Now()
+	k, err := m.AddKey(testkeys.SafePrimeKey(), now.Add(-time.Hour), now.Add(90*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+	return im.NewServer(m), k
+}
+
+func TestIssuanceClientIssuesToken(t *testing.T) {
+	srv, key := setupIM(t)
+	var requestSizes []int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			requestSizes = append(requestSizes, len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		srv.Handler().ServeHTTP(w, r)
+	})
+	client := handlerClient(h)
+
+	doc, err := FetchIssuer(context.Background(), client, "im.example")
+	if err != nil {
+		t.Fatalf("FetchIssuer: %v", err)
+	}
+	agent := NewDeviceAgent(&key.PrivateKey.PublicKey, key.SPKIDER)
+	ic, err := NewIssuanceClient(agent, doc, time.Now())
+	if err != nil {
+		t.Fatalf("NewIssuanceClient: %v", err)
+	}
+	ic.HTTPClient = client
+
+	tok, err := agent.IssueToken(token.AgeBracketAge16_17, 2*time.Hour, ic.SignerFunc(context.Background()))
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	if err := pbrsa.Verify(agent.IMPublicKey, tok.MessageToSign(), tok.PublicMetadata(), tok.Authenticator); err != nil {
+		t.Fatalf("token does not verify: %v", err)
+	}
+	if len(requestSizes) != 1 || requestSizes[0]%padding.BlockSize != 0 {
+		t.Errorf("request not padded: sizes %v", requestSizes)
+	}
+}
+
+func TestIssuanceClientIssuesBatch(t *testing.T) {
+	srv, key := setupIM(t)
+	posts := 0
+	client := handlerClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		srv.Handler().ServeHTTP(w, r)
+	}))
+	doc, err := FetchIssuer(context.Background(), client, "im.example")
+	if err != nil {
+		t.Fatalf("FetchIssuer: %v", err)
+	}
+	agent := NewDeviceAgent(&key.PrivateKey.PublicKey, key.SPKIDER)
+	ic, err := NewIssuanceClient(agent, doc, time.Now())
+	if err != nil {
+		t.Fatalf("NewIssuanceClient: %v", err)
+	}
+	ic.HTTPClient = client
+
+	toks, err := agent.IssueTokens(token.AgeBracketOver18, 3*time.Hour, 5, ic.BatchSignerFunc(context.Background()))
+	if err != nil {
+		t.Fatalf("IssueTokens: %v", err)
+	}
+	if len(toks) != 5 || posts != 1 {
+		t.Fatalf("got %d tokens in %d requests", len(toks), posts)
+	}
+	for i, tok := range toks {
+		if err := pbrsa.Verify(agent.IMPublicKey, tok.MessageToSign(), tok.PublicMetadata(), tok.Authenticator); err != nil {
+			t.Errorf("token %d does not verify: %v", i, err)
+		}
+		if i > 0 && tok.Nonce == toks[0].Nonce {
+			t.Error("tokens share a nonce")
+		}
+	}
+
+	// A TTL beyond the IM maximum fails every item; nothing is returned.
+	toks, err = agent.IssueTokens(token.AgeBracketOver18, 6*time.Hour, 2, ic.BatchSignerFunc(context.Background()))
+	var se *SignError
+	if len(toks) != 0 || !errors.As(err, &se) || se.Code != im.ErrCodeInvalidMetadata {
+		t.Errorf("got %d tokens, %v", len(toks), err)
+	}
+	if _, err := agent.IssueTokens(token.AgeBracketOver18, time.Hour, im.MaxBatchSize+1, ic.BatchSignerFunc(context.Background())); !errors.Is(err, im.ErrBatchSize) {
+		t.Errorf("oversized batch: got %v", err)
+	}
+}
+
+func TestIssuanceClientRetries(t *testing.T) {
+	srv, key := setupIM(t)
+	agent := NewDeviceAgent(&key.PrivateKey.PublicKey, key.SPKIDER)
+	doc := srv.Keys.WellKnownResponse(time.Now())
+	ic, err := NewIssuanceClient(agent, doc, time.Now())
+	if err != nil {
+		t.Fatalf("NewIssuanceClient: %v", err)
+	}
+	var sleeps []time.Duration
+	ic.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	// Two transient failures, then success.
+	failures := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	ic.HTTPClient = handlerClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(failures) > 0 {
+			status := failures[0]
+			failures = failures[1:]
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "5")
+			}
+			w.WriteHeader(status)
+			return
+		}
+		srv.Handler().ServeHTTP(w, r)
+	}))
+	if _, err := agent.IssueToken(token.AgeBracketOver18, time.Hour+30*time.Minute, ic.SignerFunc(context.Background())); err != nil {
+		t.Fatalf("IssueToken after retries: %v", err)
+	}
+	if len(sleeps) != 2 || sleeps[0] != 5*time.Second || sleeps[1] != 2*DefaultBackoff {
+		t.Errorf("backoff delays: got %v", sleeps)
+	}
+
+	// Persistent 5xx gives up after MaxAttempts.
+	sleeps = nil
+	attempts := 0
+	ic.HTTPClient = handlerClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	if _, err := ic.Sign(context.Background(), make([]byte, 256), make([]byte, 9)); err == nil {
+		t.Error("expected error after persistent 502")
+	}
+	if attempts != DefaultMaxAttempts {
+		t.Errorf("attempts: got %d, want %d", attempts, DefaultMaxAttempts)
+	}
+
+	// A Retry-After beyond MaxBackoff is honoured by giving up, not by
+	// retrying early.
+	sleeps, attempts = nil, 0
+	ic.HTTPClient = handlerClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	if _, err := ic.Sign(context.Background(), make([]byte, 256), make([]byte, 9)); err == nil {
+		t.Error("expected error after Retry-After: 120")
+	}
+	if attempts != 1 || len(sleeps) != 0 {
+		t.Errorf("Retry-After: 120: %d attempts, sleeps %v", attempts, sleeps)
+	}
+
+	// 4xx rejections are not retried and expose the IM error code.
+	attempts = 0
+	ic.HTTPClient = handlerClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		srv.Handler().ServeHTTP(w, r)
+	}))
+	_, err = ic.Sign(context.Background(), make([]byte, 256), make([]byte, 9))
+	se, ok := err.(*SignError)
+	if !ok || se.Code != im.ErrCodeInvalidMetadata || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want invalid_metadata after 1", err, attempts)
+	}
+}
+
+func TestNewIssuanceClientChecksIssuer(t *testing.T) {
+	srv, key := setupIM(t)
+	now := time.Now()
+	doc := srv.Keys.WellKnownResponse(now)
+
+	// Agent configured with a different IM key.
+	other := testkeys.VectorKey()
+	otherSPKI, _ := im.MarshalSPKIDER(&other.PublicKey)
+	if _, err := NewIssuanceClient(NewDeviceAgent(&other.PublicKey, otherSPKI), doc, now); err == nil {
+		t.Error("expected error for token_key_id not published")
+	}
+
+	// Published token_key_id but a different public key.
+	mismatched := NewDeviceAgentWithKeyID(&other.PublicKey, key.TokenKeyID)
+	if _, err := NewIssuanceClient(mismatched, doc, now); err == nil {
+		t.Error("expected error for public key mismatch")
+	}
+
+	agent := NewDeviceAgent(&key.PrivateKey.PublicKey, key.SPKIDER)
+	if _, err := NewIssuanceClient(agent, doc, key.NotAfter); err == nil {
+		t.Error("expected error for expired key")
+	}
+
+	for _, endpoint := range []string{"http://im.example/aavp/v1/sign", "https://evil.example/aavp/v1/sign", "https://notim.example/aavp/v1/sign"} {
+		bad := *doc
+		bad.SigningEndpoint = endpoint
+		if _, err := NewIssuanceClient(agent, &bad, now); err == nil {
+			t.Errorf("expected error for signing_endpoint %q", endpoint)
+		}
+	}
+	sub := *doc
+	sub.SigningEndpoint = "https://sign.im.example/aavp/v1/sign"
+	if _, err := NewIssuanceClient(agent, &sub, now); err != nil {
+		t.Errorf("subdomain signing_endpoint rejected: %v", err)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
+	"github.com/aavp-protocol/aavp-go/im"
 	"github.com/aavp-protocol/aavp-go/pbrsa"
 	"github.com/aavp-protocol/aavp-go/token"
 )
@@ -16,10 +18,17 @@ import (
 // and public metadata, and returns the blind signature.
 type SignerFunc func(blindedMsg, metadata []byte) ([]byte, error)
 
+// BatchSignerFunc represents the IM's batched blind signing service. It returns
+// one result per item, in order.
+type BatchSignerFunc func(items []im.BatchItem) ([]im.BatchResult, error)
+
 // DeviceAgent holds the configuration for a Device Agent.
 type DeviceAgent struct {
 	IMPublicKey *pbrsa.PublicKey
 	TokenKeyID  [32]byte
+	TokenType   uint16 // token_type stamped by Prepare; zero means 0x0001
+	// Now is the clock used by Prepare to compute expires_at; nil means time.Now.
+	Now func() time.Time
 }
 
 // NewDeviceAgent creates a new DeviceAgent from the IM's master public key.
@@ -29,6 +38,7 @@ func NewDeviceAgent(imPK *pbrsa.PublicKey, spkiDER []byte) *DeviceAgent {
 	return &DeviceAgent{
 		IMPublicKey: imPK,
 		TokenKeyID:  keyID,
+		TokenType:   token.TokenTypeRSAPBSSASHA384,
 	}
 }
 
@@ -37,7 +47,15 @@ func NewDeviceAgentWithKeyID(imPK *pbrsa.PublicKey, keyID [32]byte) *DeviceAgent
 	return &DeviceAgent{
 		IMPublicKey: imPK,
 		TokenKeyID:  keyID,
+		TokenType:   token.TokenTypeRSAPBSSASHA384,
+	}
+}
+
+func (da *DeviceAgent) now() time.Time {
+	if da.Now != nil {
+		return da.Now()
 	}
+	return time.Now()
 }
 
 // PrepareResult contains the output of the Prepare step.
@@ -60,13 +78,17 @@ func (da *DeviceAgent) Prepare(ageBracket uint8, ttl time.Duration) (*PrepareRes
 	}
 
 	// Compute expires_at: round to nearest hour
-	expiresAt := time.Now().Add(ttl).Truncate(time.Hour).Unix()
+	expiresAt := da.now().Add(ttl).Truncate(time.Hour).Unix()
 	if expiresAt <= 0 {
 		return nil, errors.New("da: expires_at must be positive")
 	}
 
+	tokenType, err := da.tokenType()
+	if err != nil {
+		return nil, err
+	}
 	tok := &token.Token{
-		TokenType:  token.TokenTypeRSAPBSSASHA384,
+		TokenType:  tokenType,
 		Nonce:      nonce,
 		TokenKeyID: da.TokenKeyID,
 		AgeBracket: ageBracket,
@@ -85,8 +107,12 @@ func (da *DeviceAgent) PrepareWithValues(ageBracket uint8, nonce [32]byte, expir
 		return nil, errors.New("da: invalid age bracket")
 	}
 
+	tokenType, err := da.tokenType()
+	if err != nil {
+		return nil, err
+	}
 	tok := &token.Token{
-		TokenType:  token.TokenTypeRSAPBSSASHA384,
+		TokenType:  tokenType,
 		Nonce:      nonce,
 		TokenKeyID: da.TokenKeyID,
 		AgeBracket: ageBracket,
@@ -123,7 +149,7 @@ func (da *DeviceAgent) Finalize(tok *token.Token, blindSig []byte, state *pbrsa.
 	if err != nil {
 		return err
 	}
-	copy(tok.Authenticator[:], authenticator)
+	tok.Authenticator = authenticator
 	return nil
 }
 
@@ -150,3 +176,50 @@ func (da *DeviceAgent) IssueToken(ageBracket uint8, ttl time.Duration, signer Si
 
 	return result.Token, nil
 }
+
+// IssueTokens performs the issuance flow for n tokens with a single batched
+// request to the IM (PROTOCOL.md section 4.5.1). Each token has its own nonce
+// and blinding. It returns the tokens that were issued; if some items failed,
+// err describes them.
+func (da *DeviceAgent) IssueTokens(ageBracket uint8, ttl time.Duration, n int, signer BatchSignerFunc) ([]*token.Token, error) {
+	if n <= 0 || n > im.MaxBatchSize {
+		return nil, im.ErrBatchSize
+	}
+	prepared := make([]*PrepareResult, n)
+	blinded := make([]*BlindResult, n)
+	items := make([]im.BatchItem, n)
+	for i := range n {
+		result, err := da.Prepare(ageBracket, ttl)
+		if err != nil {
+			return nil, err
+		}
+		blindResult, err := da.Blind(result.Token, result.Metadata, nil)
+		if err != nil {
+			return nil, err
+		}
+		prepared[i], blinded[i] = result, blindResult
+		items[i] = im.BatchItem{BlindedMsg: blindResult.BlindedMsg, Metadata: result.Metadata}
+	}
+
+	results, err := signer(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != n {
+		return nil, fmt.Errorf("da: %d batch results for %d items", len(results), n)
+	}
+
+	tokens := make([]*token.Token, 0, n)
+	var errs []error
+	for i, res := range results {
+		if res.Err == nil {
+			res.Err = da.Finalize(prepared[i].Token, res.BlindSig, blinded[i].State, prepared[i].Metadata)
+		}
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", i, res.Err))
+			continue
+		}
+		tokens = append(tokens, prepared[i].Token)
+	}
+	return tokens, errors.Join(errs...)
+}
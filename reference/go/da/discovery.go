@@ -0,0 +1,221 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+)
+
+// Discovery parameters (PROTOCOL.md section 5.3).
+const (
+	// NegativeCacheTTL is how long a platform without AAVP support is remembered.
+	NegativeCacheTTL = time.Hour
+	// DefaultDiscoveryTTL is used when .well-known/aavp carries no max-age and
+	// for records obtained from DNS.
+	DefaultDiscoveryTTL = time.Hour
+	// MaxDiscoveryTTL caps the max-age of .well-known/aavp, so that a single
+	// response cannot pin a stale document.
+	MaxDiscoveryTTL = 24 * time.Hour
+
+	rateLimitAttempts = 3
+)
+
+// ErrNotSupported is returned when a platform does not support AAVP.
+var ErrNotSupported = errors.New("da: platform does not support AAVP")
+
+// TXTResolver looks up DNS TXT records. *net.Resolver implements it.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DiscoverySource tells how a platform was discovered.
+type DiscoverySource uint8
+
+const (
+	SourceWellKnown DiscoverySource = iota // .well-known/aavp
+	SourceDNS                              // _aavp TXT record
+)
+
+// Platform is the result of discovering a platform.
+type Platform struct {
+	Domain string
+	Source DiscoverySource
+	// Document holds the discovery data. For SourceDNS it only carries
+	// vg_endpoint and the IM domains; AAVPVersion and AcceptedTokenTypes are
+	// empty and must be taken as unknown.
+	Document *discovery.Document
+}
+
+type discoveryEntry struct {
+	platform *Platform // nil for a negative result
+	expires  time.Time
+}
+
+// Resolver discovers AAVP support for platforms following the priority of
+// PROTOCOL.md section 5.3.3: local cache, .well-known/aavp, then the _aavp TXT
+// record. Negative results are cached for NegativeCacheTTL. It is safe for
+// concurrent use.
+type Resolver struct {
+	HTTPClient *http.Client
+	DNS        TXTResolver
+	Now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]discoveryEntry
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewResolver creates a Resolver using the default HTTP client and DNS resolver.
+func NewResolver() *Resolver {
+	return &Resolver{
+		HTTPClient: http.DefaultClient,
+		DNS:        net.DefaultResolver,
+		Now:        time.Now,
+	}
+}
+
+// Resolve returns the discovery data for domain, or ErrNotSupported.
+func (r *Resolver) Resolve(ctx context.Context, domain string) (*Platform, error) {
+	domain = normalizeHost(domain)
+	now := r.Now()
+
+	r.mu.Lock()
+	entry, cached := r.cache[domain]
+	r.mu.Unlock()
+	if cached && now.Before(entry.expires) {
+		if entry.platform == nil {
+			return nil, ErrNotSupported
+		}
+		return entry.platform, nil
+	}
+
+	doc, ttl, status := r.fetchWellKnown(ctx, domain)
+	if doc != nil {
+		return r.store(domain, &Platform{Domain: domain, Source: SourceWellKnown, Document: doc}, now.Add(ttl)), nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// On a server error, a stale cached result is preferred over DNS.
+	if status >= 500 && cached && entry.platform != nil {
+		return entry.platform, nil
+	}
+
+	if doc := r.lookupTXT(ctx, domain); doc != nil {
+		return r.store(domain, &Platform{Domain: domain, Source: SourceDNS, Document: doc}, now.Add(DefaultDiscoveryTTL)), nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	r.store(domain, nil, now.Add(NegativeCacheTTL))
+	return nil, ErrNotSupported
+}
+
+// Forget removes domain from the cache.
+func (r *Resolver) Forget(domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cache, normalizeHost(domain))
+}
+
+func (r *Resolver) store(domain string, p *Platform, expires time.Time) *Platform {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = make(map[string]discoveryEntry)
+	}
+	r.cache[domain] = discoveryEntry{platform: p, expires: expires}
+	return p
+}
+
+// fetchWellKnown fetches and validates .well-known/aavp. 429 is retried with
+// exponential backoff and 5xx once. It returns the last HTTP status (0 on
+// transport errors) when no valid document was obtained.
+func (r *Resolver) fetchWellKnown(ctx context.Context, domain string) (*discovery.Document, time.Duration, int) {
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	backoff := DefaultBackoff
+	serverRetried := false
+	for attempt := 1; ; attempt++ {
+		doc, ttl, status := r.getWellKnown(ctx, domain)
+		switch {
+		case doc != nil:
+			return doc, ttl, status
+		case status == http.StatusTooManyRequests && attempt < rateLimitAttempts:
+		case status >= 500 && !serverRetried:
+			serverRetried = true
+		default:
+			return nil, 0, status
+		}
+		if sleep(ctx, backoff) != nil {
+			return nil, 0, status
+		}
+		backoff *= 2
+	}
+}
+
+func (r *Resolver) getWellKnown(ctx context.Context, domain string) (*discovery.Document, time.Duration, int) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+discovery.WellKnownPath, nil)
+	if err != nil {
+		return nil, 0, 0
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, resp.StatusCode
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, 0, 0
+	}
+	doc, err := discovery.ParseDocument(data, domain)
+	if err != nil {
+		return nil, 0, resp.StatusCode
+	}
+	return doc, discoveryTTL(resp.Header), resp.StatusCode
+}
+
+func (r *Resolver) lookupTXT(ctx context.Context, domain string) *discovery.Document {
+	records, err := r.DNS.LookupTXT(ctx, discovery.TXTLabel+"."+domain)
+	if err != nil {
+		return nil
+	}
+	for _, s := range records {
+		rec, err := discovery.ParseTXT(s)
+		if err != nil {
+			continue
+		}
+		if doc, err := rec.Document(domain); err == nil {
+			return doc
+		}
+	}
+	return nil
+}
+
+// discoveryTTL returns the Cache-Control max-age capped at MaxDiscoveryTTL,
+// or DefaultDiscoveryTTL.
+func discoveryTTL(h http.Header) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+				return time.Duration(min(secs, int(MaxDiscoveryTTL/time.Second))) * time.Second
+			}
+		}
+	}
+	return DefaultDiscoveryTTL
+}
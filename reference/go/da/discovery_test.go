@@ -0,0 +1,189 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+)
+
+type fakeDNS struct {
+	records map[string][]string
+	lookups int
+}
+
+func (f *fakeDNS) LookupTXT(_ context.Context, name string) ([]string, error) {
+	f.lookups++
+	if r, ok := f.records[name]; ok {
+		return r, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+const platformDocument = `{"aavp_version":"0.11","vg_endpoint":"https://aavp.platform.example/verify","accepted_ims":[{"domain":"im.example"}],"accepted_token_types":[1]}`
+
+func newTestResolver(h http.HandlerFunc, dns *fakeDNS, now *time.Time) *Resolver {
+	r := NewResolver()
+	r.HTTPClient = handlerClient(h)
+	r.DNS = dns
+	r.Now = func() time.Time { return *now }
+	r.sleep = func(context.Context, time.Duration) error { return nil }
+	return r
+}
+
+func TestResolverWellKnownAndCache(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fetches := 0
+	r := newTestResolver(func(w http.ResponseWriter, req *http.Request) {
+		fetches++
+		if req.Host != "platform.example" || req.URL.Path != discovery.WellKnownPath {
+			t.Errorf("unexpected request %s%s", req.Host, req.URL.Path)
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write([]byte(platformDocument))
+	}, &fakeDNS{}, &now)
+
+	p, err := r.Resolve(context.Background(), "platform.example")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if p.Source != SourceWellKnown || p.Document.VGEndpoint != "https://aavp.platform.example/verify" {
+		t.Errorf("unexpected platform: %+v", p)
+	}
+	if _, ok := p.Document.FindIM("im.example"); !ok || !p.Document.AcceptsTokenType(1) {
+		t.Error("typed fields not populated")
+	}
+
+	now = now.Add(30 * time.Minute)
+	r.Resolve(context.Background(), "platform.example")
+	if fetches != 1 {
+		t.Errorf("cache not used: %d fetches", fetches)
+	}
+	now = now.Add(31 * time.Minute)
+	r.Resolve(context.Background(), "platform.example")
+	if fetches != 2 {
+		t.Errorf("expired entry not refetched: %d fetches", fetches)
+	}
+}
+
+func TestResolverDNSFallback(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dns := &fakeDNS{records: map[string][]string{
+		"_aavp.platform.example": {"unrelated=1", "v=aavp1; e=https://platform.example/aavp/verify; im=im1.example,im2.example"},
+	}}
+	r := newTestResolver(func(w http.ResponseWriter, req *http.Request) {
+		http.NotFound(w, req)
+	}, dns, &now)
+
+	p, err := r.Resolve(context.Background(), "platform.example")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if p.Source != SourceDNS || p.Document.VGEndpoint != "https://platform.example/aavp/verify" || len(p.Document.AcceptedIMs) != 2 {
+		t.Errorf("unexpected platform: %+v", p.Document)
+	}
+}
+
+func TestResolverRejectsForeignEndpoint(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dns := &fakeDNS{records: map[string][]string{
+		"_aavp.platform.example": {"v=aavp1; e=https://evil.example/verify"},
+	}}
+	r := newTestResolver(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"aavp_version":"0.11","vg_endpoint":"https://evil.example/verify","accepted_ims":[],"accepted_token_types":[1]}`))
+	}, dns, &now)
+
+	if _, err := r.Resolve(context.Background(), "platform.example"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want ErrNotSupported", err)
+	}
+}
+
+func TestResolverNegativeCache(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dns := &fakeDNS{}
+	fetches := 0
+	r := newTestResolver(func(w http.ResponseWriter, req *http.Request) {
+		fetches++
+		http.NotFound(w, req)
+	}, dns, &now)
+
+	if _, err := r.Resolve(context.Background(), "platform.example"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("got %v, want ErrNotSupported", err)
+	}
+	now = now.Add(59 * time.Minute)
+	if _, err := r.Resolve(context.Background(), "platform.example"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("got %v, want cached ErrNotSupported", err)
+	}
+	if fetches != 1 || dns.lookups != 1 {
+		t.Errorf("negative result not cached: %d fetches, %d lookups", fetches, dns.lookups)
+	}
+	now = now.Add(2 * time.Minute)
+	r.Resolve(context.Background(), "platform.example")
+	if fetches != 2 {
+		t.Error("negative result kept beyond 1 hour")
+	}
+}
+
+func TestResolverRetries(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var statuses []int
+	serve := func(w http.ResponseWriter, req *http.Request) {
+		if len(statuses) > 0 {
+			s := statuses[0]
+			statuses = statuses[1:]
+			w.WriteHeader(s)
+			return
+		}
+		w.Write([]byte(platformDocument))
+	}
+	dns := &fakeDNS{}
+	r := newTestResolver(serve, dns, &now)
+
+	// 429 is retried with backoff.
+	statuses = []int{http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if _, err := r.Resolve(context.Background(), "platform.example"); err != nil {
+		t.Fatalf("Resolve after 429: %v", err)
+	}
+
+	// 5xx is retried once; then the stale cache entry is used without DNS.
+	now = now.Add(2 * time.Hour)
+	statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+	p, err := r.Resolve(context.Background(), "platform.example")
+	if err != nil || p.Source != SourceWellKnown {
+		t.Fatalf("stale cache not used after 5xx: %v", err)
+	}
+	if dns.lookups != 0 {
+		t.Errorf("DNS consulted although a cached result was available")
+	}
+
+	// 5xx with no cache falls back to DNS.
+	r.Forget("platform.example")
+	statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+	if _, err := r.Resolve(context.Background(), "platform.example"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("got %v, want ErrNotSupported", err)
+	}
+	if dns.lookups != 1 {
+		t.Errorf("DNS not consulted after 5xx: %d lookups", dns.lookups)
+	}
+}
+
+func TestDiscoveryTTL(t *testing.T) {
+	for cc, want := range map[string]time.Duration{
+		"":                                    DefaultDiscoveryTTL,
+		"public, max-age=600":                 10 * time.Minute,
+		"max-age=abc":                         DefaultDiscoveryTTL,
+		"max-age=2147483647":                  MaxDiscoveryTTL,
+		"public, max-age=9223372036854775807": MaxDiscoveryTTL,
+	} {
+		h := http.Header{}
+		if cc != "" {
+			h.Set("Cache-Control", cc)
+		}
+		if got := discoveryTTL(h); got != want {
+			t.Errorf("discoveryTTL(%q) = %v, want %v", cc, got, want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+)
+
+// Temporal decoupling parameters (PROTOCOL.md sections 4.5.1 and 4.5.3).
+const (
+	// DecouplingWindow is the minimum time between a contact with the IM and a
+	// contact with a VG, in either order.
+	DecouplingWindow = 5 * time.Minute
+	// MaxPresentationJitter is the upper bound of the uniform delay applied
+	// before the first presentation to a VG without a session credential.
+	MaxPresentationJitter = 300 * time.Second
+	// MaxOfflineHorizon is the longest period the wallet can be stocked for.
+	// Prepare rounds expires_at down to the hour, so a token requested with the
+	// maximum TTL is only guaranteed to live MaxTTL minus one hour, and it
+	// cannot be presented until DecouplingWindow after issuance.
+	MaxOfflineHorizon = validation.MaxTTLHours*time.Hour - time.Hour - DecouplingWindow
+
+	DefaultTargetTokens   = 8
+	DefaultOfflineHorizon = 2 * time.Hour
+	DefaultCheckInterval  = 5 * time.Minute
+)
+
+// ErrDecoupling is returned by Scheduler.Refill when the IM cannot be contacted
+// without breaking the decoupling window.
+var ErrDecoupling = errors.New("da: IM contact within the decoupling window of a VG contact")
+
+// IssueFunc obtains n finalized tokens from the IM, typically with a single
+// batched request through DeviceAgent.IssueTokens. It may return fewer tokens
+// than requested together with an error.
+type IssueFunc func(ctx context.Context, n int) ([]*token.Token, error)
+
+// Scheduler keeps a Wallet stocked with pre-signed tokens and hands them out
+// for presentation while enforcing the temporal decoupling of PROTOCOL.md
+// section 4.5.1: the IM and a VG are never contacted within DecouplingWindow
+// of each other. Before the first presentation to a VG for which no session
+// credential is held, a uniform jitter of up to MaxPresentationJitter is
+// applied (section 4.5.3).
+//
+// Tokens are never obtained on demand: a presentation with an empty wallet
+// fails with ErrWalletEmpty. Refill keeps Target tokens valid Horizon ahead of
+// the clock, so that the device can go offline for up to Horizon and still
+// present tokens. It is safe for concurrent use.
+type Scheduler struct {
+	Wallet *Wallet
+	Issue  IssueFunc
+	// Target is the number of tokens to keep valid for Horizon.
+	Target int
+	// Horizon is how long stocked tokens must remain valid. It must not exceed
+	// MaxOfflineHorizon.
+	Horizon time.Duration
+	// CheckInterval is how often Run checks the wallet.
+	CheckInterval time.Duration
+	Now           func() time.Time
+	// OnError, if set, receives the errors of background refills.
+	OnError func(err error)
+
+	mu         sync.Mutex
+	lastIM     time.Time
+	lastVG     time.Time
+	refilling  bool
+	presenting int
+	sessions   map[string]time.Time // VG domain -> session credential expiry
+	sleep      func(ctx context.Context, d time.Duration) error
+	jitter     func() time.Duration
+}
+
+// NewScheduler creates a Scheduler with the default target, horizon and check
+// interval.
+func NewScheduler(w *Wallet, issue IssueFunc) *Scheduler {
+	return &Scheduler{
+		Wallet:        w,
+		Issue:         issue,
+		Target:        DefaultTargetTokens,
+		Horizon:       DefaultOfflineHorizon,
+		CheckInterval: DefaultCheckInterval,
+		Now:           time.Now,
+	}
+}
+
+// RefillDue reports whether fewer than Target tokens remain valid for Horizon.
+func (s *Scheduler) RefillDue() bool {
+	return s.Wallet.CountValidAt(s.Now().Add(s.Horizon)) < s.Target
+}
+
+// NextIMContact returns the earliest time at which the IM may be contacted.
+func (s *Scheduler) NextIMContact() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastVG.IsZero() {
+		return time.Time{}
+	}
+	return s.lastVG.Add(DecouplingWindow)
+}
+
+// Refill obtains enough tokens to bring the wallet back to Target and returns
+// how many were added. It fails with ErrDecoupling if a VG was contacted less
+// than DecouplingWindow ago or a presentation is waiting.
+func (s *Scheduler) Refill(ctx context.Context) (int, error) {
+	if s.Horizon > MaxOfflineHorizon {
+		return 0, fmt.Errorf("da: offline horizon %v exceeds %v", s.Horizon, MaxOfflineHorizon)
+	}
+	now := s.Now()
+	n := s.Target - s.Wallet.CountValidAt(now.Add(s.Horizon))
+	if n <= 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	if s.refilling {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	if s.presenting > 0 || (!s.lastVG.IsZero() && now.Before(s.lastVG.Add(DecouplingWindow))) {
+		s.mu.Unlock()
+		return 0, ErrDecoupling
+	}
+	s.refilling = true
+	s.lastIM = now
+	s.mu.Unlock()
+
+	toks, err := s.Issue(ctx, n)
+
+	s.mu.Lock()
+	s.refilling = false
+	s.lastIM = s.Now()
+	s.mu.Unlock()
+
+	if len(toks) > 0 {
+		if addErr := s.Wallet.Add(toks...); addErr != nil {
+			return 0, addErr
+		}
+	}
+	return len(toks), err
+}
+
+// Run refills the wallet in the background until ctx is done. The wallet is
+// checked every CheckInterval; a refill blocked by a recent VG contact is
+// retried as soon as the decoupling window has passed.
+func (s *Scheduler) Run(ctx context.Context) error {
+	sleep := s.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	for {
+		if _, err := s.Wallet.Evict(); err != nil {
+			s.reportError(err)
+		}
+		wait := s.CheckInterval
+		if s.RefillDue() {
+			_, err := s.Refill(ctx)
+			if errors.Is(err, ErrDecoupling) {
+				wait = min(wait, max(s.NextIMContact().Sub(s.Now()), time.Second))
+			} else if err != nil {
+				s.reportError(err)
+			}
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Scheduler) reportError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// SetSession records that a session credential for vg is held until expiresAt.
+// While it is valid, presentations to vg are not delayed by jitter.
+func (s *Scheduler) SetSession(vg string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]time.Time)
+	}
+	s.sessions[normalizeHost(vg)] = expiresAt
+}
+
+// ClearSession forgets the session credential for vg.
+func (s *Scheduler) ClearSession(vg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, normalizeHost(vg))
+}
+
+// hasSession reports whether a valid session credential for vg is held.
+// s.mu must be held.
+func (s *Scheduler) hasSession(vg string, now time.Time) bool {
+	exp, ok := s.sessions[vg]
+	if ok && !now.Before(exp) {
+		delete(s.sessions, vg)
+		return false
+	}
+	return ok
+}
+
+// Present waits as required by the decoupling window and, for a VG without a
+// valid session credential, by the presentation jitter; then it takes a token
+// from the wallet for presentation to vg. accept is passed to Wallet.Take.
+func (s *Scheduler) Present(ctx context.Context, vg string, accept func(*token.Token) bool) (*token.Token, error) {
+	vg = normalizeHost(vg)
+	sleep := s.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	jitter := s.jitter
+	if jitter == nil {
+		jitter = randomJitter
+	}
+
+	s.mu.Lock()
+	s.presenting++
+	delay := time.Duration(0)
+	if !s.hasSession(vg, s.Now()) {
+		delay = jitter()
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.presenting--
+		s.mu.Unlock()
+	}()
+
+	ready := s.Now().Add(delay)
+	for {
+		s.mu.Lock()
+		if !s.lastIM.IsZero() {
+			ready = later(ready, s.lastIM.Add(DecouplingWindow))
+		}
+		now := s.Now()
+		if !s.refilling && !now.Before(ready) {
+			s.lastVG = now
+			s.mu.Unlock()
+			break
+		}
+		s.mu.Unlock()
+		if err := sleep(ctx, max(ready.Sub(now), time.Second)); err != nil {
+			return nil, err
+		}
+	}
+	return s.Wallet.Take(accept)
+}
+
+func randomJitter() time.Duration {
+	return time.Duration(rand.Int64N(int64(MaxPresentationJitter) + 1))
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func normalizeHost(h string) string {
+	return strings.TrimSuffix(strings.ToLower(h), ".")
+}
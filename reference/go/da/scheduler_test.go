@@ -0,0 +1,170 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newTestScheduler(t *testing.T, clock *fakeClock) (*Scheduler, *[]time.Time) {
+	t.Helper()
+	w, err := OpenWallet(filepath.Join(t.TempDir(), "wallet.json"), WalletKey{raw: make([]byte, WalletKeySize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Now = clock.Now
+	var issued []time.Time
+	s := NewScheduler(w, func(_ context.Context, n int) ([]*token.Token, error) {
+		issued = append(issued, clock.now)
+		toks := make([]*token.Token, n)
+		for i := range toks {
+			toks[i] = walletToken(t, clock.now.Add(4*time.Hour).Truncate(time.Hour))
+		}
+		return toks, nil
+	})
+	s.Target = 3
+	s.Now = clock.Now
+	s.sleep = clock.sleep
+	s.jitter = func() time.Duration { return 0 }
+	return s, &issued
+}
+
+func TestSchedulerRefill(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	s, issued := newTestScheduler(t, clock)
+
+	if !s.RefillDue() {
+		t.Fatal("empty wallet not due for refill")
+	}
+	if n, err := s.Refill(context.Background()); n != 3 || err != nil {
+		t.Fatalf("Refill = %d, %v", n, err)
+	}
+	if s.RefillDue() {
+		t.Error("refill still due after refill")
+	}
+	if n, _ := s.Refill(context.Background()); n != 0 || len(*issued) != 1 {
+		t.Error("IM contacted although the wallet is stocked")
+	}
+
+	// Tokens expire at 16:00; with a 2h horizon a refill is due from 14:00.
+	clock.now = time.Date(2026, 3, 1, 13, 59, 0, 0, time.UTC)
+	if s.RefillDue() {
+		t.Error("refill due while tokens cover the offline horizon")
+	}
+	clock.now = time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	if !s.RefillDue() {
+		t.Error("refill not due when tokens no longer cover the offline horizon")
+	}
+
+	s.Horizon = MaxOfflineHorizon + time.Minute
+	if _, err := s.Refill(context.Background()); err == nil {
+		t.Error("horizon beyond the token TTL accepted")
+	}
+}
+
+func TestSchedulerDecoupling(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	s, issued := newTestScheduler(t, clock)
+	ctx := context.Background()
+
+	s.Refill(ctx)
+	refilledAt := clock.now
+
+	// A presentation right after a refill waits for the decoupling window.
+	if _, err := s.Present(ctx, "platform.example", nil); err != nil {
+		t.Fatalf("Present: %v", err)
+	}
+	if got := clock.now.Sub(refilledAt); got < DecouplingWindow {
+		t.Errorf("VG contacted %v after the IM", got)
+	}
+
+	// A refill right after a presentation is refused.
+	if _, err := s.Refill(ctx); !errors.Is(err, ErrDecoupling) {
+		t.Errorf("got %v, want ErrDecoupling", err)
+	}
+	if len(*issued) != 1 {
+		t.Error("IM contacted within the decoupling window")
+	}
+	if next := s.NextIMContact(); next != clock.now.Add(DecouplingWindow) {
+		t.Errorf("NextIMContact = %v", next)
+	}
+	clock.now = clock.now.Add(DecouplingWindow)
+	if n, err := s.Refill(ctx); n != 1 || err != nil {
+		t.Errorf("Refill after the window = %d, %v", n, err)
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	s, _ := newTestScheduler(t, clock)
+	ctx := context.Background()
+	s.Refill(ctx)
+	clock.now = clock.now.Add(time.Hour)
+
+	jitters := 0
+	s.jitter = func() time.Duration {
+		jitters++
+		return 200 * time.Second
+	}
+	start := clock.now
+	s.Present(ctx, "platform.example", nil)
+	if jitters != 1 || clock.now.Sub(start) != 200*time.Second {
+		t.Errorf("first presentation: %d jitters, waited %v", jitters, clock.now.Sub(start))
+	}
+
+	// With a valid session credential the renewal is not delayed.
+	s.SetSession("Platform.Example.", clock.now.Add(20*time.Minute))
+	start = clock.now
+	s.Present(ctx, "platform.example", nil)
+	if jitters != 1 || clock.now != start {
+		t.Error("jitter applied although a session credential is held")
+	}
+
+	// Once the credential has expired, jitter applies again.
+	clock.now = clock.now.Add(21 * time.Minute)
+	s.Present(ctx, "platform.example", nil)
+	if jitters != 2 {
+		t.Error("jitter not applied after the session credential expired")
+	}
+
+	// No token is obtained on demand.
+	if _, err := s.Present(ctx, "other.example", nil); !errors.Is(err, ErrWalletEmpty) {
+		t.Errorf("got %v, want ErrWalletEmpty", err)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)}
+	s, issued := newTestScheduler(t, clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		if clock.now.After(time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)) {
+			cancel()
+		}
+		return clock.sleep(ctx, d)
+	}
+	if err := s.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: %v", err)
+	}
+	// Tokens from 12:10 expire at 16:00 and must be replaced by 14:00; tokens
+	// from 14:00 expire at 18:00 and must be replaced by 16:00.
+	if len(*issued) != 3 {
+		t.Errorf("%d refills, want 3: %v", len(*issued), *issued)
+	}
+}
@@ -0,0 +1,145 @@
+package da
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// ErrNoCompatibleIM is returned by Select when no configured IM shares an
+// Active token_type with the platform.
+var ErrNoCompatibleIM = errors.New("da: no configured IM compatible with the platform")
+
+// SupportedTokenTypes returns the token_type values this Device Agent can
+// issue, in ascending order.
+func SupportedTokenTypes() []uint16 {
+	return []uint16{token.TokenTypeRSAPBSSASHA384}
+}
+
+func supported(tt uint16) bool {
+	for _, v := range SupportedTokenTypes() {
+		if v == tt {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenType returns the token_type stamped by Prepare.
+func (da *DeviceAgent) tokenType() (uint16, error) {
+	tt := da.TokenType
+	if tt == 0 {
+		tt = token.TokenTypeRSAPBSSASHA384
+	}
+	if !supported(tt) || !token.IsActiveType(tt) {
+		return 0, fmt.Errorf("da: cannot issue token_type 0x%04x", tt)
+	}
+	return tt, nil
+}
+
+// SelectTokenType applies PROTOCOL.md section 5.5.2 to the VG's
+// accepted_token_types and the IM's keys[].token_type: it returns the highest
+// value present in both lists that is Active in the registry. ok is false if
+// there is none.
+func SelectTokenType(vgTypes, imTypes []uint16) (tt uint16, ok bool) {
+	offered := make(map[uint16]bool, len(imTypes))
+	for _, v := range imTypes {
+		offered[v] = true
+	}
+	for _, v := range vgTypes {
+		if offered[v] && token.IsActiveType(v) && (!ok || v > tt) {
+			tt, ok = v, true
+		}
+	}
+	return tt, ok
+}
+
+// IMConfig is one IM the Device Agent may obtain tokens from, with its last
+// known .well-known/aavp-issuer document.
+type IMConfig struct {
+	Domain string
+	Issuer *im.WellKnownIssuer
+}
+
+// Selection is the IM, token_type and key chosen for a platform.
+type Selection struct {
+	IM        string
+	Issuer    *im.WellKnownIssuer
+	TokenType uint16
+	Key       *im.IssuerKey
+}
+
+// Agent returns a DeviceAgent issuing tokens of the selected type and key.
+func (s *Selection) Agent() *DeviceAgent {
+	return &DeviceAgent{
+		IMPublicKey: s.Key.PublicKey,
+		TokenKeyID:  s.Key.TokenKeyID,
+		TokenType:   s.TokenType,
+	}
+}
+
+// Select chooses the IM, token_type and key to use for platform p at now.
+//
+// IMs are tried in the order given; the first one accepted by the platform
+// whose valid keys share a token_type with accepted_token_types is used
+// (PROTOCOL.md section 5.5.2, step 4). Only keys inside their validity window,
+// allowed by the platform's token_key_ids and of a type listed in
+// SupportedTokenTypes are considered. Among the keys of the selected type, the
+// one with the latest not_before is chosen.
+//
+// A platform discovered through DNS carries no accepted_token_types; token_type
+// 0x0001 is assumed. If its record lists no IMs, any IM is tried.
+func Select(p *Platform, ims []IMConfig, now time.Time) (*Selection, error) {
+	vgTypes := p.Document.AcceptedTokenTypes
+	if p.Source == SourceDNS && len(vgTypes) == 0 {
+		vgTypes = []uint16{token.TokenTypeRSAPBSSASHA384}
+	}
+	anyIM := p.Source == SourceDNS && len(p.Document.AcceptedIMs) == 0
+
+	var errs []error
+	for _, cfg := range ims {
+		accepted, ok := p.Document.FindIM(cfg.Domain)
+		if !ok && !anyIM {
+			errs = append(errs, fmt.Errorf("%s: not accepted by the platform", cfg.Domain))
+			continue
+		}
+		if cfg.Issuer == nil {
+			errs = append(errs, fmt.Errorf("%s: no issuer document", cfg.Domain))
+			continue
+		}
+
+		var keys []*im.IssuerKey
+		var imTypes []uint16
+		for i := range cfg.Issuer.Keys {
+			k, err := cfg.Issuer.Keys[i].ParseKey()
+			if err != nil || !supported(k.TokenType) || now.Before(k.NotBefore) || !now.Before(k.NotAfter) {
+				continue
+			}
+			if accepted != nil && !accepted.AcceptsKey(k.TokenKeyID) {
+				continue
+			}
+			keys = append(keys, k)
+			imTypes = append(imTypes, k.TokenType)
+		}
+
+		tt, ok := SelectTokenType(vgTypes, imTypes)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: no common Active token_type", cfg.Domain))
+			continue
+		}
+		var best *im.IssuerKey
+		for _, k := range keys {
+			if k.TokenType == tt && (best == nil || k.NotBefore.After(best.NotBefore)) {
+				best = k
+			}
+		}
+		return &Selection{IM: cfg.Domain, Issuer: cfg.Issuer, TokenType: tt, Key: best}, nil
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoCompatibleIM
+	}
+	return nil, fmt.Errorf("%w: %w", ErrNoCompatibleIM, errors.Join(errs...))
+}
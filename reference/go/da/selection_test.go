@@ -0,0 +1,124 @@
+package da
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/internal/testkeys"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+func TestSelectTokenType(t *testing.T) {
+	// 0x0003 stands in for a newer scheme; 0x0004 for a deprecated one.
+	for _, tt := range []uint16{0x0003, 0x0004} {
+		info := token.TypeInfo{Value: tt, Scheme: "TEST", AuthenticatorSize: 64, Status: token.StatusActive}
+		if err := token.RegisterType(info); err != nil && !errors.Is(err, token.ErrTypeAlreadyRegistered) {
+			t.Fatalf("RegisterType: %v", err)
+		}
+	}
+	token.DeprecateType(0x0004)
+
+	tests := []struct {
+		vg, im []uint16
+		want   uint16
+		ok     bool
+	}{
+		{[]uint16{1}, []uint16{1}, 1, true},
+		{[]uint16{1, 3}, []uint16{3, 1}, 3, true},
+		{[]uint16{3, 1}, []uint16{1}, 1, true},
+		{[]uint16{1, 4}, []uint16{1, 4}, 1, true}, // deprecated never chosen
+		{[]uint16{4}, []uint16{4}, 0, false},
+		{[]uint16{2}, []uint16{1}, 0, false},
+		{[]uint16{0xffff}, []uint16{0xffff}, 0, false},
+		{nil, []uint16{1}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := SelectTokenType(tt.vg, tt.im)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("SelectTokenType(%v, %v): got (%d, %v), want (%d, %v)", tt.vg, tt.im, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func issuerDoc(t *testing.T, domain string, keys ...*pbrsa.PrivateKey) (*im.WellKnownIssuer, [][32]byte) {
+	t.Helper()
+	now := time.Now()
+	m := im.NewKeyManager(domain)
+	var ids [][32]byte
+	for i, sk := range keys {
+		nb := now.Add(-time.Duration(len(keys)-i) * time.Hour)
+		k, err := m.LoadKey(sk, nb, nb.Add(90*24*time.Hour), now)
+		if err != nil {
+			t.Fatalf("LoadKey: %v", err)
+		}
+		ids = append(ids, k.TokenKeyID)
+	}
+	return m.WellKnownResponse(now), ids
+}
+
+func TestSelectFallsBackToAnotherIM(t *testing.T) {
+	now := time.Now()
+	docA, _ := issuerDoc(t, "im-a.example", testkeys.VectorKey())
+	docB, idsB := issuerDoc(t, "im-b.example", testkeys.VectorKey(), testkeys.SafePrimeKey())
+	ims := []IMConfig{{Domain: "im-a.example", Issuer: docA}, {Domain: "im-b.example", Issuer: docB}}
+
+	platform := &Platform{Domain: "platform.example", Source: SourceWellKnown, Document: &discovery.Document{
+		AcceptedIMs:        []discovery.AcceptedIM{{Domain: "im-a.example"}, {Domain: "im-b.example"}},
+		AcceptedTokenTypes: []uint16{1},
+	}}
+	sel, err := Select(platform, ims, now)
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if sel.IM != "im-a.example" {
+		t.Errorf("first compatible IM not preferred: %s", sel.IM)
+	}
+
+	// The platform drops IM A: the DA falls back to IM B, using its newest key.
+	platform.Document.AcceptedIMs = platform.Document.AcceptedIMs[1:]
+	sel, err = Select(platform, ims, now)
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if sel.IM != "im-b.example" || sel.Key.TokenKeyID != idsB[1] {
+		t.Errorf("unexpected selection: %s", sel.IM)
+	}
+	agent := sel.Agent()
+	prep, err := agent.Prepare(token.AgeBracketOver18, time.Hour)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if prep.Token.TokenType != token.TokenTypeRSAPBSSASHA384 || prep.Token.TokenKeyID != idsB[1] {
+		t.Error("selected agent does not stamp the selected type and key")
+	}
+
+	// token_key_ids restrict the keys of IM B to the older one.
+	platform.Document.AcceptedIMs[0].TokenKeyIDs = []string{base64.RawURLEncoding.EncodeToString(idsB[0][:])}
+	sel, err = Select(platform, ims, now)
+	if err != nil || sel.Key.TokenKeyID != idsB[0] {
+		t.Errorf("token_key_ids not honoured: %v", err)
+	}
+
+	// No common token_type with any IM.
+	platform.Document.AcceptedTokenTypes = []uint16{2}
+	if _, err := Select(platform, ims, now); !errors.Is(err, ErrNoCompatibleIM) {
+		t.Errorf("got %v, want ErrNoCompatibleIM", err)
+	}
+}
+
+func TestSelectDNSPlatform(t *testing.T) {
+	doc, _ := issuerDoc(t, "im.example", testkeys.VectorKey())
+	platform := &Platform{Domain: "platform.example", Source: SourceDNS, Document: &discovery.Document{
+		VGEndpoint:  "https://platform.example/verify",
+		AcceptedIMs: []discovery.AcceptedIM{},
+	}}
+	sel, err := Select(platform, []IMConfig{{Domain: "im.example", Issuer: doc}}, time.Now())
+	if err != nil || sel.TokenType != token.TokenTypeRSAPBSSASHA384 {
+		t.Errorf("DNS platform without im list: %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package da
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// Wallet errors.
+var (
+	ErrWalletEmpty    = errors.New("da: no usable token in wallet")
+	ErrWalletDecrypt  = errors.New("da: wallet decryption failed (wrong key or corrupted file)")
+	ErrWalletKeyFile  = errors.New("da: wallet key file must contain 32 bytes")
+	ErrWalletKeyMatch = errors.New("da: wallet key type does not match the wallet file")
+	ErrWalletFormat   = errors.New("da: invalid wallet file")
+)
+
+// WalletKeySize is the size of a raw wallet key.
+const WalletKeySize = chacha20poly1305.KeySize
+
+// Argon2id parameters for passphrase-protected wallets (RFC 9106, section 4,
+// second recommended option).
+const (
+	walletArgonTime    = 3
+	walletArgonMemory  = 64 * 1024 // KiB
+	walletArgonThreads = 4
+	walletSaltSize     = 16
+
+	// maxWalletArgonMemory bounds the memory a wallet file can make Argon2id
+	// use: its header is only authenticated once the key is derived.
+	maxWalletArgonMemory = 1024 * 1024 // KiB
+)
+
+// WalletKey protects a wallet at rest: either a passphrase, stretched with
+// Argon2id, or 32 random bytes read from a key file.
+type WalletKey struct {
+	passphrase []byte
+	raw        []byte
+}
+
+// PassphraseKey returns a WalletKey derived from a passphrase.
+func PassphraseKey(passphrase []byte) WalletKey {
+	return WalletKey{passphrase: passphrase}
+}
+
+// ReadKeyFile returns the WalletKey stored in a key file.
+func ReadKeyFile(path string) (WalletKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return WalletKey{}, err
+	}
+	if len(raw) != WalletKeySize {
+		return WalletKey{}, ErrWalletKeyFile
+	}
+	return WalletKey{raw: raw}, nil
+}
+
+// GenerateKeyFile writes a new random wallet key to path with mode 0600.
+func GenerateKeyFile(path string) error {
+	raw := make([]byte, WalletKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// walletFile is the on-disk envelope. Everything but the header is encrypted
+// with XChaCha20-Poly1305; the header is bound as additional data.
+type walletFile struct {
+	Version    int           `json:"version"`
+	KDF        string        `json:"kdf"` // "argon2id" or "none"
+	Argon2     *argon2Params `json:"argon2,omitempty"`
+	Nonce      string        `json:"nonce"`
+	Ciphertext string        `json:"ciphertext"`
+}
+
+type argon2Params struct {
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+type walletContents struct {
+	Tokens []string `json:"tokens"` // base64url of token.Encode
+}
+
+// Wallet stores finalized, pre-signed tokens encrypted at rest (PROTOCOL.md
+// section 4.5.1). Each token is handed out at most once: Take removes it and
+// persists the wallet before returning it. Expired tokens are evicted. It is
+// safe for concurrent use, so parallel handshakes (section 7.8) never receive
+// the same token.
+type Wallet struct {
+	Now func() time.Time
+
+	mu     sync.Mutex
+	path   string
+	header walletFile // Version, KDF and Argon2 of the file
+	aead   cipher.AEAD
+	tokens []*token.Token // ordered by expires_at
+}
+
+// OpenWallet opens the wallet at path, creating an empty one if the file does
+// not exist.
+func OpenWallet(path string, key WalletKey) (*Wallet, error) {
+	w := &Wallet{Now: time.Now, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := w.init(key); err != nil {
+			return nil, err
+		}
+		return w, w.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := w.load(data, key); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Wallet) init(key WalletKey) error {
+	w.header = walletFile{Version: 1, KDF: "none"}
+	if key.raw == nil {
+		salt := make([]byte, walletSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		w.header.KDF = "argon2id"
+		w.header.Argon2 = &argon2Params{
+			Salt:    base64.RawURLEncoding.EncodeToString(salt),
+			Time:    walletArgonTime,
+			Memory:  walletArgonMemory,
+			Threads: walletArgonThreads,
+		}
+	}
+	return w.deriveAEAD(key)
+}
+
+func (w *Wallet) deriveAEAD(key WalletKey) error {
+	raw := key.raw
+	switch {
+	case w.header.KDF == "argon2id" && key.raw == nil && w.header.Argon2 != nil:
+		p := w.header.Argon2
+		salt, err := base64.RawURLEncoding.DecodeString(p.Salt)
+		if err != nil {
+			return fmt.Errorf("da: invalid wallet salt: %w", err)
+		}
+		raw = argon2.IDKey(key.passphrase, salt, p.Time, p.Memory, p.Threads, WalletKeySize)
+	case w.header.KDF == "none" && key.raw != nil:
+	default:
+		return ErrWalletKeyMatch
+	}
+	aead, err := chacha20poly1305.NewX(raw)
+	if err != nil {
+		return err
+	}
+	w.aead = aead
+	return nil
+}
+
+func (w *Wallet) additionalData() []byte {
+	h := w.header
+	h.Nonce, h.Ciphertext = "", ""
+	ad, _ := json.Marshal(&h)
+	return ad
+}
+
+func (w *Wallet) load(data []byte, key WalletKey) error {
+	if err := json.Unmarshal(data, &w.header); err != nil {
+		return fmt.Errorf("%w: %v", ErrWalletFormat, err)
+	}
+	if w.header.Version != 1 {
+		return fmt.Errorf("%w: unsupported version %d", ErrWalletFormat, w.header.Version)
+	}
+	if p := w.header.Argon2; p != nil && (p.Time < 1 || p.Threads < 1 || p.Memory > maxWalletArgonMemory) {
+		return fmt.Errorf("%w: argon2 parameters out of range", ErrWalletFormat)
+	}
+	if err := w.deriveAEAD(key); err != nil {
+		return err
+	}
+	nonce, err1 := base64.RawURLEncoding.DecodeString(w.header.Nonce)
+	ct, err2 := base64.RawURLEncoding.DecodeString(w.header.Ciphertext)
+	if err1 != nil || err2 != nil || len(nonce) != w.aead.NonceSize() {
+		return ErrWalletDecrypt
+	}
+	plain, err := w.aead.Open(nil, nonce, ct, w.additionalData())
+	if err != nil {
+		return ErrWalletDecrypt
+	}
+	var c walletContents
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return ErrWalletDecrypt
+	}
+	for _, s := range c.Tokens {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return ErrWalletDecrypt
+		}
+		tok, err := token.Decode(b)
+		if err != nil {
+			return fmt.Errorf("da: invalid token in wallet: %w", err)
+		}
+		w.tokens = append(w.tokens, tok)
+	}
+	w.sort()
+	return nil
+}
+
+// save encrypts the current tokens with a fresh nonce and atomically replaces
+// the wallet file. w.mu must be held (or w not yet shared).
+func (w *Wallet) save() error {
+	c := walletContents{Tokens: make([]string, 0, len(w.tokens))}
+	for _, tok := range w.tokens {
+		c.Tokens = append(c.Tokens, base64.RawURLEncoding.EncodeToString(token.Encode(tok)))
+	}
+	plain, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ct := w.aead.Seal(nil, nonce, plain, w.additionalData())
+
+	out := w.header
+	out.Nonce = base64.RawURLEncoding.EncodeToString(nonce)
+	out.Ciphertext = base64.RawURLEncoding.EncodeToString(ct)
+	data, err := json.Marshal(&out)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), ".wallet-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.path)
+}
+
+func (w *Wallet) sort() {
+	sort.SliceStable(w.tokens, func(i, j int) bool { return w.tokens[i].ExpiresAt < w.tokens[j].ExpiresAt })
+}
+
+// evict drops tokens whose expires_at has passed. w.mu must be held.
+func (w *Wallet) evict(now time.Time) int {
+	kept := w.tokens[:0]
+	for _, tok := range w.tokens {
+		if int64(tok.ExpiresAt) > now.Unix() {
+			kept = append(kept, tok)
+		}
+	}
+	n := len(w.tokens) - len(kept)
+	w.tokens = kept
+	return n
+}
+
+// Add stores finalized tokens.
+func (w *Wallet) Add(toks ...*token.Token) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.evict(w.Now())
+	for _, tok := range toks {
+		if len(tok.Authenticator) == 0 {
+			return errors.New("da: token has no authenticator")
+		}
+		w.tokens = append(w.tokens, tok)
+	}
+	w.sort()
+	return w.save()
+}
+
+// Take removes and returns the usable token that expires first. If accept is
+// not nil, only tokens for which it returns true are considered (for example
+// tokens whose token_key_id the platform accepts). The wallet is persisted
+// before the token is returned, so a token is never handed out twice.
+func (w *Wallet) Take(accept func(*token.Token) bool) (*token.Token, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	evicted := w.evict(w.Now()) > 0
+	for i, tok := range w.tokens {
+		if accept != nil && !accept(tok) {
+			continue
+		}
+		w.tokens = append(w.tokens[:i], w.tokens[i+1:]...)
+		if err := w.save(); err != nil {
+			w.tokens = append(w.tokens, tok)
+			w.sort()
+			return nil, err
+		}
+		return tok, nil
+	}
+	if evicted {
+		if err := w.save(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrWalletEmpty
+}
+
+// Evict removes expired tokens and returns how many were removed.
+func (w *Wallet) Evict() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := w.evict(w.Now())
+	if n == 0 {
+		return 0, nil
+	}
+	return n, w.save()
+}
+
+// CountValidAt returns the number of stored tokens whose expires_at is after t.
+func (w *Wallet) CountValidAt(t time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, tok := range w.tokens {
+		if int64(tok.ExpiresAt) > t.Unix() {
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of stored tokens, including expired ones not yet evicted.
+func (w *Wallet) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.tokens)
+}
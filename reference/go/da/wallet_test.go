@@ -0,0 +1,195 @@
+package da
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+func walletToken(t *testing.T, expiresAt time.Time) *token.Token {
+	t.Helper()
+	tok := &token.Token{
+		TokenType:     token.TokenTypeRSAPBSSASHA384,
+		AgeBracket:    token.AgeBracketOver18,
+		ExpiresAt:     uint64(expiresAt.Unix()),
+		Authenticator: make([]byte, token.SizeAuthenticator),
+	}
+	rand.Read(tok.Nonce[:])
+	rand.Read(tok.Authenticator)
+	return tok
+}
+
+func TestWalletPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	w, err := OpenWallet(path, PassphraseKey([]byte("correct horse")))
+	if err != nil {
+		t.Fatalf("OpenWallet: %v", err)
+	}
+	w.Now = func() time.Time { return now }
+	tok := walletToken(t, now.Add(3*time.Hour))
+	if err := w.Add(tok); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, tok.Authenticator) || bytes.Contains(data, tok.Nonce[:]) {
+		t.Error("token material stored in the clear")
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Errorf("wallet mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	if _, err := OpenWallet(path, PassphraseKey([]byte("wrong"))); !errors.Is(err, ErrWalletDecrypt) {
+		t.Errorf("wrong passphrase: got %v, want ErrWalletDecrypt", err)
+	}
+	w2, err := OpenWallet(path, PassphraseKey([]byte("correct horse")))
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	w2.Now = w.Now
+	got, err := w2.Take(nil)
+	if err != nil || !bytes.Equal(token.Encode(got), token.Encode(tok)) {
+		t.Fatalf("Take after reopen: %v", err)
+	}
+	w3, _ := OpenWallet(path, PassphraseKey([]byte("correct horse")))
+	if w3.Len() != 0 {
+		t.Error("taken token persisted")
+	}
+}
+
+func TestWalletTamperedArgon2(t *testing.T) {
+	// The header is checked before the key is derived: out-of-range
+	// parameters are rejected instead of crashing or exhausting memory.
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	key := PassphraseKey([]byte("correct horse"))
+	if _, err := OpenWallet(path, key); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, tampered := range []string{`"time":0`, `"threads":0`, `"memory":4294967295`} {
+		field, _, _ := strings.Cut(tampered, ":")
+		re := regexp.MustCompile(field + `:\d+`)
+		if !re.Match(data) {
+			t.Fatalf("no %s in wallet file", field)
+		}
+		if err := os.WriteFile(path, re.ReplaceAll(data, []byte(tampered)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenWallet(path, key); !errors.Is(err, ErrWalletFormat) {
+			t.Errorf("%s: OpenWallet = %v, want ErrWalletFormat", tampered, err)
+		}
+	}
+}
+
+func TestWalletKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "wallet.key")
+	if err := GenerateKeyFile(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadKeyFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "wallet.json")
+	w, err := OpenWallet(path, key)
+	if err != nil {
+		t.Fatalf("OpenWallet: %v", err)
+	}
+	if err := w.Add(walletToken(t, time.Now().Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWallet(path, PassphraseKey([]byte("x"))); !errors.Is(err, ErrWalletKeyMatch) {
+		t.Errorf("got %v, want ErrWalletKeyMatch", err)
+	}
+	GenerateKeyFile(keyPath)
+	other, _ := ReadKeyFile(keyPath)
+	if _, err := OpenWallet(path, other); !errors.Is(err, ErrWalletDecrypt) {
+		t.Errorf("got %v, want ErrWalletDecrypt", err)
+	}
+}
+
+func TestWalletConcurrentTake(t *testing.T) {
+	key := WalletKey{raw: make([]byte, WalletKeySize)}
+	w, err := OpenWallet(filepath.Join(t.TempDir(), "wallet.json"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	const n = 8
+	for i := range n {
+		w.Add(walletToken(t, now.Add(time.Duration(i+1)*time.Minute)))
+	}
+
+	var mu sync.Mutex
+	seen := map[[token.SizeNonce]byte]bool{}
+	var wg sync.WaitGroup
+	for range n + 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := w.Take(nil)
+			if errors.Is(err, ErrWalletEmpty) {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[tok.Nonce] {
+				t.Error("token handed out twice")
+			}
+			seen[tok.Nonce] = true
+		}()
+	}
+	wg.Wait()
+	if len(seen) != n {
+		t.Errorf("%d distinct tokens taken, want %d", len(seen), n)
+	}
+}
+
+func TestWalletEviction(t *testing.T) {
+	key := WalletKey{raw: make([]byte, WalletKeySize)}
+	w, _ := OpenWallet(filepath.Join(t.TempDir(), "wallet.json"), key)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	w.Now = func() time.Time { return now }
+
+	soon := walletToken(t, now.Add(10*time.Minute))
+	later := walletToken(t, now.Add(3*time.Hour))
+	w.Add(later, soon)
+	if w.CountValidAt(now.Add(time.Hour)) != 1 {
+		t.Error("CountValidAt")
+	}
+
+	// The token expiring first is used first.
+	if tok, _ := w.Take(nil); tok.Nonce != soon.Nonce {
+		t.Error("Take did not return the earliest-expiring token")
+	}
+	w.Add(walletToken(t, now.Add(10*time.Minute)))
+	now = now.Add(10 * time.Minute)
+	if n, err := w.Evict(); n != 1 || err != nil {
+		t.Errorf("Evict = %d, %v", n, err)
+	}
+
+	// accept filters tokens, e.g. by token_key_id.
+	if _, err := w.Take(func(*token.Token) bool { return false }); !errors.Is(err, ErrWalletEmpty) {
+		t.Errorf("got %v, want ErrWalletEmpty", err)
+	}
+	now = now.Add(3 * time.Hour)
+	if _, err := w.Take(nil); !errors.Is(err, ErrWalletEmpty) || w.Len() != 0 {
+		t.Errorf("expired token not evicted: %v", err)
+	}
+}
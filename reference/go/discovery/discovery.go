@@ -0,0 +1,252 @@
+// Package discovery implements the platform discovery formats of PROTOCOL.md
+// section 5.3: the .well-known/aavp document published by a Verification Gate
+// and the _aavp DNS TXT record.
+package discovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+const (
+	// WellKnownPath is the path of the VG discovery document.
+	WellKnownPath = "/.well-known/aavp"
+	// TXTLabel is prepended to the platform domain for the DNS record.
+	TXTLabel = "_aavp"
+	// TXTVersion is the fixed value of the v key of the DNS record.
+	TXTVersion = "aavp1"
+	// ProtocolVersion is the aavp_version implemented by this package.
+	ProtocolVersion = "0.11"
+)
+
+// Discovery errors.
+var (
+	ErrInvalidDocument     = errors.New("discovery: invalid .well-known/aavp document")
+	ErrIncompatibleVersion = errors.New("discovery: incompatible aavp_version")
+	ErrInvalidTXT          = errors.New("discovery: invalid _aavp TXT record")
+)
+
+// Document is the .well-known/aavp response (PROTOCOL.md section 5.3.1).
+type Document struct {
+	AAVPVersion        string       `json:"aavp_version"`
+	VGEndpoint         string       `json:"vg_endpoint"`
+	AcceptedIMs        []AcceptedIM `json:"accepted_ims"`
+	AcceptedTokenTypes []uint16     `json:"accepted_token_types"`
+	AgePolicy          string       `json:"age_policy,omitempty"`
+}
+
+// AcceptedIM is one entry of accepted_ims. An empty TokenKeyIDs accepts every
+// active key of the IM.
+type AcceptedIM struct {
+	Domain      string   `json:"domain"`
+	TokenKeyIDs []string `json:"token_key_ids,omitempty"`
+}
+
+// ParseDocument decodes a .well-known/aavp document served by host and
+// checks it with Validate.
+func ParseDocument(data []byte, host string) (*Document, error) {
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if err := d.Validate(host); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Validate checks the required fields, aavp_version compatibility, that
+// vg_endpoint is an HTTPS URI on host or a subdomain of it, and the encoding
+// of token_key_ids.
+func (d *Document) Validate(host string) error {
+	if d.AAVPVersion == "" || d.VGEndpoint == "" || d.AcceptedIMs == nil || d.AcceptedTokenTypes == nil {
+		return fmt.Errorf("%w: missing required field", ErrInvalidDocument)
+	}
+	if !CompatibleVersion(d.AAVPVersion) {
+		return fmt.Errorf("%w: %q", ErrIncompatibleVersion, d.AAVPVersion)
+	}
+	if err := checkEndpoint(d.VGEndpoint, host); err != nil {
+		return err
+	}
+	for _, im := range d.AcceptedIMs {
+		if im.Domain == "" {
+			return fmt.Errorf("%w: accepted_ims entry without domain", ErrInvalidDocument)
+		}
+		if _, err := im.KeyIDs(); err != nil {
+			return err
+		}
+	}
+	if d.AgePolicy != "" {
+		u, err := url.Parse(d.AgePolicy)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%w: age_policy is not an HTTPS URI", ErrInvalidDocument)
+		}
+	}
+	return nil
+}
+
+// KeyIDs decodes the token_key_ids of the entry.
+func (im *AcceptedIM) KeyIDs() ([][32]byte, error) {
+	out := make([][32]byte, 0, len(im.TokenKeyIDs))
+	for _, s := range im.TokenKeyIDs {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) != token.SizeTokenKeyID {
+			return nil, fmt.Errorf("%w: invalid token_key_id %q", ErrInvalidDocument, s)
+		}
+		var kid [32]byte
+		copy(kid[:], b)
+		out = append(out, kid)
+	}
+	return out, nil
+}
+
+// AcceptsKey returns true if the entry accepts tokenKeyID.
+func (im *AcceptedIM) AcceptsKey(tokenKeyID [32]byte) bool {
+	if len(im.TokenKeyIDs) == 0 {
+		return true
+	}
+	want := base64.RawURLEncoding.EncodeToString(tokenKeyID[:])
+	for _, s := range im.TokenKeyIDs {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// FindIM returns the accepted_ims entry for domain.
+func (d *Document) FindIM(domain string) (*AcceptedIM, bool) {
+	for i := range d.AcceptedIMs {
+		if strings.EqualFold(d.AcceptedIMs[i].Domain, domain) {
+			return &d.AcceptedIMs[i], true
+		}
+	}
+	return nil, false
+}
+
+// AcceptsTokenType returns true if tt is listed in accepted_token_types.
+func (d *Document) AcceptsTokenType(tt uint16) bool {
+	for _, v := range d.AcceptedTokenTypes {
+		if v == tt {
+			return true
+		}
+	}
+	return false
+}
+
+// CompatibleVersion returns true if v has the form MAJOR.MINOR with the same
+// MAJOR as ProtocolVersion.
+func CompatibleVersion(v string) bool {
+	major, minor, ok := strings.Cut(v, ".")
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseUint(minor, 10, 16); err != nil {
+		return false
+	}
+	ours, _, _ := strings.Cut(ProtocolVersion, ".")
+	return major == ours
+}
+
+// SameOrSubdomain returns true if host is domain or a subdomain of it.
+func SameOrSubdomain(host, domain string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+func checkEndpoint(endpoint, host string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || !SameOrSubdomain(u.Hostname(), host) {
+		return fmt.Errorf("%w: vg_endpoint %q is not an HTTPS URI under %s", ErrInvalidDocument, endpoint, host)
+	}
+	return nil
+}
+
+// TXTRecord is the content of an _aavp TXT record (PROTOCOL.md section 5.3.2).
+type TXTRecord struct {
+	Endpoint string   // e: handshake endpoint, equivalent to vg_endpoint
+	IMs      []string // im: accepted IM domains, optional
+}
+
+// ParseTXT parses a record of the form "v=aavp1; e=https://...; im=a,b".
+// The v key must be the first non-empty segment; unknown keys are ignored.
+func ParseTXT(s string) (*TXTRecord, error) {
+	var r TXTRecord
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTXT, part)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidTXT, key)
+		}
+		// v must be the first key, and is checked wherever it appears.
+		if first := len(seen) == 0; first != (key == "v") || (key == "v" && value != TXTVersion) {
+			return nil, fmt.Errorf("%w: missing v=%s", ErrInvalidTXT, TXTVersion)
+		}
+		seen[key] = true
+		switch key {
+		case "e":
+			r.Endpoint = value
+		case "im":
+			for _, d := range strings.Split(value, ",") {
+				if d = strings.TrimSpace(d); d != "" {
+					r.IMs = append(r.IMs, d)
+				}
+			}
+		}
+	}
+	if !seen["v"] {
+		return nil, fmt.Errorf("%w: missing v=%s", ErrInvalidTXT, TXTVersion)
+	}
+	if r.Endpoint == "" {
+		return nil, fmt.Errorf("%w: missing e", ErrInvalidTXT)
+	}
+	return &r, nil
+}
+
+// String formats the record as published in DNS.
+func (r *TXTRecord) String() string {
+	s := "v=" + TXTVersion + "; e=" + r.Endpoint
+	if len(r.IMs) > 0 {
+		s += "; im=" + strings.Join(r.IMs, ",")
+	}
+	return s
+}
+
+// TXTRecord returns the _aavp TXT record equivalent to the document: its
+// vg_endpoint and the domains of accepted_ims.
+func (d *Document) TXTRecord() *TXTRecord {
+	r := &TXTRecord{Endpoint: d.VGEndpoint}
+	for _, im := range d.AcceptedIMs {
+		r.IMs = append(r.IMs, im.Domain)
+	}
+	return r
+}
+
+// Document converts the record into a partial Document for host. The record
+// carries no aavp_version or accepted_token_types, so those are left empty.
+func (r *TXTRecord) Document(host string) (*Document, error) {
+	if err := checkEndpoint(r.Endpoint, host); err != nil {
+		return nil, err
+	}
+	d := &Document{VGEndpoint: r.Endpoint, AcceptedIMs: []AcceptedIM{}}
+	for _, im := range r.IMs {
+		d.AcceptedIMs = append(d.AcceptedIMs, AcceptedIM{Domain: im})
+	}
+	return d, nil
+}
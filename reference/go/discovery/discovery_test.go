@@ -0,0 +1,139 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+)
+
+const exampleDocument = `{
+  "aavp_version": "0.11",
+  "vg_endpoint": "https://platform.example/aavp/verify",
+  "accepted_ims": [
+    {
+      "domain": "qustodio.com",
+      "token_key_ids": ["__6pup76c1CAzxr3NGJZlO0FbBxPlKjYL0Z2oBerLHw"]
+    },
+    {
+      "domain": "familylink.google.com"
+    }
+  ],
+  "accepted_token_types": [1],
+  "age_policy": "https://platform.example/.well-known/aavp-age-policy.json"
+}`
+
+func TestParseDocument(t *testing.T) {
+	d, err := ParseDocument([]byte(exampleDocument), "platform.example")
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	if len(d.AcceptedIMs) != 2 || !d.AcceptsTokenType(1) || d.AcceptsTokenType(2) {
+		t.Errorf("unexpected document: %+v", d)
+	}
+	im, ok := d.FindIM("QUSTODIO.com")
+	if !ok {
+		t.Fatal("FindIM: qustodio.com not found")
+	}
+	kids, err := im.KeyIDs()
+	if err != nil || len(kids) != 1 {
+		t.Fatalf("KeyIDs: %v", err)
+	}
+	if !im.AcceptsKey(kids[0]) || im.AcceptsKey([32]byte{}) {
+		t.Error("AcceptsKey mismatch for restricted IM")
+	}
+	all, _ := d.FindIM("familylink.google.com")
+	if !all.AcceptsKey([32]byte{}) {
+		t.Error("IM without token_key_ids should accept every key")
+	}
+
+	// vg_endpoint on a subdomain is accepted.
+	if _, err := ParseDocument([]byte(exampleDocument), "example"); err != nil {
+		t.Errorf("subdomain vg_endpoint rejected: %v", err)
+	}
+}
+
+func TestParseDocumentRejects(t *testing.T) {
+	tests := []struct {
+		name, doc, host string
+		want            error
+	}{
+		{"other domain", exampleDocument, "evil.example", ErrInvalidDocument},
+		{"suffix without dot", exampleDocument, "form.example", ErrInvalidDocument},
+		{"http endpoint", `{"aavp_version":"0.11","vg_endpoint":"http://p.example/v","accepted_ims":[],"accepted_token_types":[1]}`, "p.example", ErrInvalidDocument},
+		{"missing accepted_token_types", `{"aavp_version":"0.11","vg_endpoint":"https://p.example/v","accepted_ims":[]}`, "p.example", ErrInvalidDocument},
+		{"major version", `{"aavp_version":"1.0","vg_endpoint":"https://p.example/v","accepted_ims":[],"accepted_token_types":[1]}`, "p.example", ErrIncompatibleVersion},
+		{"malformed version", `{"aavp_version":"0","vg_endpoint":"https://p.example/v","accepted_ims":[],"accepted_token_types":[1]}`, "p.example", ErrIncompatibleVersion},
+		{"bad token_key_id", `{"aavp_version":"0.11","vg_endpoint":"https://p.example/v","accepted_ims":[{"domain":"im.example","token_key_ids":["AAAA"]}],"accepted_token_types":[1]}`, "p.example", ErrInvalidDocument},
+		{"http age_policy", `{"aavp_version":"0.11","vg_endpoint":"https://p.example/v","accepted_ims":[],"accepted_token_types":[1],"age_policy":"http://p.example/spd"}`, "p.example", ErrInvalidDocument},
+	}
+	for _, tt := range tests {
+		if _, err := ParseDocument([]byte(tt.doc), tt.host); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCompatibleVersion(t *testing.T) {
+	for v, want := range map[string]bool{"0.11": true, "0.12": true, "0.9": true, "1.0": false, "0": false, "0.x": false, "": false} {
+		if got := CompatibleVersion(v); got != want {
+			t.Errorf("CompatibleVersion(%q): got %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	r, err := ParseTXT("v=aavp1; e=https://platform.example/aavp/verify; im=im1.example,im2.example")
+	if err != nil {
+		t.Fatalf("ParseTXT: %v", err)
+	}
+	if r.Endpoint != "https://platform.example/aavp/verify" || len(r.IMs) != 2 || r.IMs[1] != "im2.example" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if got := r.String(); got != "v=aavp1; e=https://platform.example/aavp/verify; im=im1.example,im2.example" {
+		t.Errorf("String: got %q", got)
+	}
+
+	noIM, err := ParseTXT("; v=aavp1;e=https://platform.example/v;x=ignored")
+	if err != nil || len(noIM.IMs) != 0 {
+		t.Errorf("record without im: %+v, %v", noIM, err)
+	}
+	d, err := noIM.Document("platform.example")
+	if err != nil || d.VGEndpoint != noIM.Endpoint {
+		t.Errorf("Document: %v", err)
+	}
+	if _, err := noIM.Document("other.example"); err == nil {
+		t.Error("Document: expected error for endpoint on another domain")
+	}
+
+	for _, s := range []string{
+		"",
+		"e=https://p.example/v; v=aavp1",
+		"v=aavp2; e=https://p.example/v",
+		"; v=aavp2; e=https://p.example/v",
+		" ;; e=https://p.example/v; v=aavp1",
+		"v=aavp1",
+		"v=aavp1; e=https://p.example/v; e=https://q.example/v",
+		"v=aavp1; garbage",
+	} {
+		if _, err := ParseTXT(s); !errors.Is(err, ErrInvalidTXT) {
+			t.Errorf("ParseTXT(%q): got %v", s, err)
+		}
+	}
+}
+
+func TestDocumentTXTRecord(t *testing.T) {
+	d, err := ParseDocument([]byte(exampleDocument), "platform.example")
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	const want = "v=aavp1; e=https://platform.example/aavp/verify; im=qustodio.com,familylink.google.com"
+	if got := d.TXTRecord().String(); got != want {
+		t.Errorf("TXTRecord: got %q, want %q", got, want)
+	}
+	r, err := ParseTXT(want)
+	if err != nil {
+		t.Fatalf("ParseTXT: %v", err)
+	}
+	if back, err := r.Document("platform.example"); err != nil || back.VGEndpoint != d.VGEndpoint || len(back.AcceptedIMs) != 2 {
+		t.Errorf("Document: %+v, %v", back, err)
+	}
+}
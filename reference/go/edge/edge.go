@@ -0,0 +1,131 @@
+// Package edge verifies VG session credentials on CDN and edge nodes without
+// contacting the origin (PROTOCOL.md section 7.9).
+//
+// It depends only on the standard library so that it can be vendored into
+// edge workers on its own. It understands the credential format of package
+// session for Ed25519 keys, which are distributed to the nodes as a keyset
+// signed by the VG distribution key (see SignedKeyset).
+package edge
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Credential layout, mirroring package session.
+const (
+	KeyIDSize = 8
+
+	credentialVersion = 0x01
+	algEd25519        = 0x01
+	headerSize        = 1 + 1 + KeyIDSize + 1 + 8
+)
+
+// Credential errors.
+var (
+	ErrMalformed    = errors.New("edge: malformed credential")
+	ErrUnknownKey   = errors.New("edge: unknown or invalid key")
+	ErrBadSignature = errors.New("edge: invalid vg_signature")
+	ErrExpired      = errors.New("edge: credential expired")
+	ErrNoKeyset     = errors.New("edge: no keyset loaded")
+)
+
+// bracketNames maps age_bracket values to their names, as token.AgeBracketName.
+var bracketNames = [...]string{"UNDER_13", "AGE_13_15", "AGE_16_17", "OVER_18"}
+
+// BracketName returns the name of an age_bracket value, or "" if it is not
+// defined.
+func BracketName(b uint8) string {
+	if int(b) < len(bracketNames) {
+		return bracketNames[b]
+	}
+	return ""
+}
+
+// Credential is a verified session credential.
+type Credential struct {
+	AgeBracket uint8
+	ExpiresAt  time.Time
+}
+
+// Bracket returns the name of the credential's age_bracket.
+func (c *Credential) Bracket() string { return BracketName(c.AgeBracket) }
+
+// Verifier checks session credentials against the keyset most recently loaded
+// with Update. It is safe for concurrent use.
+type Verifier struct {
+	DistributionKey ed25519.PublicKey
+
+	keyset atomic.Pointer[Keyset]
+}
+
+// NewVerifier creates a Verifier accepting keysets signed by distributionKey.
+func NewVerifier(distributionKey ed25519.PublicKey) *Verifier {
+	return &Verifier{DistributionKey: distributionKey}
+}
+
+// Update replaces the keyset with a SignedKeyset. A keyset issued before the
+// one in use is rejected with ErrStaleKeyset, so an old keyset cannot be
+// replayed to bring back a retired key.
+func (v *Verifier) Update(data []byte) error {
+	ks, err := ParseKeyset(data, v.DistributionKey)
+	if err != nil {
+		return err
+	}
+	for {
+		cur := v.keyset.Load()
+		if cur != nil && ks.IssuedAt.Before(cur.IssuedAt) {
+			return ErrStaleKeyset
+		}
+		if v.keyset.CompareAndSwap(cur, ks) {
+			return nil
+		}
+	}
+}
+
+// Keyset returns the keyset in use, or nil.
+func (v *Verifier) Keyset() *Keyset {
+	return v.keyset.Load()
+}
+
+// Verify decodes a credential and checks vg_signature and
+// session_expires_at.
+func (v *Verifier) Verify(encoded string, now time.Time) (*Credential, error) {
+	ks := v.keyset.Load()
+	if ks == nil {
+		return nil, ErrNoKeyset
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(b) < headerSize || b[0] != credentialVersion {
+		return nil, ErrMalformed
+	}
+	// HMAC credentials cannot be checked at the edge.
+	if b[1] != algEd25519 {
+		return nil, ErrUnknownKey
+	}
+	if len(b) != headerSize+ed25519.SignatureSize {
+		return nil, ErrMalformed
+	}
+	key, ok := ks.lookup(b[2:2+KeyIDSize], now)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !ed25519.Verify(key.PublicKey, b[:headerSize], b[headerSize:]) {
+		return nil, ErrBadSignature
+	}
+	cred := &Credential{
+		AgeBracket: b[2+KeyIDSize],
+		ExpiresAt:  time.Unix(int64(binary.BigEndian.Uint64(b[3+KeyIDSize:])), 0).UTC(),
+	}
+	if BracketName(cred.AgeBracket) == "" {
+		return nil, ErrMalformed
+	}
+	if !now.Before(cred.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return cred, nil
+}
@@ -0,0 +1,127 @@
+package edge
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// credential builds a session credential as package session does.
+func credential(priv ed25519.PrivateKey, bracket uint8, expiresAt time.Time) string {
+	id := KeyID(priv.Public().(ed25519.PublicKey))
+	b := []byte{credentialVersion, algEd25519}
+	b = append(b, id[:]...)
+	b = append(b, bracket)
+	b = binary.BigEndian.AppendUint64(b, uint64(expiresAt.Unix()))
+	b = append(b, ed25519.Sign(priv, b)...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signedKeyset(t *testing.T, dist ed25519.PrivateKey, issuedAt time.Time, keys ...KeyEntry) []byte {
+	t.Helper()
+	data, err := SignKeyset(&KeysetDocument{Version: KeysetVersion, IssuedAt: issuedAt.Format(time.RFC3339), Keys: keys}, dist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifier(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	distPub, dist, _ := ed25519.GenerateKey(rand.Reader)
+	pub1, key1, _ := ed25519.GenerateKey(rand.Reader)
+	pub2, key2, _ := ed25519.GenerateKey(rand.Reader)
+
+	v := NewVerifier(distPub)
+	if _, err := v.Verify(credential(key1, 1, now.Add(time.Minute)), now); !errors.Is(err, ErrNoKeyset) {
+		t.Errorf("got %v, want ErrNoKeyset", err)
+	}
+	first := signedKeyset(t, dist, now, NewKeyEntry(pub1, now.Add(-time.Hour), now.Add(time.Hour)))
+	if err := v.Update(first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	c, err := v.Verify(credential(key1, 1, now.Add(20*time.Minute)), now)
+	if err != nil || c.Bracket() != "AGE_13_15" {
+		t.Fatalf("Verify: %+v, %v", c, err)
+	}
+	if _, err := v.Verify(credential(key1, 1, now), now); !errors.Is(err, ErrExpired) {
+		t.Errorf("got %v, want ErrExpired", err)
+	}
+	if _, err := v.Verify(credential(key2, 1, now.Add(time.Minute)), now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v, want ErrUnknownKey", err)
+	}
+	if _, err := v.Verify(credential(key1, 1, now.Add(time.Minute)), now.Add(2*time.Hour)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("key outside validity: got %v", err)
+	}
+	forged := credential(key2, 3, now.Add(time.Minute))
+	raw, _ := base64.RawURLEncoding.DecodeString(forged)
+	id := KeyID(pub1)
+	copy(raw[2:], id[:])
+	if _, err := v.Verify(base64.RawURLEncoding.EncodeToString(raw), now); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("got %v, want ErrBadSignature", err)
+	}
+
+	// Rotation: a newer keyset adds key2; replaying the old one is refused.
+	second := signedKeyset(t, dist, now.Add(time.Minute),
+		NewKeyEntry(pub1, now.Add(-time.Hour), now.Add(time.Hour)),
+		NewKeyEntry(pub2, now, now.Add(48*time.Hour)))
+	if err := v.Update(second); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := v.Verify(credential(key2, 3, now.Add(time.Minute)), now); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+	if err := v.Update(first); !errors.Is(err, ErrStaleKeyset) {
+		t.Errorf("got %v, want ErrStaleKeyset", err)
+	}
+}
+
+func TestParseKeysetRejects(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	distPub, dist, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	pub2, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	if _, err := ParseKeyset(signedKeyset(t, other, now, NewKeyEntry(pub, now, now.Add(time.Hour))), distPub); !errors.Is(err, ErrKeysetSignature) {
+		t.Errorf("foreign signer: got %v", err)
+	}
+	mismatched := NewKeyEntry(pub, now, now.Add(time.Hour))
+	mismatched.PublicKey = NewKeyEntry(pub2, now, now.Add(time.Hour)).PublicKey
+	inverted := NewKeyEntry(pub, now.Add(time.Hour), now)
+	for name, e := range map[string]KeyEntry{"key_id mismatch": mismatched, "inverted window": inverted} {
+		if _, err := ParseKeyset(signedKeyset(t, dist, now, e), distPub); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	h := Vary(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		AddVary(w.Header())
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Values("Vary"); len(got) != 2 || got[0] != BracketHeader {
+		t.Errorf("Vary = %q", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(BracketHeader, "OVER_18")
+	SetBracket(r, nil)
+	if r.Header.Get(BracketHeader) != "" {
+		t.Error("client-supplied bracket header forwarded")
+	}
+	SetBracket(r, &Credential{AgeBracket: 0})
+	if r.Header.Get(BracketHeader) != "UNDER_13" {
+		t.Errorf("bracket header = %q", r.Header.Get(BracketHeader))
+	}
+}
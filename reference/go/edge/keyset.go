@@ -0,0 +1,166 @@
+package edge
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KeysetVersion is the version of the keyset distribution format.
+const KeysetVersion = 1
+
+// AlgEd25519 is the only algorithm distributed to edge nodes. HMAC secrets
+// are never exported.
+const AlgEd25519 = "Ed25519"
+
+// Keyset errors.
+var (
+	ErrKeysetSignature = errors.New("edge: invalid keyset signature")
+	ErrStaleKeyset     = errors.New("edge: keyset older than the one in use")
+)
+
+// SignedKeyset is the distribution envelope. Payload is the base64url JSON
+// encoding of a KeysetDocument; Signature is the Ed25519 signature of the
+// decoded payload bytes by the VG distribution key.
+type SignedKeyset struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// KeysetDocument lists the VG session credential verification keys.
+type KeysetDocument struct {
+	Version  int        `json:"version"`
+	IssuedAt string     `json:"issued_at"` // RFC 3339
+	Keys     []KeyEntry `json:"keys"`
+}
+
+// KeyEntry is one verification key. Binary fields are base64url without
+// padding; key_id is the first 8 bytes of SHA-256(0x01 || public_key).
+type KeyEntry struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"alg"`
+	PublicKey string `json:"public_key"`
+	NotBefore string `json:"not_before"`
+	NotAfter  string `json:"not_after"`
+}
+
+// Key is a parsed verification key.
+type Key struct {
+	ID        [KeyIDSize]byte
+	PublicKey ed25519.PublicKey
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Keyset is a parsed and authenticated KeysetDocument.
+type Keyset struct {
+	IssuedAt time.Time
+	Keys     []Key
+}
+
+// KeyID returns the key ID of an Ed25519 credential key.
+func KeyID(pub ed25519.PublicKey) [KeyIDSize]byte {
+	sum := sha256.Sum256(append([]byte{algEd25519}, pub...))
+	var id [KeyIDSize]byte
+	copy(id[:], sum[:])
+	return id
+}
+
+// NewKeyEntry encodes a verification key.
+func NewKeyEntry(pub ed25519.PublicKey, notBefore, notAfter time.Time) KeyEntry {
+	id := KeyID(pub)
+	return KeyEntry{
+		KeyID:     base64.RawURLEncoding.EncodeToString(id[:]),
+		Algorithm: AlgEd25519,
+		PublicKey: base64.RawURLEncoding.EncodeToString(pub),
+		NotBefore: notBefore.UTC().Format(time.RFC3339),
+		NotAfter:  notAfter.UTC().Format(time.RFC3339),
+	}
+}
+
+// SignKeyset encodes doc and signs it with the distribution key.
+func SignKeyset(doc *KeysetDocument, distributionKey ed25519.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&SignedKeyset{
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Signature: base64.RawURLEncoding.EncodeToString(ed25519.Sign(distributionKey, payload)),
+	})
+}
+
+// ParseKeyset checks the signature of a SignedKeyset against the distribution
+// key and decodes its keys. Every key_id must match its public key.
+func ParseKeyset(data []byte, distributionKey ed25519.PublicKey) (*Keyset, error) {
+	var env SignedKeyset
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("edge: invalid keyset: %w", err)
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(env.Payload)
+	sig, err2 := base64.RawURLEncoding.DecodeString(env.Signature)
+	if err1 != nil || err2 != nil || !ed25519.Verify(distributionKey, payload, sig) {
+		return nil, ErrKeysetSignature
+	}
+
+	var doc KeysetDocument
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("edge: invalid keyset payload: %w", err)
+	}
+	if doc.Version != KeysetVersion {
+		return nil, fmt.Errorf("edge: unsupported keyset version %d", doc.Version)
+	}
+	issuedAt, err := time.Parse(time.RFC3339, doc.IssuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("edge: invalid issued_at: %w", err)
+	}
+	ks := &Keyset{IssuedAt: issuedAt}
+	for i, e := range doc.Keys {
+		k, err := parseKeyEntry(&e)
+		if err != nil {
+			return nil, fmt.Errorf("edge: key %d: %w", i, err)
+		}
+		ks.Keys = append(ks.Keys, k)
+	}
+	return ks, nil
+}
+
+func parseKeyEntry(e *KeyEntry) (Key, error) {
+	var k Key
+	if e.Algorithm != AlgEd25519 {
+		return k, fmt.Errorf("unsupported alg %q", e.Algorithm)
+	}
+	pub, err := base64.RawURLEncoding.DecodeString(e.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return k, errors.New("invalid public_key")
+	}
+	k.PublicKey = pub
+	k.ID = KeyID(k.PublicKey)
+	if id, err := base64.RawURLEncoding.DecodeString(e.KeyID); err != nil || string(id) != string(k.ID[:]) {
+		return k, errors.New("key_id does not match public_key")
+	}
+	if k.NotBefore, err = time.Parse(time.RFC3339, e.NotBefore); err != nil {
+		return k, fmt.Errorf("invalid not_before: %w", err)
+	}
+	if k.NotAfter, err = time.Parse(time.RFC3339, e.NotAfter); err != nil {
+		return k, fmt.Errorf("invalid not_after: %w", err)
+	}
+	if !k.NotAfter.After(k.NotBefore) {
+		return k, errors.New("not_after must be later than not_before")
+	}
+	return k, nil
+}
+
+func (ks *Keyset) lookup(id []byte, now time.Time) (*Key, bool) {
+	for i := range ks.Keys {
+		k := &ks.Keys[i]
+		if string(k.ID[:]) == string(id) {
+			return k, !now.Before(k.NotBefore) && now.Before(k.NotAfter)
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,44 @@
+package edge
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BracketHeader carries the age_bracket name of a verified credential from
+// the edge or the VG to the origin. Responses segmented by age bracket must
+// list it in Vary so that caches keep one variant per bracket (PROTOCOL.md
+// section 7.9).
+const BracketHeader = "AAVP-Age-Bracket"
+
+// AddVary adds BracketHeader to the Vary header of h unless it is already
+// listed.
+func AddVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f == "*" || strings.EqualFold(f, BracketHeader) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", BracketHeader)
+}
+
+// Vary wraps a handler serving segmented content so that every response
+// carries Vary: AAVP-Age-Bracket.
+func Vary(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddVary(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetBracket sets BracketHeader on a request forwarded to the origin,
+// replacing any value sent by the client.
+func SetBracket(r *http.Request, c *Credential) {
+	r.Header.Del(BracketHeader)
+	if c != nil {
+		r.Header.Set(BracketHeader, c.Bracket())
+	}
+}
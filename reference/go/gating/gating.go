@@ -0,0 +1,172 @@
+// Package gating enforces a platform's Segmentation Policy Declaration on
+// HTTP requests. Each route or content item is classified into taxonomy
+// categories (PROTOCOL.md section 8.2.3); the action applied for the age
+// bracket of the request is the one the published SPD declares, so the
+// enforced policy cannot drift from the declared one.
+//
+// Gating is additive (PROTOCOL.md section 7.7): a request without a valid
+// session credential, for an account that was never flagged as a minor, is
+// served without restrictions, and requests pass through while no SPD is
+// loaded. For a verified bracket, categories the SPD does not declare are
+// restricted unless its rules list "*" as unrestricted.
+package gating
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/account"
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+// Decision is the outcome of gating a request or content item.
+type Decision struct {
+	AgeBracket uint8          // effective bracket, meaningful unless Source is account.SourceNone
+	Source     account.Source // where AgeBracket comes from
+	Action     spd.Action     // most restrictive action over the categories
+	Categories []string       // categories that determined Action
+}
+
+// Gate applies the SPD to requests. Keys verifies session credentials. If
+// Accounts is set, AccountID identifies the account of a request ("" for
+// anonymous requests) and the account-level flag is applied on top of the
+// credential. Denied serves restricted requests; by default it replies 403
+// Forbidden. Now defaults to time.Now.
+//
+// A Gate is safe for concurrent use; the policy can be replaced at any time
+// with SetPolicy.
+type Gate struct {
+	Keys      *session.Keyset
+	Accounts  *account.Policy
+	AccountID func(r *http.Request) string
+	Denied    http.Handler
+	Now       func() time.Time
+
+	policy atomic.Pointer[spd.Document]
+}
+
+// NewGate creates a Gate enforcing policy with credentials verified by keys.
+func NewGate(policy *spd.Document, keys *session.Keyset) *Gate {
+	g := &Gate{Keys: keys, Now: time.Now}
+	g.SetPolicy(policy)
+	return g
+}
+
+// SetPolicy replaces the enforced SPD.
+func (g *Gate) SetPolicy(policy *spd.Document) {
+	g.policy.Store(policy)
+}
+
+// Policy returns the enforced SPD.
+func (g *Gate) Policy() *spd.Document {
+	return g.policy.Load()
+}
+
+func (g *Gate) now() time.Time {
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
+
+// Bracket returns the effective age bracket of r. An invalid or expired
+// credential counts as no credential.
+func (g *Gate) Bracket(r *http.Request) (account.Decision, error) {
+	now := g.now()
+	var cred *session.Credential
+	if encoded, ok := session.FromRequest(r); ok && g.Keys != nil {
+		if c, err := g.Keys.Verify(encoded, now); err == nil {
+			cred = c
+		}
+	}
+	if g.Accounts != nil && g.AccountID != nil {
+		if id := g.AccountID(r); id != "" {
+			return g.Accounts.Apply(r.Context(), id, cred, now)
+		}
+	}
+	if cred == nil {
+		return account.Decision{Source: account.SourceNone}, nil
+	}
+	return account.Decision{AgeBracket: cred.AgeBracket, Source: account.SourceCredential}, nil
+}
+
+// Check gates content classified in categories for the bracket of r. Content
+// without categories is unrestricted.
+func (g *Gate) Check(r *http.Request, categories ...string) (Decision, error) {
+	b, err := g.Bracket(r)
+	if err != nil {
+		return Decision{}, err
+	}
+	return g.decide(b, categories), nil
+}
+
+func (g *Gate) decide(b account.Decision, categories []string) Decision {
+	d := Decision{AgeBracket: b.AgeBracket, Source: b.Source, Action: spd.Unrestricted}
+	policy := g.Policy()
+	if b.Source == account.SourceNone || policy == nil {
+		return d
+	}
+	for _, c := range categories {
+		a := policy.Action(b.AgeBracket, c)
+		switch {
+		case a > d.Action:
+			d.Action = a
+			d.Categories = []string{c}
+		case a == d.Action && a != spd.Unrestricted:
+			d.Categories = append(d.Categories, c)
+		}
+	}
+	return d
+}
+
+// Handle gates next as a route classified in categories.
+func (g *Gate) Handle(next http.Handler, categories ...string) http.Handler {
+	return g.Middleware(func(*http.Request) []string { return categories })(next)
+}
+
+// Middleware gates every request with the categories returned by classify.
+// Restricted requests are served by Denied; the others reach next with the
+// Decision in their context (see FromContext) so that adapted content can be
+// modified. A failure of the account store is answered with 500.
+func (g *Gate) Middleware(classify func(r *http.Request) []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, err := g.Check(r, classify(r)...)
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			r = r.WithContext(NewContext(r.Context(), d))
+			if d.Action == spd.Restricted {
+				g.denied().ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (g *Gate) denied() http.Handler {
+	if g.Denied != nil {
+		return g.Denied
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "content restricted for this age bracket", http.StatusForbidden)
+	})
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying d.
+func NewContext(ctx context.Context, d Decision) context.Context {
+	return context.WithValue(ctx, contextKey{}, d)
+}
+
+// FromContext returns the Decision stored in ctx by Middleware.
+func FromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(contextKey{}).(Decision)
+	return d, ok
+}
@@ -0,0 +1,214 @@
+package gating
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/account"
+	"github.com/aavp-protocol/aavp-go/session"
+	"github.com/aavp-protocol/aavp-go/spd"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var policy = &spd.Document{
+	SPDVersion:      spd.Version,
+	Platform:        "example.com",
+	TaxonomyVersion: spd.TaxonomyVersion,
+	Segmentation: map[string]spd.Rules{
+		"UNDER_13": {
+			Restricted: []string{spd.CategoryExplicitSexual, spd.CategoryGambling},
+			Adapted:    []string{spd.CategoryProfanity},
+		},
+		"AGE_13_15": {
+			Restricted: []string{spd.CategoryExplicitSexual},
+			Adapted:    []string{spd.CategoryGambling, spd.CategoryProfanity},
+		},
+		"AGE_16_17": {
+			Restricted:   []string{spd.CategoryExplicitSexual},
+			Adapted:      []string{"x-loot-boxes"},
+			Unrestricted: []string{spd.CategoryGambling, spd.CategoryProfanity},
+		},
+		"OVER_18": {Unrestricted: []string{spd.All}},
+	},
+}
+
+func setupGate(t *testing.T) (*Gate, *session.Issuer) {
+	t.Helper()
+	k, err := session.GenerateEd25519Key(now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := session.NewKeyset(k)
+	g := NewGate(policy, ks)
+	g.Now = func() time.Time { return now }
+	return g, session.NewIssuer(ks)
+}
+
+func request(t *testing.T, is *session.Issuer, bracket int) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if bracket >= 0 {
+		cred, _, err := is.Issue(uint8(bracket), now.Add(time.Hour), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set(session.Header, cred)
+	}
+	return r
+}
+
+func TestCheck(t *testing.T) {
+	g, is := setupGate(t)
+	tests := []struct {
+		bracket    int // -1: no credential
+		categories []string
+		want       spd.Action
+	}{
+		{-1, []string{spd.CategoryExplicitSexual}, spd.Unrestricted},
+		{int(token.AgeBracketUnder13), nil, spd.Unrestricted},
+		{int(token.AgeBracketUnder13), []string{spd.CategoryProfanity}, spd.Adapted},
+		{int(token.AgeBracketUnder13), []string{spd.CategoryProfanity, spd.CategoryGambling}, spd.Restricted},
+		{int(token.AgeBracketAge13_15), []string{spd.CategoryGambling}, spd.Adapted},
+		{int(token.AgeBracketAge16_17), []string{spd.CategoryGambling}, spd.Unrestricted},
+		{int(token.AgeBracketAge16_17), []string{"x-loot-boxes"}, spd.Adapted},
+		{int(token.AgeBracketAge16_17), []string{"x-undeclared"}, spd.Restricted},
+		{int(token.AgeBracketAge16_17), []string{"x-undeclared", "x-loot-boxes"}, spd.Restricted},
+		// Undeclared for UNDER_13: restricted, not the no-signal action.
+		{int(token.AgeBracketUnder13), []string{spd.CategorySubstances}, spd.Restricted},
+		{int(token.AgeBracketUnder13), []string{"x-undeclared"}, spd.Restricted},
+		{int(token.AgeBracketOver18), []string{spd.CategoryExplicitSexual, "x-undeclared"}, spd.Unrestricted},
+	}
+	for _, tt := range tests {
+		d, err := g.Check(request(t, is, tt.bracket), tt.categories...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Action != tt.want {
+			t.Errorf("bracket %d, %v: action = %s, want %s", tt.bracket, tt.categories, d.Action, tt.want)
+		}
+	}
+
+	d, _ := g.Check(request(t, is, int(token.AgeBracketUnder13)), spd.CategoryGambling, spd.CategoryProfanity, spd.CategoryExplicitSexual)
+	if !slices.Equal(d.Categories, []string{spd.CategoryGambling, spd.CategoryExplicitSexual}) {
+		t.Errorf("categories = %v", d.Categories)
+	}
+}
+
+func TestCheckWithoutPolicy(t *testing.T) {
+	// Until an SPD is loaded, a verified bracket gets what a request without
+	// signal gets.
+	g, is := setupGate(t)
+	g.SetPolicy(nil)
+	for _, bracket := range []int{-1, int(token.AgeBracketUnder13), int(token.AgeBracketOver18)} {
+		if d, _ := g.Check(request(t, is, bracket), spd.CategoryGambling); d.Action != spd.Unrestricted {
+			t.Errorf("bracket %d without policy: decision = %+v", bracket, d)
+		}
+	}
+}
+
+func TestCheckInvalidCredential(t *testing.T) {
+	// An invalid or expired credential adds no restrictions.
+	g, is := setupGate(t)
+	r := request(t, is, int(token.AgeBracketUnder13))
+	g.Now = func() time.Time { return now.Add(time.Hour) }
+	d, err := g.Check(r, spd.CategoryGambling)
+	if err != nil || d.Source != account.SourceNone || d.Action != spd.Unrestricted {
+		t.Fatalf("decision = %+v, %v", d, err)
+	}
+
+	r.Header.Set(session.Header, "garbage")
+	if d, _ := g.Check(r, spd.CategoryGambling); d.Action != spd.Unrestricted {
+		t.Fatalf("decision = %+v", d)
+	}
+}
+
+func TestCheckAccountFlag(t *testing.T) {
+	g, is := setupGate(t)
+	g.Accounts = account.NewPolicy(account.NewMemoryStore())
+	g.AccountID = func(r *http.Request) string { return r.URL.Query().Get("user") }
+
+	r := request(t, is, int(token.AgeBracketAge13_15))
+	r.URL.RawQuery = "user=alice"
+	if d, _ := g.Check(r, spd.CategoryExplicitSexual); d.Action != spd.Restricted {
+		t.Fatalf("decision = %+v", d)
+	}
+
+	// Without the credential the account flag keeps the restrictions.
+	r = request(t, is, -1)
+	r.URL.RawQuery = "user=alice"
+	d, err := g.Check(r, spd.CategoryGambling)
+	if err != nil || d.Source != account.SourceAccountFlag || d.Action != spd.Adapted {
+		t.Fatalf("decision = %+v, %v", d, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	g, is := setupGate(t)
+	routes := map[string][]string{"/casino": {spd.CategoryGambling}, "/chat": {spd.CategoryProfanity}}
+	var got Decision
+	h := g.Middleware(func(r *http.Request) []string { return routes[r.URL.Path] })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	serve := func(path string, bracket int) int {
+		r := request(t, is, bracket)
+		r.URL.Path = path
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve("/casino", int(token.AgeBracketUnder13)); code != http.StatusForbidden {
+		t.Errorf("/casino UNDER_13: status = %d, want 403", code)
+	}
+	if code := serve("/chat", int(token.AgeBracketUnder13)); code != http.StatusOK || got.Action != spd.Adapted {
+		t.Errorf("/chat UNDER_13: status = %d, decision = %+v", code, got)
+	}
+	if code := serve("/casino", -1); code != http.StatusOK || got.Action != spd.Unrestricted {
+		t.Errorf("/casino without signal: status = %d, decision = %+v", code, got)
+	}
+
+	g.Denied = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, _ := FromContext(r.Context())
+		if d.Action != spd.Restricted {
+			t.Errorf("Denied: decision = %+v", d)
+		}
+		w.WriteHeader(http.StatusUnavailableForLegalReasons)
+	})
+	if code := serve("/casino", int(token.AgeBracketUnder13)); code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("custom Denied: status = %d", code)
+	}
+}
+
+func TestHandleFollowsPolicy(t *testing.T) {
+	g, is := setupGate(t)
+	h := g.Handle(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), spd.CategoryGambling)
+	serve := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request(t, is, int(token.AgeBracketAge16_17)))
+		return w.Code
+	}
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+
+	// Publishing a stricter policy changes what is enforced.
+	stricter := *policy
+	stricter.Segmentation = map[string]spd.Rules{"AGE_16_17": {Restricted: []string{spd.CategoryGambling}}}
+	g.SetPolicy(&stricter)
+	if code := serve(); code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", code)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("FromContext on empty context")
+	}
+}
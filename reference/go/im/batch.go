@@ -0,0 +1,70 @@
+package im
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+// MaxBatchSize is the largest number of blinded messages accepted in one
+// batched signing request.
+const MaxBatchSize = 32
+
+// ErrBatchSize is returned for an empty batch or one larger than MaxBatchSize.
+var ErrBatchSize = errors.New("im: batch must contain between 1 and 32 items")
+
+// BatchItem is one blinded message of a batch with its own public metadata.
+type BatchItem struct {
+	BlindedMsg []byte
+	Metadata   []byte
+}
+
+// BatchResult is the outcome of one BatchItem: a blind signature or an error.
+type BatchResult struct {
+	BlindSig []byte
+	Err      error
+}
+
+// BlindSignBatch performs BlindSign on every item in parallel (PROTOCOL.md
+// section 4.5.1, batch issuance). Results are in the order of items; a failing
+// item does not affect the others.
+func (im *Implementor) BlindSignBatch(items []BatchItem) ([]BatchResult, error) {
+	return blindSignBatch(im.PrivateKey, items)
+}
+
+// SignBatch performs BlindSignBatch with the key identified by tokenKeyID.
+func (m *KeyManager) SignBatch(tokenKeyID [32]byte, items []BatchItem, now time.Time) ([]BatchResult, error) {
+	k, err := m.SigningKey(tokenKeyID, now)
+	if err != nil {
+		return nil, err
+	}
+	return blindSignBatch(k.PrivateKey, items)
+}
+
+func blindSignBatch(sk *pbrsa.PrivateKey, items []BatchItem) ([]BatchResult, error) {
+	if len(items) == 0 || len(items) > MaxBatchSize {
+		return nil, ErrBatchSize
+	}
+	results := make([]BatchResult, len(items))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(len(items), runtime.GOMAXPROCS(0)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				sig, err := pbrsa.BlindSign(sk, items[i].BlindedMsg, items[i].Metadata)
+				results[i] = BatchResult{BlindSig: sig, Err: err}
+			}
+		}()
+	}
+	for i := range items {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results, nil
+}
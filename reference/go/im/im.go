@@ -6,11 +6,18 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
 )
 
+// MaxKeyValidity is the longest allowed not_after - not_before for an IM key
+// (PROTOCOL.md section 5.2.4).
+const MaxKeyValidity = 180 * 24 * time.Hour
+
 // Implementor holds the IM's master private key and configuration.
 type Implementor struct {
 	PrivateKey *pbrsa.PrivateKey
@@ -55,25 +62,87 @@ type WellKnownKey struct {
 	NotAfter   string `json:"not_after"`
 }
 
+// IssuerKey is a parsed and checked entry of the keys array.
+type IssuerKey struct {
+	TokenKeyID [32]byte
+	TokenType  uint16
+	PublicKey  *pbrsa.PublicKey
+	SPKIDER    []byte
+	NotBefore  time.Time
+	NotAfter   time.Time
+}
+
+// ParseKey decodes a key entry and checks it against PROTOCOL.md section 5.2.3:
+// token_key_id must be SHA-256 of the SPKI DER, token_type must be registered,
+// the key must be RSA of the size fixed by the token_type, and the validity
+// period must not exceed MaxKeyValidity.
+func (k *WellKnownKey) ParseKey() (*IssuerKey, error) {
+	kid, err := base64.RawURLEncoding.DecodeString(k.TokenKeyID)
+	if err != nil || len(kid) != 32 {
+		return nil, errors.New("im: invalid token_key_id encoding")
+	}
+	spki, err := base64.RawURLEncoding.DecodeString(k.PublicKey)
+	if err != nil {
+		return nil, errors.New("im: invalid public_key encoding")
+	}
+	out := &IssuerKey{TokenType: k.TokenType, SPKIDER: spki}
+	copy(out.TokenKeyID[:], kid)
+	if sha256.Sum256(spki) != out.TokenKeyID {
+		return nil, errors.New("im: token_key_id does not match SHA-256 of public_key")
+	}
+
+	info, ok := token.LookupType(k.TokenType)
+	if !ok || info.Status == token.StatusReserved {
+		return nil, fmt.Errorf("im: token_type 0x%04x is not registered", k.TokenType)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("im: invalid public_key: %w", err)
+	}
+	rsaPK, ok := parsed.(*rsa.PublicKey)
+	if !ok || rsaPK.N.BitLen() != info.KeyBits {
+		return nil, fmt.Errorf("im: public_key is not a %d-bit RSA key", info.KeyBits)
+	}
+	out.PublicKey = pbrsa.FromStdPublicKey(rsaPK)
+
+	if out.NotBefore, err = time.Parse(time.RFC3339, k.NotBefore); err != nil {
+		return nil, fmt.Errorf("im: invalid not_before: %w", err)
+	}
+	if out.NotAfter, err = time.Parse(time.RFC3339, k.NotAfter); err != nil {
+		return nil, fmt.Errorf("im: invalid not_after: %w", err)
+	}
+	if !out.NotAfter.After(out.NotBefore) {
+		return nil, errors.New("im: not_after must be later than not_before")
+	}
+	if out.NotAfter.Sub(out.NotBefore) > MaxKeyValidity {
+		return nil, errors.New("im: key validity period exceeds 180 days")
+	}
+	return out, nil
+}
+
 // WellKnownResponse generates the .well-known/aavp-issuer JSON structure.
 func (im *Implementor) WellKnownResponse(notBefore, notAfter time.Time) *WellKnownIssuer {
-	keyID := im.TokenKeyID()
-	keyIDBase64 := base64.RawURLEncoding.EncodeToString(keyID[:])
-	pkBase64 := base64.RawURLEncoding.EncodeToString(im.SPKIDER)
+	return newWellKnownIssuer(im.Domain, []WellKnownKey{
+		wellKnownKey(im.TokenKeyID(), token.TokenTypeRSAPBSSASHA384, im.SPKIDER, notBefore, notAfter),
+	})
+}
 
+func newWellKnownIssuer(domain string, keys []WellKnownKey) *WellKnownIssuer {
 	return &WellKnownIssuer{
-		Issuer:          im.Domain,
+		Issuer:          domain,
 		AAVPVersion:     "0.11",
-		SigningEndpoint: "https://" + im.Domain + "/aavp/v1/sign",
-		Keys: []WellKnownKey{
-			{
-				TokenKeyID: keyIDBase64,
-				TokenType:  1,
-				PublicKey:  pkBase64,
-				NotBefore:  notBefore.UTC().Format(time.RFC3339),
-				NotAfter:   notAfter.UTC().Format(time.RFC3339),
-			},
-		},
+		SigningEndpoint: "https://" + domain + "/aavp/v1/sign",
+		Keys:            keys,
+	}
+}
+
+func wellKnownKey(keyID [32]byte, tokenType uint16, spkiDER []byte, notBefore, notAfter time.Time) WellKnownKey {
+	return WellKnownKey{
+		TokenKeyID: base64.RawURLEncoding.EncodeToString(keyID[:]),
+		TokenType:  tokenType,
+		PublicKey:  base64.RawURLEncoding.EncodeToString(spkiDER),
+		NotBefore:  notBefore.UTC().Format(time.RFC3339),
+		NotAfter:   notAfter.UTC().Format(time.RFC3339),
 	}
 }
 
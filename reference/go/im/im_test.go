@@ -94,3 +94,40 @@ func TestSign(t *testing.T) {
 		t.Fatalf("Verify: %v", err)
 	}
 }
+
+func TestParseKey(t *testing.T) {
+	sk := testKey()
+	spkiDER, _ := MarshalSPKIDER(&sk.PublicKey)
+	imInst := NewImplementor(sk, spkiDER, "test-im.example")
+
+	notBefore, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:00Z")
+	resp := imInst.WellKnownResponse(notBefore, notBefore.Add(MaxKeyValidity))
+
+	key, err := resp.Keys[0].ParseKey()
+	if err != nil {
+		t.Fatalf("ParseKey: %v", err)
+	}
+	if key.TokenKeyID != imInst.TokenKeyID() {
+		t.Error("TokenKeyID mismatch")
+	}
+	if key.PublicKey.N.Cmp(sk.N) != 0 {
+		t.Error("public key modulus mismatch")
+	}
+
+	tooLong := imInst.WellKnownResponse(notBefore, notBefore.Add(MaxKeyValidity+time.Second)).Keys[0]
+	if _, err := tooLong.ParseKey(); err == nil {
+		t.Error("expected error for validity above 180 days")
+	}
+
+	wrongID := resp.Keys[0]
+	wrongID.TokenKeyID = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	if _, err := wrongID.ParseKey(); err == nil {
+		t.Error("expected error for token_key_id not matching public_key")
+	}
+
+	reserved := resp.Keys[0]
+	reserved.TokenType = 0
+	if _, err := reserved.ParseKey(); err == nil {
+		t.Error("expected error for reserved token_type")
+	}
+}
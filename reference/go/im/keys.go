@@ -0,0 +1,338 @@
+package im
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// Key rotation parameters (PROTOCOL.md section 5.2.4).
+const (
+	// MinKeyOverlap is the shortest time two consecutive keys are both valid.
+	// It covers the maximum token TTL and gives VGs a full refresh cycle.
+	MinKeyOverlap = 24 * time.Hour
+	// KeyPublicationLead is how far in the future the not_before of a rotated
+	// key must be, so VGs refreshing every 24 hours see it before it is used.
+	KeyPublicationLead = 24 * time.Hour
+	// DefaultRotationLead is how long before the newest key expires a rotation
+	// is scheduled. It matches the 30-day overlap of the section 5.2.3 example.
+	DefaultRotationLead = 30 * 24 * time.Hour
+)
+
+// KeyState is the lifecycle state of an IM key (PROTOCOL.md section 5.2.4).
+type KeyState uint8
+
+const (
+	// KeyPublished keys appear in .well-known/aavp-issuer but are not yet valid.
+	KeyPublished KeyState = iota
+	// KeyActive is the newest key valid for signing.
+	KeyActive
+	// KeyOverlap keys are still valid but a newer key has been published.
+	KeyOverlap
+	// KeyExpired keys have reached their not_after.
+	KeyExpired
+	// KeyWithdrawn keys were removed by the IM before their not_after.
+	KeyWithdrawn
+)
+
+// String returns the name of the state.
+func (s KeyState) String() string {
+	switch s {
+	case KeyPublished:
+		return "Published"
+	case KeyActive:
+		return "Active"
+	case KeyOverlap:
+		return "Overlap"
+	case KeyExpired:
+		return "Expired"
+	case KeyWithdrawn:
+		return "Withdrawn"
+	default:
+		return fmt.Sprintf("KeyState(%d)", uint8(s))
+	}
+}
+
+// Key manager errors.
+var (
+	ErrUnknownKey    = errors.New("im: unknown token_key_id")
+	ErrKeyNotSigning = errors.New("im: key is not valid for signing")
+	ErrKeyOverlap    = errors.New("im: key does not overlap the current key by at least 24 hours")
+)
+
+// ManagedKey is one signing key held by a KeyManager.
+type ManagedKey struct {
+	PrivateKey *pbrsa.PrivateKey
+	SPKIDER    []byte
+	TokenKeyID [32]byte
+	TokenType  uint16
+	NotBefore  time.Time
+	NotAfter   time.Time
+	Withdrawn  bool
+}
+
+func (k *ManagedKey) live(now time.Time) bool {
+	return !k.Withdrawn && now.Before(k.NotAfter)
+}
+
+func (k *ManagedKey) validAt(now time.Time) bool {
+	return k.live(now) && !now.Before(k.NotBefore)
+}
+
+// KeyManager holds the IM's signing keys and drives their rotation. It is safe
+// for concurrent use.
+type KeyManager struct {
+	Domain string
+	// RotationLead is how long before the newest key expires NextRotation falls.
+	RotationLead time.Duration
+
+	mu   sync.RWMutex
+	keys []*ManagedKey // ordered by NotBefore
+}
+
+// NewKeyManager creates an empty key manager for domain.
+func NewKeyManager(domain string) *KeyManager {
+	return &KeyManager{Domain: domain, RotationLead: DefaultRotationLead}
+}
+
+// AddKey adds a token_type 0x0001 key valid from notBefore to notAfter.
+//
+// The validity period must not exceed MaxKeyValidity. The first key may start
+// at any time; while another key is live, a new key must have a not_before at
+// least KeyPublicationLead after now and must overlap the live key that expires
+// last by at least MinKeyOverlap.
+func (m *KeyManager) AddKey(sk *pbrsa.PrivateKey, notBefore, notAfter, now time.Time) (*ManagedKey, error) {
+	k, err := newManagedKey(sk, notBefore, notAfter, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last *ManagedKey
+	for _, cur := range m.keys {
+		if cur.live(now) && (last == nil || cur.NotAfter.After(last.NotAfter)) {
+			last = cur
+		}
+	}
+	if last != nil {
+		if k.NotBefore.Before(now.Add(KeyPublicationLead)) {
+			return nil, errors.New("im: not_before must be at least 24 hours in the future")
+		}
+		if last.NotAfter.Sub(k.NotBefore) < MinKeyOverlap {
+			return nil, ErrKeyOverlap
+		}
+	}
+	if err := m.insert(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKey restores a key that was already published, for example when the
+// service restarts. Only the validity period is checked; the rotation
+// constraints of AddKey are not applied.
+func (m *KeyManager) LoadKey(sk *pbrsa.PrivateKey, notBefore, notAfter, now time.Time) (*ManagedKey, error) {
+	k, err := newManagedKey(sk, notBefore, notAfter, now)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.insert(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func newManagedKey(sk *pbrsa.PrivateKey, notBefore, notAfter, now time.Time) (*ManagedKey, error) {
+	notBefore = notBefore.UTC().Truncate(time.Second)
+	notAfter = notAfter.UTC().Truncate(time.Second)
+	if !notAfter.After(notBefore) {
+		return nil, errors.New("im: not_after must be later than not_before")
+	}
+	if notAfter.Sub(notBefore) > MaxKeyValidity {
+		return nil, errors.New("im: key validity period exceeds 180 days")
+	}
+	if !now.Before(notAfter) {
+		return nil, errors.New("im: key is already expired")
+	}
+	info, _ := token.LookupType(token.TokenTypeRSAPBSSASHA384)
+	if sk.N.BitLen() != info.KeyBits {
+		return nil, fmt.Errorf("im: key is not a %d-bit RSA key", info.KeyBits)
+	}
+	spkiDER, err := MarshalSPKIDER(&sk.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ManagedKey{
+		PrivateKey: sk,
+		SPKIDER:    spkiDER,
+		TokenKeyID: sha256.Sum256(spkiDER),
+		TokenType:  token.TokenTypeRSAPBSSASHA384,
+		NotBefore:  notBefore,
+		NotAfter:   notAfter,
+	}, nil
+}
+
+// insert adds k keeping the keys ordered by NotBefore. m.mu must be held.
+func (m *KeyManager) insert(k *ManagedKey) error {
+	for _, cur := range m.keys {
+		if cur.TokenKeyID == k.TokenKeyID {
+			return errors.New("im: key already present")
+		}
+	}
+	m.keys = append(m.keys, k)
+	sort.SliceStable(m.keys, func(i, j int) bool { return m.keys[i].NotBefore.Before(m.keys[j].NotBefore) })
+	return nil
+}
+
+// Rotate adds sk as the next key, valid from now plus KeyPublicationLead for
+// validity.
+func (m *KeyManager) Rotate(sk *pbrsa.PrivateKey, validity time.Duration, now time.Time) (*ManagedKey, error) {
+	notBefore := now.Add(KeyPublicationLead)
+	return m.AddKey(sk, notBefore, notBefore.Add(validity), now)
+}
+
+// NextRotation returns when the next key should be added: RotationLead before
+// the newest live key expires. It returns now if there is no live key.
+func (m *KeyManager) NextRotation(now time.Time) time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var last *ManagedKey
+	for _, k := range m.keys {
+		if k.live(now) && (last == nil || k.NotAfter.After(last.NotAfter)) {
+			last = k
+		}
+	}
+	if last == nil {
+		return now
+	}
+	return last.NotAfter.Add(-m.RotationLead)
+}
+
+// RotateIfDue generates and adds a new key when NextRotation has been reached.
+// newKey is only called when a rotation is due. It returns the added key, or
+// nil if no rotation was needed.
+func (m *KeyManager) RotateIfDue(now time.Time, validity time.Duration, newKey func() (*pbrsa.PrivateKey, error)) (*ManagedKey, error) {
+	if now.Before(m.NextRotation(now)) {
+		return nil, nil
+	}
+	sk, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	return m.Rotate(sk, validity, now)
+}
+
+// Withdraw removes a key from the published document and stops signing with
+// it immediately. Used when the IM detects that the key is compromised.
+func (m *KeyManager) Withdraw(tokenKeyID [32]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k.TokenKeyID == tokenKeyID {
+			k.Withdrawn = true
+			return nil
+		}
+	}
+	return ErrUnknownKey
+}
+
+// Prune forgets expired and withdrawn keys, including their private keys.
+func (m *KeyManager) Prune(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		if k.live(now) {
+			kept = append(kept, k)
+		}
+	}
+	m.keys = kept
+}
+
+// State returns the lifecycle state of a key at now.
+func (m *KeyManager) State(tokenKeyID [32]byte, now time.Time) (KeyState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i, k := range m.keys {
+		if k.TokenKeyID != tokenKeyID {
+			continue
+		}
+		switch {
+		case k.Withdrawn:
+			return KeyWithdrawn, nil
+		case !now.Before(k.NotAfter):
+			return KeyExpired, nil
+		case now.Before(k.NotBefore):
+			return KeyPublished, nil
+		}
+		for _, newer := range m.keys[i+1:] {
+			if newer.live(now) && newer.NotBefore.After(k.NotBefore) {
+				return KeyOverlap, nil
+			}
+		}
+		return KeyActive, nil
+	}
+	return 0, ErrUnknownKey
+}
+
+// SigningKey returns the key with tokenKeyID if it is valid for signing at now
+// (state Active or Overlap).
+func (m *KeyManager) SigningKey(tokenKeyID [32]byte, now time.Time) (*ManagedKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.keys {
+		if k.TokenKeyID != tokenKeyID {
+			continue
+		}
+		if !k.validAt(now) {
+			return nil, ErrKeyNotSigning
+		}
+		return k, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// CurrentKey returns the newest key valid for signing at now.
+func (m *KeyManager) CurrentKey(now time.Time) (*ManagedKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].validAt(now) {
+			return m.keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// Sign performs BlindSign with the key identified by tokenKeyID.
+func (m *KeyManager) Sign(tokenKeyID [32]byte, blindedMsg, metadata []byte, now time.Time) ([]byte, error) {
+	k, err := m.SigningKey(tokenKeyID, now)
+	if err != nil {
+		return nil, err
+	}
+	return pbrsa.BlindSign(k.PrivateKey, blindedMsg, metadata)
+}
+
+// WellKnownResponse generates the .well-known/aavp-issuer document with every
+// published, active and overlapping key at now. Expired and withdrawn keys are
+// left out.
+func (m *KeyManager) WellKnownResponse(now time.Time) *WellKnownIssuer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]WellKnownKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		if k.live(now) {
+			keys = append(keys, wellKnownKey(k.TokenKeyID, k.TokenType, k.SPKIDER, k.NotBefore, k.NotAfter))
+		}
+	}
+	return newWellKnownIssuer(m.Domain, keys)
+}
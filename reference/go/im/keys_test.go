@@ -0,0 +1,173 @@
+package im
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/internal/testkeys"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+func TestKeyManagerRotation(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewKeyManager("test-im.example")
+	validity := 180 * 24 * time.Hour
+
+	first, err := m.AddKey(testKey(), now, now.Add(validity), now)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+	if s, _ := m.State(first.TokenKeyID, now); s != KeyActive {
+		t.Errorf("first key state: got %v, want Active", s)
+	}
+
+	// No rotation is due until RotationLead before expiry.
+	calls := 0
+	newKey := func() (*pbrsa.PrivateKey, error) { calls++; return testkeys.SafePrimeKey(), nil }
+	if k, err := m.RotateIfDue(now.Add(24*time.Hour), validity, newKey); k != nil || err != nil || calls != 0 {
+		t.Fatalf("unexpected rotation: %v %v", k, err)
+	}
+
+	rotateAt := first.NotAfter.Add(-DefaultRotationLead)
+	if !m.NextRotation(now).Equal(rotateAt) {
+		t.Errorf("NextRotation: got %v, want %v", m.NextRotation(now), rotateAt)
+	}
+	second, err := m.RotateIfDue(rotateAt, validity, newKey)
+	if err != nil || second == nil {
+		t.Fatalf("RotateIfDue: %v", err)
+	}
+	if !second.NotBefore.Equal(rotateAt.Add(KeyPublicationLead)) {
+		t.Errorf("rotated not_before: got %v", second.NotBefore)
+	}
+
+	// Published: the new key is in the document but cannot sign yet.
+	if s, _ := m.State(second.TokenKeyID, rotateAt); s != KeyPublished {
+		t.Errorf("second key state: got %v, want Published", s)
+	}
+	if _, err := m.SigningKey(second.TokenKeyID, rotateAt); !errors.Is(err, ErrKeyNotSigning) {
+		t.Errorf("SigningKey before not_before: got %v", err)
+	}
+	if s, _ := m.State(first.TokenKeyID, rotateAt); s != KeyOverlap {
+		t.Errorf("first key state after rotation: got %v, want Overlap", s)
+	}
+	if got := len(m.WellKnownResponse(rotateAt).Keys); got != 2 {
+		t.Errorf("well-known keys during rotation: got %d, want 2", got)
+	}
+
+	// Both keys sign during the overlap; the newest is the current key.
+	during := second.NotBefore.Add(time.Hour)
+	if cur, _ := m.CurrentKey(during); cur.TokenKeyID != second.TokenKeyID {
+		t.Error("CurrentKey should be the newest active key")
+	}
+	for _, k := range []*ManagedKey{first, second} {
+		if _, err := m.SigningKey(k.TokenKeyID, during); err != nil {
+			t.Errorf("SigningKey during overlap: %v", err)
+		}
+	}
+
+	// Expired: the old key leaves the document and stops signing.
+	after := first.NotAfter
+	if s, _ := m.State(first.TokenKeyID, after); s != KeyExpired {
+		t.Errorf("first key state after not_after: got %v, want Expired", s)
+	}
+	if _, err := m.SigningKey(first.TokenKeyID, after); !errors.Is(err, ErrKeyNotSigning) {
+		t.Errorf("SigningKey after not_after: got %v", err)
+	}
+	doc := m.WellKnownResponse(after)
+	if len(doc.Keys) != 1 {
+		t.Fatalf("well-known keys after expiry: got %d, want 1", len(doc.Keys))
+	}
+	parsed, err := doc.Keys[0].ParseKey()
+	if err != nil {
+		t.Fatalf("ParseKey: %v", err)
+	}
+	if parsed.TokenKeyID != second.TokenKeyID {
+		t.Error("remaining key is not the rotated one")
+	}
+}
+
+func TestKeyManagerRejectsOutOfSpecKeys(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewKeyManager("test-im.example")
+
+	if _, err := m.AddKey(testKey(), now, now.Add(MaxKeyValidity+time.Second), now); err == nil {
+		t.Error("expected error for validity above 180 days")
+	}
+	first, err := m.AddKey(testKey(), now, now.Add(90*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+	if _, err := m.AddKey(testKey(), now.Add(48*time.Hour), now.Add(60*24*time.Hour), now); err == nil {
+		t.Error("expected error for duplicate key")
+	}
+
+	sk := testkeys.SafePrimeKey()
+	// not_before must be in the future while another key is live.
+	if _, err := m.AddKey(sk, now.Add(time.Hour), now.Add(100*24*time.Hour), now); err == nil {
+		t.Error("expected error for not_before less than 24 hours ahead")
+	}
+	// The new key must overlap the current one by at least 24 hours.
+	late := first.NotAfter.Add(-23 * time.Hour)
+	if _, err := m.AddKey(sk, late, late.Add(90*24*time.Hour), now); !errors.Is(err, ErrKeyOverlap) {
+		t.Errorf("expected ErrKeyOverlap, got %v", err)
+	}
+	ok := first.NotAfter.Add(-MinKeyOverlap)
+	if _, err := m.AddKey(sk, ok, ok.Add(90*24*time.Hour), now); err != nil {
+		t.Errorf("AddKey with exactly 24h overlap: %v", err)
+	}
+}
+
+func TestKeyManagerWithdrawAndSign(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewKeyManager("test-im.example")
+	k, err := m.AddKey(testKey(), now, now.Add(90*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+
+	pk := &k.PrivateKey.PublicKey
+	msg := []byte("test message for IM signing")
+	metadata := []byte{0x03, 0, 0, 0, 0, 0x69, 0xa3, 0x9d, 0xa0}
+	blindedMsg, state, err := pbrsa.Blind(pk, msg, metadata, nil)
+	if err != nil {
+		t.Fatalf("Blind: %v", err)
+	}
+	blindSig, err := m.Sign(k.TokenKeyID, blindedMsg, metadata, now)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	sig, err := pbrsa.Finalize(pk, msg, metadata, blindSig, state.Inv)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if err := pbrsa.Verify(pk, msg, metadata, sig); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	var unknown [32]byte
+	if _, err := m.Sign(unknown, blindedMsg, metadata, now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Sign with unknown key: got %v", err)
+	}
+
+	if err := m.Withdraw(k.TokenKeyID); err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if s, _ := m.State(k.TokenKeyID, now); s != KeyWithdrawn {
+		t.Errorf("state: got %v, want Withdrawn", s)
+	}
+	if _, err := m.Sign(k.TokenKeyID, blindedMsg, metadata, now); !errors.Is(err, ErrKeyNotSigning) {
+		t.Errorf("Sign with withdrawn key: got %v", err)
+	}
+	if len(m.WellKnownResponse(now).Keys) != 0 {
+		t.Error("withdrawn key still published")
+	}
+	// With no live key left, a replacement may start immediately.
+	if m.NextRotation(now) != now {
+		t.Error("rotation should be due with no live key")
+	}
+	m.Prune(now)
+	if _, err := m.State(k.TokenKeyID, now); !errors.Is(err, ErrUnknownKey) {
+		t.Error("Prune kept a withdrawn key")
+	}
+}
@@ -0,0 +1,422 @@
+package im
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/report"
+)
+
+// ReportsPath is the path of the aggregate report ingestion endpoint.
+const ReportsPath = "/aavp/v1/reports"
+
+// MaxReportSize bounds the body of an aggregate report.
+const MaxReportSize = 64 << 10
+
+// Report ingestion error codes.
+const (
+	ErrCodeInvalidReport   = "invalid_report"
+	ErrCodeWrongIM         = "wrong_im_domain"
+	ErrCodeDuplicateReport = "duplicate_report"
+	ErrCodeStoreFull       = "report_store_full"
+	ErrCodeInternal        = "internal_error"
+)
+
+// ReportStore errors.
+var (
+	// ErrDuplicateReport is returned for a report_id already stored for the
+	// same VG.
+	ErrDuplicateReport = errors.New("im: duplicate report")
+	// ErrStaleReport is returned for reports whose period ended longer ago
+	// than the store keeps reports.
+	ErrStaleReport = errors.New("im: report period ended too long ago")
+	// ErrReportStoreFull is returned when a store has reached its limits.
+	ErrReportStoreFull = errors.New("im: report store full")
+)
+
+// ReportStore keeps the aggregate reports received from VGs.
+type ReportStore interface {
+	// Add stores r. It returns ErrDuplicateReport if a report with the same
+	// vg_domain and report_id is already stored.
+	Add(r *report.Report) error
+	// Reports returns the reports of vgDomain ("" for every VG) in order of
+	// period_end.
+	Reports(vgDomain string) ([]*report.Report, error)
+}
+
+// Default limits of a MemoryReportStore.
+const (
+	DefaultReportMaxAge = 90 * 24 * time.Hour
+	DefaultMaxVGReports = 400
+	DefaultMaxReports   = 100_000
+	DefaultMaxReportVGs = 1000
+)
+
+// ReportClockSkew is how far in the future a MemoryReportStore accepts the
+// period_end of a report.
+const ReportClockSkew = 5 * time.Minute
+
+// MemoryReportStore is a ReportStore kept in memory. The report endpoint is
+// unauthenticated, so the store is bounded: reports whose period_end is
+// older than MaxAge are pruned (and refused with ErrStaleReport), reports
+// whose period_end is more than ReportClockSkew in the future are refused
+// with report.ErrInvalidReport, a VG keeps
+// at most MaxPerVG reports, dropping its oldest, and reports from more than
+// MaxVGs distinct VGs or beyond MaxReports in total are refused with
+// ErrReportStoreFull. A report_id is only remembered while its report is
+// kept.
+type MemoryReportStore struct {
+	MaxAge     time.Duration
+	MaxPerVG   int
+	MaxReports int
+	MaxVGs     int
+	Now        func() time.Time
+
+	mu    sync.RWMutex
+	vgs   map[string][]*report.Report // by lower-case vg_domain, in order of period_end
+	total int
+}
+
+// NewMemoryReportStore creates an empty MemoryReportStore with the default
+// limits.
+func NewMemoryReportStore() *MemoryReportStore {
+	return &MemoryReportStore{
+		MaxAge:     DefaultReportMaxAge,
+		MaxPerVG:   DefaultMaxVGReports,
+		MaxReports: DefaultMaxReports,
+		MaxVGs:     DefaultMaxReportVGs,
+		Now:        time.Now,
+		vgs:        make(map[string][]*report.Report),
+	}
+}
+
+func (s *MemoryReportStore) Add(r *report.Report) error {
+	vg := strings.ToLower(r.VGDomain)
+	now := s.Now()
+	if r.PeriodEnd.After(now.Add(ReportClockSkew)) {
+		return fmt.Errorf("%w: period ends in the future", report.ErrInvalidReport)
+	}
+	cutoff := now.Add(-s.MaxAge)
+	if r.PeriodEnd.Before(cutoff) {
+		return ErrStaleReport
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(cutoff)
+
+	reports, ok := s.vgs[vg]
+	for _, stored := range reports {
+		if stored.ReportID == r.ReportID {
+			return ErrDuplicateReport
+		}
+	}
+	if !ok && len(s.vgs) >= s.MaxVGs || len(reports) < s.MaxPerVG && s.total >= s.MaxReports {
+		return ErrReportStoreFull
+	}
+	if len(reports) >= s.MaxPerVG {
+		// Drop the oldest report of the VG.
+		reports = reports[1:]
+		s.total--
+	}
+	i := sort.Search(len(reports), func(i int) bool { return r.PeriodEnd.Before(reports[i].PeriodEnd) })
+	reports = slices.Insert(reports, i, r)
+	s.vgs[vg] = reports
+	s.total++
+	return nil
+}
+
+// prune drops the reports whose period ended before cutoff. s.mu must be
+// held.
+func (s *MemoryReportStore) prune(cutoff time.Time) {
+	for vg, reports := range s.vgs {
+		n := sort.Search(len(reports), func(i int) bool { return !reports[i].PeriodEnd.Before(cutoff) })
+		if n == 0 {
+			continue
+		}
+		s.total -= n
+		if n == len(reports) {
+			delete(s.vgs, vg)
+		} else {
+			s.vgs[vg] = slices.Clone(reports[n:])
+		}
+	}
+}
+
+func (s *MemoryReportStore) Reports(vgDomain string) ([]*report.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if vgDomain != "" {
+		return slices.Clone(s.vgs[strings.ToLower(vgDomain)]), nil
+	}
+	var out []*report.Report
+	for _, reports := range s.vgs {
+		out = append(out, reports...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].PeriodEnd.Equal(out[j].PeriodEnd) {
+			return out[i].PeriodEnd.Before(out[j].PeriodEnd)
+		}
+		return out[i].VGDomain < out[j].VGDomain
+	})
+	return out, nil
+}
+
+// Thresholds configure the alerts raised by a ReportMonitor. A ratio is the
+// number of failures of one class over total_tokens. A zero ratio disables
+// the alert for that class.
+type Thresholds struct {
+	// MinTokens is the smallest total_tokens for which ratios are evaluated.
+	MinTokens uint64
+	// Maximum ratio of each failure class.
+	Expired      float64
+	BadSignature float64
+	Malformed    float64
+	UnknownKey   float64
+	// SpikeFactor raises an alert when a ratio exceeds SpikeFactor times its
+	// average over the previous Window reports of the same VG (and key).
+	// Zero disables spike detection.
+	SpikeFactor float64
+	Window      int
+}
+
+// DefaultThresholds returns the thresholds used by NewReportMonitor.
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		MinTokens:    100,
+		Expired:      0.10,
+		BadSignature: 0.01,
+		Malformed:    0.05,
+		UnknownKey:   0.05,
+		SpikeFactor:  3,
+		Window:       7,
+	}
+}
+
+func (t *Thresholds) limit(o report.Outcome) float64 {
+	switch o {
+	case report.Expired:
+		return t.Expired
+	case report.BadSignature:
+		return t.BadSignature
+	case report.Malformed:
+		return t.Malformed
+	case report.UnknownKey:
+		return t.UnknownKey
+	}
+	return 0
+}
+
+// failureClasses are the outcome classes evaluated by a ReportMonitor.
+var failureClasses = []report.Outcome{report.Expired, report.BadSignature, report.Malformed, report.UnknownKey}
+
+// Alert reports a failure ratio crossing a threshold.
+type Alert struct {
+	VGDomain   string
+	TokenKeyID string // base64url; empty for alerts on the IM as a whole
+	Class      report.Outcome
+	Ratio      float64
+	Threshold  float64 // the limit that was crossed
+	Baseline   float64 // average ratio over the window; 0 for absolute alerts
+	PeriodEnd  time.Time
+}
+
+// TrendPoint is the failure ratios of one report period.
+type TrendPoint struct {
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	TotalTokens uint64
+	Ratios      map[report.Outcome]float64
+}
+
+// ReportMonitor receives the aggregate verification reports that VGs send to
+// the IM (PROTOCOL.md section 9.5.3), stores them and raises an Alert when a
+// failure ratio crosses its threshold: a rise of bad_signature suggests a
+// problem in the signing service, a rise of unknown_key a failure in key
+// distribution.
+//
+// Reports must be for Domain and cover at least report.MinPeriod. The
+// vg_domain of a report is taken as sent; deployments that need to
+// authenticate VGs do it in front of the handler.
+type ReportMonitor struct {
+	Domain     string
+	Store      ReportStore
+	Thresholds Thresholds
+	// OnAlert, if set, receives the alerts raised by each ingested report.
+	OnAlert func(Alert)
+}
+
+// NewReportMonitor creates a ReportMonitor for the IM at domain with the
+// default thresholds.
+func NewReportMonitor(domain string, store ReportStore) *ReportMonitor {
+	return &ReportMonitor{Domain: domain, Store: store, Thresholds: DefaultThresholds()}
+}
+
+// Ingest validates and stores r and returns the alerts it raises. The trend
+// baseline is taken from the reports stored before r.
+func (m *ReportMonitor) Ingest(r *report.Report) ([]Alert, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(r.IMDomain, m.Domain) {
+		return nil, errWrongIM
+	}
+	history, err := m.Store.Reports(r.VGDomain)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Store.Add(r); err != nil {
+		return nil, err
+	}
+
+	var alerts []Alert
+	alerts = m.evaluate(alerts, r, "", history)
+	for _, k := range r.Keys {
+		alerts = m.evaluate(alerts, r, k.TokenKeyID, history)
+	}
+	if m.OnAlert != nil {
+		for _, a := range alerts {
+			m.OnAlert(a)
+		}
+	}
+	return alerts, nil
+}
+
+var errWrongIM = errors.New("im: report for another IM")
+
+// evaluate appends the alerts raised by the counters of r for tokenKeyID
+// ("" for the whole report).
+func (m *ReportMonitor) evaluate(alerts []Alert, r *report.Report, tokenKeyID string, history []*report.Report) []Alert {
+	th := &m.Thresholds
+	p, ok := point(r, tokenKeyID)
+	if !ok || p.TotalTokens == 0 || p.TotalTokens < th.MinTokens {
+		return alerts
+	}
+	var window []TrendPoint
+	if th.SpikeFactor > 0 && th.Window > 0 {
+		for i := len(history) - 1; i >= 0 && len(window) < th.Window; i-- {
+			if hp, ok := point(history[i], tokenKeyID); ok && hp.TotalTokens >= th.MinTokens && hp.TotalTokens > 0 {
+				window = append(window, hp)
+			}
+		}
+	}
+
+	for _, class := range failureClasses {
+		ratio := p.Ratios[class]
+		a := Alert{VGDomain: r.VGDomain, TokenKeyID: tokenKeyID, Class: class, Ratio: ratio, PeriodEnd: r.PeriodEnd}
+		if limit := th.limit(class); limit > 0 && ratio > limit {
+			a.Threshold = limit
+			alerts = append(alerts, a)
+			continue
+		}
+		if len(window) == 0 {
+			continue
+		}
+		var sum float64
+		for _, hp := range window {
+			sum += hp.Ratios[class]
+		}
+		if baseline := sum / float64(len(window)); baseline > 0 && ratio > th.SpikeFactor*baseline {
+			a.Threshold = th.SpikeFactor * baseline
+			a.Baseline = baseline
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// Trend returns the failure ratios of the reports of vgDomain ("" for every
+// VG), restricted to tokenKeyID if it is not empty, in order of period_end.
+func (m *ReportMonitor) Trend(vgDomain, tokenKeyID string) ([]TrendPoint, error) {
+	reports, err := m.Store.Reports(vgDomain)
+	if err != nil {
+		return nil, err
+	}
+	var out []TrendPoint
+	for _, r := range reports {
+		if p, ok := point(r, tokenKeyID); ok {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// point returns the ratios of r, or of its entry for tokenKeyID.
+func point(r *report.Report, tokenKeyID string) (TrendPoint, bool) {
+	total, failures := r.TotalTokens, r.Failures
+	if tokenKeyID != "" {
+		found := false
+		for _, k := range r.Keys {
+			if k.TokenKeyID == tokenKeyID {
+				total, failures, found = k.TotalTokens, k.Failures, true
+				break
+			}
+		}
+		if !found {
+			return TrendPoint{}, false
+		}
+	}
+	p := TrendPoint{PeriodStart: r.PeriodStart, PeriodEnd: r.PeriodEnd, TotalTokens: total, Ratios: make(map[report.Outcome]float64)}
+	if total > 0 {
+		n := float64(total)
+		p.Ratios[report.Expired] = float64(failures.Expired) / n
+		p.Ratios[report.BadSignature] = float64(failures.BadSignature) / n
+		p.Ratios[report.Malformed] = float64(failures.Malformed) / n
+		p.Ratios[report.UnknownKey] = float64(failures.UnknownKey) / n
+	}
+	return p, true
+}
+
+// ServeHTTP accepts a report posted as JSON. It answers 202 Accepted, 400
+// with ErrCodeInvalidRequest or ErrCodeInvalidReport (including periods
+// shorter than 24 hours, stale reports and periods ending in the future), 403 with ErrCodeWrongIM, 409
+// with ErrCodeDuplicateReport and 503 with ErrCodeStoreFull.
+func (m *ReportMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeReportResponse(w, http.StatusMethodNotAllowed, ErrCodeInvalidRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxReportSize+1))
+	if err != nil || len(body) > MaxReportSize {
+		writeReportResponse(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	rep, err := report.Parse(body)
+	if err != nil {
+		writeReportResponse(w, http.StatusBadRequest, ErrCodeInvalidReport)
+		return
+	}
+	switch _, err := m.Ingest(rep); {
+	case err == nil:
+		writeReportResponse(w, http.StatusAccepted, "")
+	case errors.Is(err, errWrongIM):
+		writeReportResponse(w, http.StatusForbidden, ErrCodeWrongIM)
+	case errors.Is(err, ErrDuplicateReport):
+		writeReportResponse(w, http.StatusConflict, ErrCodeDuplicateReport)
+	case errors.Is(err, ErrStaleReport), errors.Is(err, report.ErrInvalidReport):
+		writeReportResponse(w, http.StatusBadRequest, ErrCodeInvalidReport)
+	case errors.Is(err, ErrReportStoreFull):
+		writeReportResponse(w, http.StatusServiceUnavailable, ErrCodeStoreFull)
+	default:
+		writeReportResponse(w, http.StatusInternalServerError, ErrCodeInternal)
+	}
+}
+
+func writeReportResponse(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if code == "" {
+		w.Write([]byte(`{"status":"accepted"}`))
+		return
+	}
+	json.NewEncoder(w).Encode(&ErrorResponse{Error: code})
+}
@@ -0,0 +1,222 @@
+package im
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/report"
+)
+
+var reportStart = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+var reportKeyID = base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+
+// dailyReport returns the report of day n from vg.example for test-im.example
+// with total tokens, of which badSig failed the signature check, all under
+// reportKeyID.
+func dailyReport(n int, total, badSig uint64) *report.Report {
+	f := report.Failures{BadSignature: badSig}
+	return &report.Report{
+		ReportID:    "r" + string(rune('a'+n)),
+		VGDomain:    "vg.example",
+		PeriodStart: reportStart.Add(time.Duration(n) * report.MinPeriod),
+		PeriodEnd:   reportStart.Add(time.Duration(n+1) * report.MinPeriod),
+		IMDomain:    "test-im.example",
+		TotalTokens: total,
+		ValidTokens: total - badSig,
+		Failures:    f,
+		Keys:        []report.KeyCounts{{TokenKeyID: reportKeyID, TotalTokens: total, ValidTokens: total - badSig, Failures: f}},
+	}
+}
+
+// newTestReportStore returns a MemoryReportStore whose clock is 30 days
+// after reportStart.
+func newTestReportStore() *MemoryReportStore {
+	s := NewMemoryReportStore()
+	s.Now = func() time.Time { return reportStart.Add(30 * report.MinPeriod) }
+	return s
+}
+
+func TestReportMonitorAlerts(t *testing.T) {
+	m := NewReportMonitor("test-im.example", newTestReportStore())
+	m.Thresholds.BadSignature = 0.5
+	var raised []Alert
+	m.OnAlert = func(a Alert) { raised = append(raised, a) }
+
+	// A steady 0.2% of bad signatures raises nothing.
+	for n := range 3 {
+		alerts, err := m.Ingest(dailyReport(n, 1000, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 0 {
+			t.Fatalf("day %d: alerts = %+v", n, alerts)
+		}
+	}
+
+	// 1% is below the absolute threshold but five times the baseline: one
+	// alert for the IM and one for the key.
+	alerts, err := m.Ingest(dailyReport(3, 1000, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || len(raised) != 2 {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	if a := alerts[1]; a.Class != report.BadSignature || a.TokenKeyID != reportKeyID || a.Ratio != 0.01 || a.Baseline != 0.002 {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// Above the absolute threshold.
+	alerts, _ = m.Ingest(dailyReport(4, 1000, 600))
+	if len(alerts) != 2 || alerts[0].Threshold != 0.5 || alerts[0].Baseline != 0 {
+		t.Errorf("alerts = %+v", alerts)
+	}
+
+	// Too few tokens to be meaningful.
+	if alerts, _ := m.Ingest(dailyReport(5, 10, 10)); len(alerts) != 0 {
+		t.Errorf("alerts below MinTokens = %+v", alerts)
+	}
+
+	trend, err := m.Trend("vg.example", reportKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 6 || trend[4].Ratios[report.BadSignature] != 0.6 {
+		t.Errorf("trend = %+v", trend)
+	}
+	if trend, _ := m.Trend("other.example", ""); len(trend) != 0 {
+		t.Errorf("trend of unknown VG = %+v", trend)
+	}
+}
+
+func TestReportMonitorRejects(t *testing.T) {
+	m := NewReportMonitor("test-im.example", newTestReportStore())
+	if _, err := m.Ingest(dailyReport(0, 10, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Ingest(dailyReport(0, 10, 0)); err != ErrDuplicateReport {
+		t.Errorf("duplicate: %v", err)
+	}
+	r := dailyReport(1, 10, 0)
+	r.IMDomain = "other-im.example"
+	if _, err := m.Ingest(r); err == nil {
+		t.Error("report for another IM accepted")
+	}
+	r = dailyReport(2, 10, 0)
+	r.PeriodEnd = r.PeriodStart.Add(12 * time.Hour)
+	if _, err := m.Ingest(r); err == nil {
+		t.Error("12 hour report accepted")
+	}
+}
+
+func TestMemoryReportStoreLimits(t *testing.T) {
+	s := newTestReportStore()
+	s.MaxAge = 20 * report.MinPeriod
+	s.MaxPerVG, s.MaxReports, s.MaxVGs = 3, 5, 2
+
+	if err := s.Add(dailyReport(0, 10, 0)); err != ErrStaleReport {
+		t.Errorf("stale report: %v", err)
+	}
+	// A period_end in the future would never be pruned.
+	future := dailyReport(10, 10, 0)
+	future.PeriodEnd = time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Add(future); !errors.Is(err, report.ErrInvalidReport) {
+		t.Errorf("future report: %v", err)
+	}
+	if err := s.Add(dailyReport(30, 10, 0)); !errors.Is(err, report.ErrInvalidReport) {
+		t.Errorf("report ending tomorrow: %v", err)
+	}
+	// A VG keeps its newest MaxPerVG reports.
+	for n := 10; n < 15; n++ {
+		if err := s.Add(dailyReport(n, 10, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := s.Reports("VG.example"); len(got) != 3 || got[0].ReportID != dailyReport(12, 0, 0).ReportID {
+		t.Errorf("reports of vg.example = %d", len(got))
+	}
+
+	other := func(vg string, n int) *report.Report {
+		r := dailyReport(n, 10, 0)
+		r.VGDomain = vg
+		return r
+	}
+	if err := s.Add(other("vg2.example", 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(other("vg3.example", 20)); err != ErrReportStoreFull {
+		t.Errorf("VG beyond MaxVGs: %v", err)
+	}
+	if err := s.Add(other("vg2.example", 21)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(other("vg2.example", 22)); err != ErrReportStoreFull {
+		t.Errorf("report beyond MaxReports: %v", err)
+	}
+
+	// Reports age out as time passes, freeing room.
+	s.Now = func() time.Time { return reportStart.Add(40 * report.MinPeriod) }
+	if err := s.Add(other("vg3.example", 20)); err != nil {
+		t.Errorf("after pruning: %v", err)
+	}
+	if got, _ := s.Reports(""); len(got) != 3 {
+		t.Errorf("reports after pruning = %d", len(got))
+	}
+}
+
+func TestServerReports(t *testing.T) {
+	s, _, _ := setupServer(t)
+	s.Reports = NewReportMonitor("test-im.example", newTestReportStore())
+	h := s.Handler()
+
+	post := func(r *report.Report) *httptest.ResponseRecorder {
+		t.Helper()
+		body, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ReportsPath, strings.NewReader(string(body))))
+		return rec
+	}
+	errorCode := func(rec *httptest.ResponseRecorder) string {
+		var resp ErrorResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp.Error
+	}
+
+	if rec := post(dailyReport(0, 100, 1)); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec := post(dailyReport(0, 100, 1)); rec.Code != http.StatusConflict || errorCode(rec) != ErrCodeDuplicateReport {
+		t.Errorf("duplicate: %d %s", rec.Code, rec.Body)
+	}
+	short := dailyReport(1, 100, 1)
+	short.PeriodEnd = short.PeriodStart.Add(23 * time.Hour)
+	if rec := post(short); rec.Code != http.StatusBadRequest || errorCode(rec) != ErrCodeInvalidReport {
+		t.Errorf("short period: %d %s", rec.Code, rec.Body)
+	}
+	future := dailyReport(3, 100, 1)
+	future.PeriodEnd = time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if rec := post(future); rec.Code != http.StatusBadRequest || errorCode(rec) != ErrCodeInvalidReport {
+		t.Errorf("future period: %d %s", rec.Code, rec.Body)
+	}
+	other := dailyReport(2, 100, 1)
+	other.IMDomain = "other-im.example"
+	if rec := post(other); rec.Code != http.StatusForbidden || errorCode(rec) != ErrCodeWrongIM {
+		t.Errorf("other IM: %d %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReportsPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d", rec.Code)
+	}
+}
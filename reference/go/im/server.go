@@ -0,0 +1,237 @@
+package im
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+)
+
+// HTTP paths served by the IM.
+const (
+	WellKnownIssuerPath = "/.well-known/aavp-issuer"
+	SignPath            = "/aavp/v1/sign"
+)
+
+// MaxSignRequestSize bounds the body of a signing request, including batched
+// requests of up to MaxBatchSize items.
+const MaxSignRequestSize = 16 * padding.BlockSize
+
+// SignRequest is the body of a POST to the signing endpoint. Binary fields are
+// base64url without padding.
+//
+// A batched request (PROTOCOL.md section 4.5.1) carries its blinded messages in
+// Items, each with its own metadata, and leaves BlindedMsg and Metadata empty.
+// All items are signed with the same key.
+type SignRequest struct {
+	TokenType  uint16     `json:"token_type"`
+	TokenKeyID string     `json:"token_key_id"`
+	BlindedMsg string     `json:"blinded_msg,omitempty"`
+	Metadata   string     `json:"metadata,omitempty"` // age_bracket (1 byte) || expires_at (8 bytes BE)
+	Items      []SignItem `json:"items,omitempty"`
+}
+
+// SignItem is one blinded message of a batched request.
+type SignItem struct {
+	BlindedMsg string `json:"blinded_msg"`
+	Metadata   string `json:"metadata"`
+}
+
+// SignResponse is the body of a successful signing response. A batched
+// request is answered with one entry in Items per request item, in order.
+type SignResponse struct {
+	BlindSig string           `json:"blind_sig,omitempty"`
+	Items    []SignItemResult `json:"items,omitempty"`
+}
+
+// SignItemResult is the outcome of one item of a batched request: either
+// BlindSig or an error code.
+type SignItemResult struct {
+	BlindSig string `json:"blind_sig,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErrorResponse is the body of a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Signing endpoint error codes.
+const (
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeUnsupportedTokenType = "unsupported_token_type"
+	ErrCodeUnknownKey           = "unknown_token_key_id"
+	ErrCodeInvalidMetadata      = "invalid_metadata"
+	ErrCodeSigningFailed        = "signing_failed"
+)
+
+// Server serves the signing endpoint and .well-known/aavp-issuer of an IM.
+//
+// Requests are never logged and no per-request state is kept (IM-06): the
+// server only sees the blinded message and the public metadata, and discards
+// both once the response has been written.
+type Server struct {
+	Keys *KeyManager
+	Now  func() time.Time
+	// Reports, if set, is served at ReportsPath.
+	Reports *ReportMonitor
+}
+
+// NewServer creates a Server signing with the keys of m.
+func NewServer(m *KeyManager) *Server {
+	return &Server{Keys: m, Now: time.Now}
+}
+
+// Handler returns an http.Handler routing the IM endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+WellKnownIssuerPath, s.handleWellKnown)
+	mux.HandleFunc("POST "+SignPath, s.handleSign)
+	if s.Reports != nil {
+		mux.Handle(ReportsPath, s.Reports)
+	}
+	return mux
+}
+
+func (s *Server) handleWellKnown(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(s.Keys.WellKnownResponse(s.Now()))
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(body)
+}
+
+func (s *Server) handleSign(w http.ResponseWriter, r *http.Request) {
+	var req SignRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, MaxSignRequestSize)).Decode(&req); err != nil {
+		writeSignError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	now := s.Now()
+
+	if !token.IsActiveType(req.TokenType) {
+		writeSignError(w, http.StatusBadRequest, ErrCodeUnsupportedTokenType)
+		return
+	}
+	kid, err := base64.RawURLEncoding.DecodeString(req.TokenKeyID)
+	if err != nil || len(kid) != token.SizeTokenKeyID {
+		writeSignError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	var keyID [32]byte
+	copy(keyID[:], kid)
+	key, err := s.Keys.SigningKey(keyID, now)
+	if err != nil {
+		writeSignError(w, http.StatusBadRequest, ErrCodeUnknownKey)
+		return
+	}
+	if key.TokenType != req.TokenType {
+		writeSignError(w, http.StatusBadRequest, ErrCodeUnsupportedTokenType)
+		return
+	}
+
+	if req.Items != nil {
+		s.signBatch(w, &req, key, now)
+		return
+	}
+	item, code := decodeItem(req.BlindedMsg, req.Metadata, key, now)
+	if code != "" {
+		writeSignError(w, http.StatusBadRequest, code)
+		return
+	}
+	blindSig, err := s.Keys.Sign(keyID, item.BlindedMsg, item.Metadata, now)
+	if err != nil {
+		// The request was checked above: a failure is on the IM side.
+		writeSignError(w, http.StatusInternalServerError, ErrCodeSigningFailed)
+		return
+	}
+	writePadded(w, http.StatusOK, &SignResponse{BlindSig: base64.RawURLEncoding.EncodeToString(blindSig)})
+}
+
+// signBatch answers a batched request. Items that fail validation or signing
+// carry their own error code; the others are signed in parallel.
+func (s *Server) signBatch(w http.ResponseWriter, req *SignRequest, key *ManagedKey, now time.Time) {
+	if len(req.Items) == 0 || len(req.Items) > MaxBatchSize || req.BlindedMsg != "" || req.Metadata != "" {
+		writeSignError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	out := make([]SignItemResult, len(req.Items))
+	var items []BatchItem
+	var index []int
+	for i, it := range req.Items {
+		item, code := decodeItem(it.BlindedMsg, it.Metadata, key, now)
+		if code != "" {
+			out[i].Error = code
+			continue
+		}
+		items = append(items, item)
+		index = append(index, i)
+	}
+	if len(items) > 0 {
+		results, err := s.Keys.SignBatch(key.TokenKeyID, items, now)
+		if err != nil {
+			writeSignError(w, http.StatusBadRequest, ErrCodeUnknownKey)
+			return
+		}
+		for j, res := range results {
+			if res.Err != nil {
+				out[index[j]].Error = ErrCodeSigningFailed
+				continue
+			}
+			out[index[j]].BlindSig = base64.RawURLEncoding.EncodeToString(res.BlindSig)
+		}
+	}
+	writePadded(w, http.StatusOK, &SignResponse{Items: out})
+}
+
+// decodeItem decodes and checks one blinded message and its metadata. It
+// returns an error code if they are not acceptable for key.
+func decodeItem(blindedMsgB64, metadataB64 string, key *ManagedKey, now time.Time) (BatchItem, string) {
+	metadata, err := base64.RawURLEncoding.DecodeString(metadataB64)
+	if err != nil || !validMetadata(metadata, now) {
+		return BatchItem{}, ErrCodeInvalidMetadata
+	}
+	blindedMsg, err := base64.RawURLEncoding.DecodeString(blindedMsgB64)
+	if err != nil || len(blindedMsg) != (key.PrivateKey.N.BitLen()+7)/8 || new(big.Int).SetBytes(blindedMsg).Cmp(key.PrivateKey.N) >= 0 {
+		return BatchItem{}, ErrCodeInvalidRequest
+	}
+	return BatchItem{BlindedMsg: blindedMsg, Metadata: metadata}, ""
+}
+
+// validMetadata checks the 9-byte public metadata: a defined age_bracket and
+// an expires_at in the future and within the maximum token TTL.
+func validMetadata(metadata []byte, now time.Time) bool {
+	if len(metadata) != token.PublicMetadataSize || !token.ValidAgeBracket(metadata[0]) {
+		return false
+	}
+	expiresAt := binary.BigEndian.Uint64(metadata[1:])
+	nowUnix := uint64(now.Unix())
+	return expiresAt > nowUnix && expiresAt <= nowUnix+validation.MaxTTLSeconds+validation.ClockSkewToleranceFuture
+}
+
+func writeSignError(w http.ResponseWriter, status int, code string) {
+	writePadded(w, status, &ErrorResponse{Error: code})
+}
+
+func writePadded(w http.ResponseWriter, status int, v any) {
+	body, err := padding.Marshal(v)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
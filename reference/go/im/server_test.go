@@ -0,0 +1,250 @@
+package im
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+func setupServer(t *testing.T) (*Server, *ManagedKey, time.Time) {
+	t.Helper()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := NewKeyManager("test-im.example")
+	k, err := m.AddKey(testKey(), now.Add(-time.Hour), now.Add(90*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+	s := NewServer(m)
+	s.Now = func() time.Time { return now }
+	return s, k, now
+}
+
+func postSign(t *testing.T, h http.Handler, req any) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := padding.Marshal(req)
+	if err != nil {
+		t.Fatalf("padding.Marshal: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, SignPath, bytes.NewReader(body)))
+	return rec
+}
+
+func testMetadata(bracket uint8, expiresAt time.Time) []byte {
+	meta := make([]byte, token.PublicMetadataSize)
+	meta[0] = bracket
+	binary.BigEndian.PutUint64(meta[1:], uint64(expiresAt.Unix()))
+	return meta
+}
+
+func TestServerSign(t *testing.T) {
+	s, k, now := setupServer(t)
+	h := s.Handler()
+
+	pk := &k.PrivateKey.PublicKey
+	msg := []byte("test message for IM signing")
+	metadata := testMetadata(token.AgeBracketOver18, now.Add(3*time.Hour))
+	blindedMsg, state, err := pbrsa.Blind(pk, msg, metadata, nil)
+	if err != nil {
+		t.Fatalf("Blind: %v", err)
+	}
+
+	rec := postSign(t, h, &SignRequest{
+		TokenType:  token.TokenTypeRSAPBSSASHA384,
+		TokenKeyID: base64.RawURLEncoding.EncodeToString(k.TokenKeyID[:]),
+		BlindedMsg: base64.RawURLEncoding.EncodeToString(blindedMsg),
+		Metadata:   base64.RawURLEncoding.EncodeToString(metadata),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", rec.Code, rec.Body)
+	}
+	if rec.Body.Len()%padding.BlockSize != 0 {
+		t.Errorf("response body length %d is not padded", rec.Body.Len())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control: got %q", cc)
+	}
+	var resp SignResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	blindSig, _ := base64.RawURLEncoding.DecodeString(resp.BlindSig)
+	sig, err := pbrsa.Finalize(pk, msg, metadata, blindSig, state.Inv)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if err := pbrsa.Verify(pk, msg, metadata, sig); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestServerSignRejectsInvalidRequests(t *testing.T) {
+	s, k, now := setupServer(t)
+	h := s.Handler()
+
+	kid := base64.RawURLEncoding.EncodeToString(k.TokenKeyID[:])
+	blinded := base64.RawURLEncoding.EncodeToString(make([]byte, 256))
+	meta := base64.RawURLEncoding.EncodeToString(testMetadata(token.AgeBracketOver18, now.Add(time.Hour)))
+	valid := SignRequest{TokenType: token.TokenTypeRSAPBSSASHA384, TokenKeyID: kid, BlindedMsg: blinded, Metadata: meta}
+
+	tests := []struct {
+		name string
+		mod  func(r *SignRequest)
+		code string
+	}{
+		{"reserved token_type", func(r *SignRequest) { r.TokenType = 0 }, ErrCodeUnsupportedTokenType},
+		{"unknown key", func(r *SignRequest) { r.TokenKeyID = base64.RawURLEncoding.EncodeToString(make([]byte, 32)) }, ErrCodeUnknownKey},
+		{"short token_key_id", func(r *SignRequest) { r.TokenKeyID = "AAAA" }, ErrCodeInvalidRequest},
+		{"short metadata", func(r *SignRequest) { r.Metadata = "AAAA" }, ErrCodeInvalidMetadata},
+		{"invalid age_bracket", func(r *SignRequest) {
+			r.Metadata = base64.RawURLEncoding.EncodeToString(testMetadata(4, now.Add(time.Hour)))
+		}, ErrCodeInvalidMetadata},
+		{"expired", func(r *SignRequest) {
+			r.Metadata = base64.RawURLEncoding.EncodeToString(testMetadata(token.AgeBracketOver18, now.Add(-time.Hour)))
+		}, ErrCodeInvalidMetadata},
+		{"beyond max TTL", func(r *SignRequest) {
+			r.Metadata = base64.RawURLEncoding.EncodeToString(testMetadata(token.AgeBracketOver18, now.Add(5*time.Hour)))
+		}, ErrCodeInvalidMetadata},
+		{"short blinded_msg", func(r *SignRequest) { r.BlindedMsg = "AAAA" }, ErrCodeInvalidRequest},
+		{"blinded_msg above modulus", func(r *SignRequest) {
+			r.BlindedMsg = base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{0xff}, 256))
+		}, ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		req := valid
+		tt.mod(&req)
+		rec := postSign(t, h, &req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", tt.name, rec.Code)
+			continue
+		}
+		if rec.Body.Len()%padding.BlockSize != 0 {
+			t.Errorf("%s: error body not padded", tt.name)
+		}
+		var resp ErrorResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.Error != tt.code {
+			t.Errorf("%s: error code %q, want %q", tt.name, resp.Error, tt.code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, SignPath, bytes.NewReader([]byte("not json"))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status %d", rec.Code)
+	}
+}
+
+func TestServerWellKnown(t *testing.T) {
+	s, k, _ := setupServer(t)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, WellKnownIssuerPath, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Errorf("Cache-Control: got %q", cc)
+	}
+	if acao := rec.Header().Get("Access-Control-Allow-Origin"); acao != "*" {
+		t.Errorf("Access-Control-Allow-Origin: got %q", acao)
+	}
+	var doc WellKnownIssuer
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.Issuer != "test-im.example" || doc.SigningEndpoint != "https://test-im.example"+SignPath {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if len(doc.Keys) != 1 {
+		t.Fatalf("keys: got %d", len(doc.Keys))
+	}
+	parsed, err := doc.Keys[0].ParseKey()
+	if err != nil || parsed.TokenKeyID != k.TokenKeyID {
+		t.Errorf("published key does not match: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, SignPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET %s: status %d", SignPath, rec.Code)
+	}
+}
+
+func TestServerSignBatch(t *testing.T) {
+	s, k, now := setupServer(t)
+	h := s.Handler()
+	pk := &k.PrivateKey.PublicKey
+
+	type blinded struct {
+		msg, metadata []byte
+		state         *pbrsa.BlindingState
+	}
+	var inputs []blinded
+	req := &SignRequest{
+		TokenType:  token.TokenTypeRSAPBSSASHA384,
+		TokenKeyID: base64.RawURLEncoding.EncodeToString(k.TokenKeyID[:]),
+	}
+	for i, bracket := range []uint8{token.AgeBracketUnder13, token.AgeBracketAge16_17, token.AgeBracketOver18} {
+		msg := []byte{byte(i), 'm', 's', 'g'}
+		metadata := testMetadata(bracket, now.Add(time.Duration(i+1)*time.Hour))
+		blindedMsg, state, err := pbrsa.Blind(pk, msg, metadata, nil)
+		if err != nil {
+			t.Fatalf("Blind: %v", err)
+		}
+		inputs = append(inputs, blinded{msg, metadata, state})
+		req.Items = append(req.Items, SignItem{
+			BlindedMsg: base64.RawURLEncoding.EncodeToString(blindedMsg),
+			Metadata:   base64.RawURLEncoding.EncodeToString(metadata),
+		})
+	}
+	// An item with metadata beyond the maximum TTL fails on its own.
+	req.Items = append(req.Items, SignItem{
+		BlindedMsg: req.Items[0].BlindedMsg,
+		Metadata:   base64.RawURLEncoding.EncodeToString(testMetadata(token.AgeBracketOver18, now.Add(5*time.Hour))),
+	})
+
+	rec := postSign(t, h, req)
+	if rec.Code != http.StatusOK || rec.Body.Len()%padding.BlockSize != 0 {
+		t.Fatalf("status %d, body length %d", rec.Code, rec.Body.Len())
+	}
+	var resp SignResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Items) != 4 || resp.BlindSig != "" {
+		t.Fatalf("unexpected response shape: %+v", resp)
+	}
+	for i, in := range inputs {
+		blindSig, _ := base64.RawURLEncoding.DecodeString(resp.Items[i].BlindSig)
+		sig, err := pbrsa.Finalize(pk, in.msg, in.metadata, blindSig, in.state.Inv)
+		if err != nil {
+			t.Fatalf("item %d: Finalize: %v (%s)", i, err, resp.Items[i].Error)
+		}
+		if err := pbrsa.Verify(pk, in.msg, in.metadata, sig); err != nil {
+			t.Errorf("item %d: Verify: %v", i, err)
+		}
+	}
+	if resp.Items[3].Error != ErrCodeInvalidMetadata || resp.Items[3].BlindSig != "" {
+		t.Errorf("invalid item: got %+v", resp.Items[3])
+	}
+
+	// Empty and oversized batches are rejected as a whole.
+	req.Items = []SignItem{}
+	if rec := postSign(t, h, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: status %d", rec.Code)
+	}
+	req.Items = make([]SignItem, MaxBatchSize+1)
+	if rec := postSign(t, h, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("oversized batch: status %d", rec.Code)
+	}
+}
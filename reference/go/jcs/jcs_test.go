@@ -0,0 +1,104 @@
+package jcs
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		// RFC 8785 section 3.2.2.
+		{
+			`{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001], "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "literals": [null, true, false]}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		// RFC 8785 section 3.2.3: UTF-16 order puts the surrogate pair of
+		// U+1F600 before U+FB33.
+		{
+			`{"\u20ac": 1, "\r": 2, "\ufb33": 3, "1": 4, "\ud83d\ude00": 5, "\u0080": 6, "\u00f6": 7}`,
+			"{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001f600\":5,\"\ufb33\":3}",
+		},
+		{` { "b" : [ 3 , { "z" : 1 , "a" : [ ] } ] , "a" : { } } `, `{"a":{},"b":[3,{"a":[],"z":1}]}`},
+		{`"<>&\u2028\t"`, "\"<>&\u2028\\t\""},
+		{`[-0, 1.0, 1e21, 1e-7, 9007199254740993]`, `[0,1,1e+21,1e-7,9007199254740992]`},
+		{`true`, `true`},
+	}
+	for _, tt := range tests {
+		got, err := Canonicalize([]byte(tt.in))
+		if err != nil {
+			t.Errorf("Canonicalize(%s): %v", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Canonicalize(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeRejects(t *testing.T) {
+	for _, in := range []string{
+		`{"a":1,"a":2}`,
+		`"\ud800"`,
+		`"\udc00\ud800"`,
+		`"\ud800\u0041"`,
+		`1e400`,
+		`01`,
+		`1.`,
+		`.5`,
+		`-`,
+		`[1,]`,
+		`{"a" 1}`,
+		`{"a":1,}`,
+		`[1] x`,
+		`NaN`,
+		`"a` + "\n" + `"`,
+		`"\x"`,
+		"\"\xff\"",
+		"",
+	} {
+		if _, err := Canonicalize([]byte(in)); !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("Canonicalize(%q) = %v, want ErrInvalidJSON", in, err)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	// RFC 8785 Appendix B.
+	for bits, want := range map[uint64]string{
+		0x0000000000000000: "0",
+		0x8000000000000000: "0",
+		0x0000000000000001: "5e-324",
+		0x8000000000000001: "-5e-324",
+		0x7fefffffffffffff: "1.7976931348623157e+308",
+		0x4340000000000000: "9007199254740992",
+		0x4430000000000000: "295147905179352830000",
+		0x44b52d02c7e14af6: "1e+23",
+		0x444b1ae4d6e2ef4f: "999999999999999900000",
+		0x444b1ae4d6e2ef50: "1e+21",
+		0x3eb0c6f7a0b5ed8c: "9.999999999999997e-7",
+		0x3eb0c6f7a0b5ed8d: "0.000001",
+		0x41b3de4355555554: "333333333.33333325",
+		0xbecbf647612f3696: "-0.0000033333333333333333",
+		0x43143ff3c1cb0959: "1424953923781206.2",
+	} {
+		if got, err := FormatNumber(math.Float64frombits(bits)); err != nil || got != want {
+			t.Errorf("FormatNumber(%016x) = %q, %v; want %q", bits, got, err, want)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := FormatNumber(f); err == nil {
+			t.Errorf("FormatNumber(%v) accepted", f)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	got, err := Marshal(map[string]any{"b": "<x>", "a": []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":[1,2],"b":"<x>"}` {
+		t.Errorf("Marshal = %s", got)
+	}
+}
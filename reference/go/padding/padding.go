@@ -0,0 +1,65 @@
+// Package padding implements the message padding of PROTOCOL.md section 4.5.2:
+// JSON bodies exchanged by AAVP endpoints are padded to a multiple of 2048
+// bytes with random characters in a "padding" field, which receivers ignore.
+package padding
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+)
+
+// BlockSize is the padding granularity in bytes (2 KiB).
+const BlockSize = 2048
+
+// Field is the JSON member that carries the padding.
+const Field = "padding"
+
+const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// ErrNotObject is returned when the body to pad is not a JSON object.
+var ErrNotObject = errors.New("padding: body is not a JSON object")
+
+// Marshal encodes v as JSON and pads the result with Pad.
+func Marshal(v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Pad(body)
+}
+
+// Pad appends a "padding" member with random base64url characters to a JSON
+// object so that its length becomes a multiple of BlockSize. The object must
+// not already contain a padding member.
+func Pad(body []byte) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' {
+		return nil, ErrNotObject
+	}
+	empty := len(bytes.TrimSpace(body[1:len(body)-1])) == 0
+
+	prefix := `,"` + Field + `":"`
+	if empty {
+		prefix = prefix[1:]
+	}
+	// body without '}' + prefix + n chars + `"}`
+	fixed := len(body) - 1 + len(prefix) + 2
+	n := (BlockSize - fixed%BlockSize) % BlockSize
+
+	fill := make([]byte, n)
+	if _, err := rand.Read(fill); err != nil {
+		return nil, err
+	}
+	for i := range fill {
+		fill[i] = alphabet[fill[i]&63]
+	}
+
+	out := make([]byte, 0, fixed+n)
+	out = append(out, body[:len(body)-1]...)
+	out = append(out, prefix...)
+	out = append(out, fill...)
+	out = append(out, `"}`...)
+	return out, nil
+}
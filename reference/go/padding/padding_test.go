@@ -0,0 +1,57 @@
+package padding
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPadToBlockSize(t *testing.T) {
+	for _, size := range []int{0, 1, 100, BlockSize - 14, BlockSize - 13, BlockSize - 12, BlockSize, 3000} {
+		v := map[string]string{"data": strings.Repeat("a", size)}
+		out, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if len(out)%BlockSize != 0 {
+			t.Errorf("size %d: padded length %d is not a multiple of %d", size, len(out), BlockSize)
+		}
+		var back map[string]string
+		if err := json.Unmarshal(out, &back); err != nil {
+			t.Fatalf("size %d: padded body is not valid JSON: %v", size, err)
+		}
+		if back["data"] != v["data"] {
+			t.Errorf("size %d: data altered by padding", size)
+		}
+	}
+}
+
+func TestPadEmptyObject(t *testing.T) {
+	out, err := Pad([]byte("{}"))
+	if err != nil {
+		t.Fatalf("Pad: %v", err)
+	}
+	if len(out) != BlockSize {
+		t.Errorf("length: got %d, want %d", len(out), BlockSize)
+	}
+	var back map[string]any
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+}
+
+func TestPadIsRandom(t *testing.T) {
+	a, _ := Pad([]byte(`{"x":1}`))
+	b, _ := Pad([]byte(`{"x":1}`))
+	if string(a) == string(b) {
+		t.Error("two paddings of the same body are identical")
+	}
+}
+
+func TestPadRejectsNonObject(t *testing.T) {
+	for _, body := range []string{"", "[]", `"x"`, "{"} {
+		if _, err := Pad([]byte(body)); err == nil {
+			t.Errorf("Pad(%q): expected error", body)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package ptl
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Log is an append-only Merkle tree over the leaves of a Storage, signing
+// its tree heads with an Ed25519 key. It is safe for concurrent use.
+//
+// The leaf hashes are kept in memory and proofs are computed from them, in
+// time linear in the size of the tree.
+type Log struct {
+	Storage Storage
+	Key     ed25519.PrivateKey
+	Now     func() time.Time
+
+	mu     sync.RWMutex
+	hashes []Hash
+	index  map[Hash]uint64
+}
+
+// NewLog creates a Log over storage, hashing the leaves it already holds.
+func NewLog(storage Storage, key ed25519.PrivateKey) (*Log, error) {
+	n, err := storage.Size()
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{Storage: storage, Key: key, Now: time.Now, index: make(map[Hash]uint64)}
+	for i := uint64(0); i < n; i++ {
+		leaf, err := storage.Leaf(i)
+		if err != nil {
+			return nil, fmt.Errorf("ptl: leaf %d: %w", i, err)
+		}
+		l.add(LeafHash(leaf))
+	}
+	return l, nil
+}
+
+// add records the hash of the next leaf. l.mu must be held.
+func (l *Log) add(h Hash) {
+	if _, ok := l.index[h]; !ok {
+		l.index[h] = uint64(len(l.hashes))
+	}
+	l.hashes = append(l.hashes, h)
+}
+
+// PublicKey returns the public key of the log.
+func (l *Log) PublicKey() ed25519.PublicKey {
+	return l.Key.Public().(ed25519.PublicKey)
+}
+
+// LogID returns the log_id of the log.
+func (l *Log) LogID() ([32]byte, error) {
+	return LogID(l.PublicKey())
+}
+
+// Append adds leaf to the log and returns its index.
+func (l *Log) Append(leaf []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, err := l.Storage.Append(leaf)
+	if err != nil {
+		return 0, err
+	}
+	if index != uint64(len(l.hashes)) {
+		return 0, fmt.Errorf("ptl: storage appended at %d, expected %d", index, len(l.hashes))
+	}
+	l.add(LeafHash(leaf))
+	return index, nil
+}
+
+// Size returns the number of leaves in the log.
+func (l *Log) Size() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return uint64(len(l.hashes))
+}
+
+// Leaf returns the leaf at index.
+func (l *Log) Leaf(index uint64) ([]byte, error) {
+	return l.Storage.Leaf(index)
+}
+
+// LeafIndex returns the index of the first leaf with hash h.
+func (l *Log) LeafIndex(h Hash) (uint64, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i, ok := l.index[h]
+	return i, ok
+}
+
+// Root returns the root hash of the tree formed by the first size leaves.
+func (l *Log) Root(size uint64) (Hash, error) {
+	leaves, err := l.prefix(size)
+	if err != nil {
+		return Hash{}, err
+	}
+	return RootHash(leaves), nil
+}
+
+// SignedTreeHead returns the current tree head signed by the log.
+func (l *Log) SignedTreeHead() *SignedTreeHead {
+	l.mu.RLock()
+	h := TreeHead{TreeSize: uint64(len(l.hashes)), RootHash: RootHash(l.hashes)}
+	l.mu.RUnlock()
+	h.Timestamp = l.Now()
+	return SignTreeHead(h, l.Key)
+}
+
+// VerifyTreeHead checks that sth was signed by the log and that the log still
+// holds the tree it describes: a log restarted over storage that lost or
+// changed entries fails.
+func (l *Log) VerifyTreeHead(sth *SignedTreeHead) error {
+	if err := sth.Verify(l.PublicKey()); err != nil {
+		return err
+	}
+	root, err := l.Root(sth.TreeSize)
+	if err != nil {
+		return fmt.Errorf("ptl: log has %d leaves, tree head has %d", l.Size(), sth.TreeSize)
+	}
+	if root != sth.RootHash {
+		return fmt.Errorf("ptl: root hash of the first %d leaves does not match the tree head", sth.TreeSize)
+	}
+	return nil
+}
+
+// InclusionProof returns the proof that the leaf at index is in the tree of
+// the given size.
+func (l *Log) InclusionProof(index, size uint64) ([]Hash, error) {
+	leaves, err := l.prefix(size)
+	if err != nil {
+		return nil, err
+	}
+	return InclusionProof(leaves, index)
+}
+
+// ConsistencyProof returns the proof that the tree of size1 is a prefix of
+// the tree of size2.
+func (l *Log) ConsistencyProof(size1, size2 uint64) ([]Hash, error) {
+	leaves, err := l.prefix(size2)
+	if err != nil {
+		return nil, err
+	}
+	return ConsistencyProof(leaves, size1)
+}
+
+// prefix returns the hashes of the first size leaves. The returned slice is
+// never modified: appends only write past its length.
+func (l *Log) prefix(size uint64) ([]Hash, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if size > uint64(len(l.hashes)) {
+		return nil, ErrOutOfRange
+	}
+	return l.hashes[:size:size], nil
+}
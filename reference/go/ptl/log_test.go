@@ -0,0 +1,133 @@
+package ptl
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestLog(t *testing.T, s Storage) *Log {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLog(s, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Now = func() time.Time { return now }
+	return l
+}
+
+func TestLog(t *testing.T) {
+	l := newTestLog(t, NewMemoryStorage())
+	first := l.SignedTreeHead()
+	if first.TreeSize != 0 || first.RootHash != EmptyRoot() {
+		t.Fatalf("empty tree head = %+v", first)
+	}
+	for i, leaf := range testLeaves {
+		if index, err := l.Append(leaf); err != nil || index != uint64(i) {
+			t.Fatalf("Append = %d, %v", index, err)
+		}
+	}
+
+	sth := l.SignedTreeHead()
+	if err := sth.Verify(l.PublicKey()); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if sth.TreeSize != 8 || sth.RootHash != RootHash(hashes(testLeaves)) {
+		t.Errorf("tree head = %+v", sth)
+	}
+	data, err := json.Marshal(sth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back SignedTreeHead
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal %s: %v", data, err)
+	}
+	if err := back.Verify(l.PublicKey()); err != nil {
+		t.Errorf("Verify after JSON round trip: %v", err)
+	}
+	back.TreeSize--
+	if err := back.Verify(l.PublicKey()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify of a modified tree head: %v", err)
+	}
+
+	index, ok := l.LeafIndex(LeafHash(testLeaves[5]))
+	if !ok || index != 5 {
+		t.Fatalf("LeafIndex = %d, %v", index, ok)
+	}
+	proof, err := l.InclusionProof(index, sth.TreeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyInclusion(LeafHash(testLeaves[5]), index, sth.TreeSize, proof, sth.RootHash); err != nil {
+		t.Errorf("VerifyInclusion: %v", err)
+	}
+	root3, _ := l.Root(3)
+	proof, err = l.ConsistencyProof(3, sth.TreeSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyConsistency(3, sth.TreeSize, root3, sth.RootHash, proof); err != nil {
+		t.Errorf("VerifyConsistency: %v", err)
+	}
+	if _, err := l.InclusionProof(0, 9); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("proof for a future tree size: %v", err)
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	s, err := OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestLog(t, s)
+	for _, leaf := range testLeaves {
+		if _, err := l.Append(leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, _ := l.Root(l.Size())
+	s.Close()
+
+	// A partial record from an interrupted append is discarded on open.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	s, err = OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	reopened, err := NewLog(s, l.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.Root(reopened.Size()); reopened.Size() != 8 || got != root {
+		t.Fatalf("reopened log: size %d, root %x", reopened.Size(), got)
+	}
+	if leaf, err := reopened.Leaf(7); err != nil || string(leaf) != string(testLeaves[7]) {
+		t.Errorf("Leaf(7) = %x, %v", leaf, err)
+	}
+	if index, err := reopened.Append([]byte("next")); err != nil || index != 8 {
+		t.Errorf("Append after reopen = %d, %v", index, err)
+	}
+	if _, err := s.Append(make([]byte, MaxLeafSize+1)); !errors.Is(err, ErrLeafTooLarge) {
+		t.Errorf("oversized leaf: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Package ptl implements the core of a Policy Transparency Log (PROTOCOL.md
+// section 8.3): an append-only Merkle tree hashed as in RFC 9162 section
+// 2.1, signed tree heads, and the inclusion and consistency proofs that log
+// operators must provide and that monitors and DAs verify.
+//
+// The Merkle tree and Log are independent of what the leaves hold. On top of
+// them, Entry and the Signed Policy Timestamps (IssueSPT, VerifySPT) define
+// the SPD log, and Server exposes it over HTTP.
+package ptl
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// HashSize is the size of the tree hashes (SHA-256).
+const HashSize = sha256.Size
+
+// Hash is a Merkle tree hash.
+type Hash [HashSize]byte
+
+// Proof errors.
+var (
+	ErrInvalidProof = errors.New("ptl: invalid proof")
+	ErrOutOfRange   = errors.New("ptl: index or tree size out of range")
+)
+
+// LeafHash returns the hash of a leaf: SHA-256(0x00 || leaf).
+func LeafHash(leaf []byte) Hash {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(leaf)
+	var out Hash
+	h.Sum(out[:0])
+	return out
+}
+
+// NodeHash returns the hash of an interior node: SHA-256(0x01 || left ||
+// right).
+func NodeHash(left, right Hash) Hash {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left[:])
+	h.Write(right[:])
+	var out Hash
+	h.Sum(out[:0])
+	return out
+}
+
+// EmptyRoot is the root hash of the empty tree: SHA-256 of the empty string.
+func EmptyRoot() Hash {
+	return sha256.Sum256(nil)
+}
+
+// RootHash returns the Merkle Tree Hash of the leaves with the given leaf
+// hashes (MTH in RFC 9162 section 2.1.1).
+func RootHash(leaves []Hash) Hash {
+	if len(leaves) == 0 {
+		return EmptyRoot()
+	}
+	return mth(leaves)
+}
+
+func mth(leaves []Hash) Hash {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return NodeHash(mth(leaves[:k]), mth(leaves[k:]))
+}
+
+// split returns the largest power of two smaller than n, for n > 1.
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// InclusionProof returns the audit path of the leaf at index in the tree
+// formed by leaves (PATH in RFC 9162 section 2.1.3.1).
+func InclusionProof(leaves []Hash, index uint64) ([]Hash, error) {
+	if index >= uint64(len(leaves)) {
+		return nil, ErrOutOfRange
+	}
+	return path(index, leaves), nil
+}
+
+func path(m uint64, leaves []Hash) []Hash {
+	n := uint64(len(leaves))
+	if n == 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(path(m, leaves[:k]), mth(leaves[k:]))
+	}
+	return append(path(m-k, leaves[k:]), mth(leaves[:k]))
+}
+
+// ConsistencyProof returns the proof that the tree formed by the first size1
+// leaves is a prefix of the tree formed by leaves (PROOF in RFC 9162 section
+// 2.1.4.1). The proof is empty if size1 is 0 or the whole tree.
+func ConsistencyProof(leaves []Hash, size1 uint64) ([]Hash, error) {
+	n := uint64(len(leaves))
+	if size1 > n {
+		return nil, ErrOutOfRange
+	}
+	if size1 == 0 || size1 == n {
+		return nil, nil
+	}
+	return subproof(size1, leaves, true), nil
+}
+
+func subproof(m uint64, leaves []Hash, complete bool) []Hash {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{mth(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), mth(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), mth(leaves[:k]))
+}
+
+// VerifyInclusion checks that leafHash is the leaf at index of the tree of
+// the given size and root (RFC 9162 section 2.1.3.2).
+func VerifyInclusion(leafHash Hash, index, size uint64, proof []Hash, root Hash) error {
+	if index >= size {
+		return ErrOutOfRange
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || r != root {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of size1 with root1 is a prefix of
+// the tree of size2 with root2 (RFC 9162 section 2.1.4.2).
+func VerifyConsistency(size1, size2 uint64, root1, root2 Hash, proof []Hash) error {
+	switch {
+	case size1 > size2:
+		return ErrOutOfRange
+	case size1 == size2:
+		if len(proof) != 0 || root1 != root2 {
+			return ErrInvalidProof
+		}
+		return nil
+	case size1 == 0:
+		if len(proof) != 0 || root1 != EmptyRoot() {
+			return ErrInvalidProof
+		}
+		return nil
+	case len(proof) == 0:
+		return ErrInvalidProof
+	}
+
+	if size1&(size1-1) == 0 {
+		proof = append([]Hash{root1}, proof...)
+	}
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || fr != root1 || sr != root2 {
+		return ErrInvalidProof
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package ptl
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// testLeaves are the leaves of the RFC 6962 reference test data.
+var testLeaves = [][]byte{
+	{},
+	{0x00},
+	{0x10},
+	{0x20, 0x21},
+	{0x30, 0x31},
+	{0x40, 0x41, 0x42, 0x43},
+	{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57},
+	{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f},
+}
+
+// testRoots are the expected root hashes of the first 1..8 testLeaves.
+var testRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func hashes(leaves [][]byte) []Hash {
+	out := make([]Hash, len(leaves))
+	for i, l := range leaves {
+		out[i] = LeafHash(l)
+	}
+	return out
+}
+
+func TestRootHash(t *testing.T) {
+	if got := RootHash(nil); hex.EncodeToString(got[:]) != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("empty root = %x", got)
+	}
+	h := hashes(testLeaves)
+	for i, want := range testRoots {
+		if got := RootHash(h[:i+1]); hex.EncodeToString(got[:]) != want {
+			t.Errorf("root of %d leaves = %x, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestProofs(t *testing.T) {
+	var leaves [][]byte
+	for i := range 33 {
+		leaves = append(leaves, []byte{byte(i), 0xaa})
+	}
+	h := hashes(leaves)
+	for n := uint64(1); n <= uint64(len(h)); n++ {
+		root := RootHash(h[:n])
+		for i := uint64(0); i < n; i++ {
+			proof, err := InclusionProof(h[:n], i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyInclusion(h[i], i, n, proof, root); err != nil {
+				t.Fatalf("inclusion of %d in %d: %v", i, n, err)
+			}
+			if err := VerifyInclusion(h[(i+1)%n], i, n, proof, root); n > 1 && err == nil {
+				t.Fatalf("inclusion of %d in %d accepted the wrong leaf", i, n)
+			}
+			if len(proof) > 0 {
+				if err := VerifyInclusion(h[i], i, n, proof[:len(proof)-1], root); err == nil {
+					t.Fatalf("inclusion of %d in %d accepted a truncated proof", i, n)
+				}
+			}
+		}
+		for m := uint64(0); m <= n; m++ {
+			proof, err := ConsistencyProof(h[:n], m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyConsistency(m, n, RootHash(h[:m]), root, proof); err != nil {
+				t.Fatalf("consistency %d -> %d: %v", m, n, err)
+			}
+			if 0 < m && m < n {
+				if err := VerifyConsistency(m, n, RootHash(h[1:m+1]), root, proof); err == nil {
+					t.Fatalf("consistency %d -> %d accepted another first root", m, n)
+				}
+				if err := VerifyConsistency(m, n, RootHash(h[:m]), RootHash(h[1:n]), proof); err == nil {
+					t.Fatalf("consistency %d -> %d accepted another second root", m, n)
+				}
+			}
+		}
+	}
+
+	if _, err := InclusionProof(h[:4], 4); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("InclusionProof out of range: %v", err)
+	}
+	if err := VerifyConsistency(5, 4, Hash{}, Hash{}, nil); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("VerifyConsistency with size1 > size2: %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package ptl
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+// Endpoints of the log API. Submissions are POSTed to AddSPDPath; the other
+// endpoints are read with GET.
+const (
+	AddSPDPath      = "/ptl/v1/add-spd"
+	STHPath         = "/ptl/v1/get-sth"
+	ConsistencyPath = "/ptl/v1/get-sth-consistency" // ?first=&second=
+	ProofByHashPath = "/ptl/v1/get-proof-by-hash"   // ?hash=&tree_size=
+	ProofBySPDPath  = "/ptl/v1/get-proof-by-spd"    // ?spd_hash=&tree_size=
+	EntriesPath     = "/ptl/v1/get-entries"         // ?start=&end=, inclusive
+	InfoPath        = "/ptl/v1/get-log-info"
+)
+
+// MaxSPDSize is the largest SPD accepted for registration.
+const MaxSPDSize = 64 << 10
+
+// MaxEntries is the largest number of entries returned by EntriesPath.
+const MaxEntries = 100
+
+// MinRetention is the minimum time a log keeps its entries (PROTOCOL.md
+// section 8.3.3): two years.
+const MinRetention = 2 * 365 * 24 * time.Hour
+
+// Error codes returned by the log API.
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeInvalidSPD       = "invalid_spd"
+	ErrCodeInvalidSignature = "invalid_signature"
+	ErrCodeUnknownPlatform  = "unknown_platform"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeInternal         = "internal_error"
+)
+
+// ErrUnknownPlatform is returned by a VGKeyFunc for platforms it has no VG
+// key for.
+var ErrUnknownPlatform = errors.New("ptl: unknown platform")
+
+// ErrShortRetention is returned for retention periods below MinRetention.
+var ErrShortRetention = errors.New("ptl: retention shorter than 2 years")
+
+// VGKeyFunc returns the VG key that signs the SPDs of platform. The
+// .well-known/aavp document does not carry it, so the log operator
+// configures where it comes from.
+type VGKeyFunc func(ctx context.Context, platform string) (*rsa.PublicKey, error)
+
+// StaticVGKeys returns a VGKeyFunc backed by a fixed platform to key map.
+func StaticVGKeys(keys map[string]*rsa.PublicKey) VGKeyFunc {
+	return func(_ context.Context, platform string) (*rsa.PublicKey, error) {
+		if pub, ok := keys[platform]; ok {
+			return pub, nil
+		}
+		return nil, ErrUnknownPlatform
+	}
+}
+
+// ErrorResponse is the body of API error responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ProofResponse is the body of ProofByHashPath and ProofBySPDPath
+// responses. ProofBySPDPath looks the entry up by spd.ContentHash and
+// returns it in Entry, since its leaf hash cannot be derived from the SPD as
+// served.
+type ProofResponse struct {
+	LeafIndex uint64 `json:"leaf_index"`
+	AuditPath []Hash `json:"audit_path"`
+	Entry     *Entry `json:"entry,omitempty"`
+}
+
+// ConsistencyResponse is the body of ConsistencyPath responses.
+type ConsistencyResponse struct {
+	Consistency []Hash `json:"consistency"`
+}
+
+// EntriesResponse is the body of EntriesPath responses. The leaf of each
+// entry is Entry.Leaf.
+type EntriesResponse struct {
+	Entries []*Entry `json:"entries"`
+}
+
+// LogInfo is the body of InfoPath responses. PublicKey is the SPKI DER
+// encoding of the log key and Retention an ISO 8601 duration, both as
+// published by the operator.
+type LogInfo struct {
+	LogID     string `json:"log_id"`
+	PublicKey string `json:"public_key"`
+	Retention string `json:"retention"`
+}
+
+// Server registers SPDs in a Log and serves the log API. Entries are never
+// removed: the log keeps them for at least Retention, which is published
+// in the log info and may not be shorter than MinRetention.
+type Server struct {
+	Log       *Log
+	VGKey     VGKeyFunc
+	Retention time.Duration
+
+	// OnAppend, if set, is called with the tree head signed after each new
+	// entry, for instance to persist it.
+	OnAppend func(*SignedTreeHead)
+
+	mu    sync.Mutex
+	index map[[32]byte]uint64 // spd.ContentHash to leaf index
+}
+
+// NewServer creates a Server over log with a retention of MinRetention,
+// indexing the entries the log already holds.
+func NewServer(log *Log, vgKey VGKeyFunc) (*Server, error) {
+	s := &Server{Log: log, VGKey: vgKey, Retention: MinRetention, index: make(map[[32]byte]uint64)}
+	for i := uint64(0); i < log.Size(); i++ {
+		leaf, err := log.Leaf(i)
+		if err != nil {
+			return nil, fmt.Errorf("ptl: leaf %d: %w", i, err)
+		}
+		e, err := ParseEntry(leaf)
+		if err != nil {
+			return nil, fmt.Errorf("ptl: leaf %d: %w", i, err)
+		}
+		h, err := spd.ContentHash(e.SPD)
+		if err != nil {
+			return nil, fmt.Errorf("ptl: leaf %d: %w", i, err)
+		}
+		if _, ok := s.index[h]; !ok {
+			s.index[h] = i
+		}
+	}
+	return s, nil
+}
+
+// Submit registers the SPD data and returns its SPT. The document must be
+// valid and signed with the VG key of its platform. An SPD whose content is
+// already in the log, with or without SPTs, gets the SPT of its existing
+// entry.
+func (s *Server) Submit(ctx context.Context, data []byte) (*spd.SPT, error) {
+	d, err := spd.Parse(data, "")
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.VGKey(ctx, d.Platform)
+	if err != nil {
+		return nil, err
+	}
+	if err := spd.Verify(data, pub); err != nil {
+		return nil, err
+	}
+	h, err := spd.ContentHash(data)
+	if err != nil {
+		return nil, err
+	}
+	logID, err := s.Log.LogID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.index[h]; ok {
+		leaf, err := s.Log.Leaf(i)
+		if err != nil {
+			return nil, err
+		}
+		e, err := ParseEntry(leaf)
+		if err != nil {
+			return nil, err
+		}
+		return e.SPT(logID), nil
+	}
+	spt, err := IssueSPT(s.Log.Key, data, s.Log.Now())
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEntry(data, spt)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := e.Leaf()
+	if err != nil {
+		return nil, err
+	}
+	i, err := s.Log.Append(leaf)
+	if err != nil {
+		return nil, err
+	}
+	s.index[h] = i
+	if s.OnAppend != nil {
+		s.OnAppend(s.Log.SignedTreeHead())
+	}
+	return spt, nil
+}
+
+// Info returns the log info, checking that Retention is at least
+// MinRetention.
+func (s *Server) Info() (*LogInfo, error) {
+	if s.Retention < MinRetention {
+		return nil, ErrShortRetention
+	}
+	logID, err := s.Log.LogID()
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(s.Log.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("ptl: %w", err)
+	}
+	return &LogInfo{
+		LogID:     base64.RawURLEncoding.EncodeToString(logID[:]),
+		PublicKey: base64.RawURLEncoding.EncodeToString(der),
+		Retention: "P" + strconv.FormatInt(int64(s.Retention/(24*time.Hour)), 10) + "D",
+	}, nil
+}
+
+// Handler returns the HTTP handler of the log API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+AddSPDPath, s.handleAddSPD)
+	mux.HandleFunc("GET "+STHPath, s.handleSTH)
+	mux.HandleFunc("GET "+ConsistencyPath, s.handleConsistency)
+	mux.HandleFunc("GET "+ProofByHashPath, s.handleProofByHash)
+	mux.HandleFunc("GET "+ProofBySPDPath, s.handleProofBySPD)
+	mux.HandleFunc("GET "+EntriesPath, s.handleEntries)
+	mux.HandleFunc("GET "+InfoPath, s.handleInfo)
+	return mux
+}
+
+func (s *Server) handleAddSPD(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxSPDSize+1))
+	if err != nil || len(body) > MaxSPDSize {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	spt, err := s.Submit(r.Context(), body)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, spt)
+	case errors.Is(err, spd.ErrInvalidDocument):
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidSPD)
+	case errors.Is(err, spd.ErrMissingSignature), errors.Is(err, spd.ErrInvalidSignature), errors.Is(err, spd.ErrWeakKey):
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidSignature)
+	case errors.Is(err, ErrUnknownPlatform):
+		writeError(w, http.StatusForbidden, ErrCodeUnknownPlatform)
+	default:
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+	}
+}
+
+func (s *Server) handleSTH(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Log.SignedTreeHead())
+}
+
+func (s *Server) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	first, err1 := queryUint(r, "first")
+	second, err2 := queryUint(r, "second")
+	if err1 != nil || err2 != nil || first > second {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	proof, err := s.Log.ConsistencyProof(first, second)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, &ConsistencyResponse{Consistency: nonNil(proof)})
+}
+
+func (s *Server) handleProofByHash(w http.ResponseWriter, r *http.Request) {
+	var h Hash
+	if err := h.UnmarshalText([]byte(r.URL.Query().Get("hash"))); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	size, err := queryUint(r, "tree_size")
+	if err != nil || size > s.Log.Size() {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	i, ok := s.Log.LeafIndex(h)
+	if !ok || i >= size {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound)
+		return
+	}
+	proof, err := s.Log.InclusionProof(i, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+		return
+	}
+	writeJSON(w, http.StatusOK, &ProofResponse{LeafIndex: i, AuditPath: nonNil(proof)})
+}
+
+func (s *Server) handleProofBySPD(w http.ResponseWriter, r *http.Request) {
+	var h Hash
+	if err := h.UnmarshalText([]byte(r.URL.Query().Get("spd_hash"))); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	size, err := queryUint(r, "tree_size")
+	if err != nil || size > s.Log.Size() {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	s.mu.Lock()
+	i, ok := s.index[h]
+	s.mu.Unlock()
+	if !ok || i >= size {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound)
+		return
+	}
+	leaf, err := s.Log.Leaf(i)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+		return
+	}
+	e, err := ParseEntry(leaf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+		return
+	}
+	proof, err := s.Log.InclusionProof(i, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+		return
+	}
+	writeJSON(w, http.StatusOK, &ProofResponse{LeafIndex: i, AuditPath: nonNil(proof), Entry: e})
+}
+
+func (s *Server) handleEntries(w http.ResponseWriter, r *http.Request) {
+	start, err1 := queryUint(r, "start")
+	end, err2 := queryUint(r, "end")
+	if err1 != nil || err2 != nil || start > end {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest)
+		return
+	}
+	size := s.Log.Size()
+	if start >= size {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound)
+		return
+	}
+	end = min(end, size-1, start+MaxEntries-1)
+	resp := &EntriesResponse{Entries: make([]*Entry, 0, end-start+1)}
+	for i := start; i <= end; i++ {
+		leaf, err := s.Log.Leaf(i)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+			return
+		}
+		e, err := ParseEntry(leaf)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+			return
+		}
+		resp.Entries = append(resp.Entries, e)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := s.Info()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func queryUint(r *http.Request, name string) (uint64, error) {
+	return strconv.ParseUint(r.URL.Query().Get(name), 10, 64)
+}
+
+// nonNil makes empty proofs encode as [] rather than null.
+func nonNil(proof []Hash) []Hash {
+	if proof == nil {
+		return []Hash{}
+	}
+	return proof
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, &ErrorResponse{Error: code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// PublicKeyFromInfo decodes the log key published in info.
+func PublicKeyFromInfo(info *LogInfo) (ed25519.PublicKey, error) {
+	der, err := base64.RawURLEncoding.DecodeString(info.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("ptl: invalid public key: %w", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("ptl: invalid public key: %w", err)
+	}
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("ptl: log key is not Ed25519")
+	}
+	return key, nil
+}
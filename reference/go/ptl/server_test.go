@@ -0,0 +1,303 @@
+package ptl
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+const testSPD = `{
+  "spd_version": "1.0",
+  "platform": "example.com",
+  "published": "2026-02-01T00:00:00Z",
+  "taxonomy_version": "aavp-content-taxonomy-v1",
+  "segmentation": {
+    "UNDER_13": {"restricted": ["explicit-sexual", "violence-graphic", "gambling", "substances", "self-harm"], "adapted": ["profanity"]},
+    "AGE_13_15": {"restricted": ["explicit-sexual", "violence-graphic", "gambling"]},
+    "AGE_16_17": {"restricted": ["explicit-sexual"]},
+    "OVER_18": {"unrestricted": ["*"]}
+  },
+  "policy_url": "https://example.com/age-policy",
+  "signature": "c2lnbmF0dXJl"
+}`
+
+// signedSPD returns testSPD with the given policy_url, signed with key.
+func signedSPD(t *testing.T, key *rsa.PrivateKey, policyURL string) []byte {
+	t.Helper()
+	d, err := spd.Parse([]byte(testSPD), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.PolicyURL = policyURL
+	if err := d.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newTestServer(t *testing.T) (*Server, *rsa.PrivateKey) {
+	t.Helper()
+	vg, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(newTestLog(t, NewMemoryStorage()), StaticVGKeys(map[string]*rsa.PublicKey{"example.com": &vg.PublicKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, vg
+}
+
+func TestSubmit(t *testing.T) {
+	s, vg := newTestServer(t)
+	ctx := context.Background()
+	data := signedSPD(t, vg, "https://example.com/age-policy")
+
+	spt, err := s.Submit(ctx, data)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if spt.Timestamp != "2026-03-01T12:00:00Z" {
+		t.Errorf("timestamp = %s", spt.Timestamp)
+	}
+	if err := VerifySPT(spt, data, s.Log.PublicKey()); err != nil {
+		t.Fatalf("VerifySPT: %v", err)
+	}
+	if s.Log.Size() != 1 {
+		t.Fatalf("log size = %d", s.Log.Size())
+	}
+
+	// The SPT stays valid once the platform adds it to its SPD and signs
+	// again, and submitting that document returns the same SPT.
+	d, _ := spd.Parse(data, "")
+	d.SPTs = []spd.SPT{*spt}
+	if err := d.Sign(vg); err != nil {
+		t.Fatal(err)
+	}
+	withSPT, _ := json.Marshal(d)
+	if err := VerifySPT(spt, withSPT, s.Log.PublicKey()); err != nil {
+		t.Errorf("VerifySPT of the SPD with its SPT: %v", err)
+	}
+	again, err := s.Submit(ctx, withSPT)
+	if err != nil || *again != *spt || s.Log.Size() != 1 {
+		t.Errorf("resubmission = %+v, %v, size %d", again, err, s.Log.Size())
+	}
+
+	// A changed policy is a new entry whose SPT does not verify the old one.
+	changed := signedSPD(t, vg, "https://example.com/new-policy")
+	spt2, err := s.Submit(ctx, changed)
+	if err != nil || s.Log.Size() != 2 {
+		t.Fatalf("Submit changed = %v, size %d", err, s.Log.Size())
+	}
+	if err := VerifySPT(spt2, data, s.Log.PublicKey()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySPT of another SPD = %v", err)
+	}
+	other := newTestLog(t, NewMemoryStorage())
+	if err := VerifySPT(spt2, changed, other.PublicKey()); !errors.Is(err, ErrLogIDMismatch) {
+		t.Errorf("VerifySPT with another log key = %v", err)
+	}
+
+	// A restarted server indexes the entries it already holds.
+	restarted, err := NewServer(s.Log, s.VGKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := restarted.Submit(ctx, data); err != nil || *again != *spt || s.Log.Size() != 2 {
+		t.Errorf("resubmission after restart = %+v, %v", again, err)
+	}
+}
+
+func TestSubmitRejects(t *testing.T) {
+	s, vg := newTestServer(t)
+	ctx := context.Background()
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := signedSPD(t, vg, "https://example.com/age-policy")
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"invalid", []byte(`{"spd_version":"1.0"}`), spd.ErrInvalidDocument},
+		{"wrong key", signedSPD(t, other, "https://example.com/age-policy"), spd.ErrInvalidSignature},
+		{"tampered", bytes.Replace(data, []byte("age-policy"), []byte("age-policy-2"), 1), spd.ErrInvalidSignature},
+		{"unknown platform", bytes.Replace([]byte(testSPD), []byte(`"example.com"`), []byte(`"other.example"`), 1), ErrUnknownPlatform},
+	}
+	for _, tt := range tests {
+		if _, err := s.Submit(ctx, tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Submit = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if s.Log.Size() != 0 {
+		t.Errorf("log size = %d", s.Log.Size())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s, vg := newTestServer(t)
+	var appended []*SignedTreeHead
+	s.OnAppend = func(sth *SignedTreeHead) { appended = append(appended, sth) }
+	h := s.Handler()
+
+	do := func(method, target string, body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewReader(body)))
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var info LogInfo
+	decode(do("GET", InfoPath, nil), &info)
+	pub, err := PublicKeyFromInfo(&info)
+	if err != nil || !pub.Equal(s.Log.PublicKey()) || info.Retention != "P730D" {
+		t.Fatalf("log info = %+v, %v", info, err)
+	}
+
+	var docs [][]byte
+	var spts []spd.SPT
+	for i := range 3 {
+		data := signedSPD(t, vg, fmt.Sprintf("https://example.com/policy-%d", i))
+		var spt spd.SPT
+		decode(do("POST", AddSPDPath, data), &spt)
+		if spt.LogID != info.LogID {
+			t.Errorf("SPT log_id = %s, want %s", spt.LogID, info.LogID)
+		}
+		docs = append(docs, data)
+		spts = append(spts, spt)
+	}
+	if len(appended) != 3 || appended[2].TreeSize != 3 {
+		t.Errorf("OnAppend called with %d tree heads", len(appended))
+	}
+
+	var sth SignedTreeHead
+	decode(do("GET", STHPath, nil), &sth)
+	if err := sth.Verify(pub); err != nil || sth.TreeSize != 3 {
+		t.Fatalf("STH = %+v, %v", sth, err)
+	}
+
+	var entries EntriesResponse
+	decode(do("GET", EntriesPath+"?start=1&end=5", nil), &entries)
+	if len(entries.Entries) != 2 {
+		t.Fatalf("got %d entries", len(entries.Entries))
+	}
+	e := entries.Entries[0]
+	logID, _ := LogID(pub)
+	if err := VerifySPT(e.SPT(logID), docs[1], pub); err != nil {
+		t.Errorf("VerifySPT of entry 1: %v", err)
+	}
+
+	// The entry holds the SPD as submitted, VG signature included, and its
+	// leaf hash can be derived from it.
+	if err := spd.Verify(e.SPD, &vg.PublicKey); err != nil {
+		t.Errorf("VG signature of entry 1: %v", err)
+	}
+	leafHash, err := SPDLeafHash(docs[1], &spts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := e.Leaf(); LeafHash(leaf) != leafHash {
+		t.Error("leaf hash of the submitted SPD differs from the logged entry")
+	}
+	var proof ProofResponse
+	decode(do("GET", ProofByHashPath+"?tree_size=3&hash="+hashText(leafHash), nil), &proof)
+	if err := VerifyInclusion(leafHash, proof.LeafIndex, 3, proof.AuditPath, sth.RootHash); err != nil || proof.LeafIndex != 1 {
+		t.Errorf("inclusion proof = %+v, %v", proof, err)
+	}
+
+	// A DA holds the SPD as served, with the SPT added and signed again, and
+	// requests the proof from it alone.
+	d, _ := spd.Parse(docs[1], "")
+	d.SPTs = []spd.SPT{spts[1]}
+	if err := d.Sign(vg); err != nil {
+		t.Fatal(err)
+	}
+	served, _ := json.Marshal(d)
+	contentHash, _ := spd.ContentHash(served)
+	var spdProof ProofResponse
+	decode(do("GET", ProofBySPDPath+"?tree_size=3&spd_hash="+hashText(contentHash), nil), &spdProof)
+	if err := VerifySPDProof(served, &spts[1], &spdProof, 3, sth.RootHash); err != nil || spdProof.LeafIndex != 1 {
+		t.Errorf("inclusion proof of the served SPD = %+v, %v", spdProof, err)
+	}
+	if err := VerifySPDProof(docs[0], &spts[1], &spdProof, 3, sth.RootHash); !errors.Is(err, ErrInvalidEntry) {
+		t.Errorf("proof checked against another SPD = %v", err)
+	}
+
+	var consistency ConsistencyResponse
+	decode(do("GET", ConsistencyPath+"?first=1&second=3", nil), &consistency)
+	if err := VerifyConsistency(1, 3, appended[0].RootHash, sth.RootHash, consistency.Consistency); err != nil {
+		t.Errorf("consistency proof: %v", err)
+	}
+
+	for _, tt := range []struct {
+		method, target string
+		body           []byte
+		status         int
+		code           string
+	}{
+		{"POST", AddSPDPath, []byte("{"), http.StatusBadRequest, ErrCodeInvalidSPD},
+		{"POST", AddSPDPath, bytes.Replace(docs[0], []byte("policy-0"), []byte("policy-9"), 1), http.StatusBadRequest, ErrCodeInvalidSignature},
+		{"POST", AddSPDPath, bytes.Repeat([]byte(" "), MaxSPDSize+1), http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"GET", EntriesPath + "?start=3&end=4", nil, http.StatusNotFound, ErrCodeNotFound},
+		{"GET", EntriesPath + "?start=2&end=1", nil, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"GET", ProofByHashPath + "?tree_size=1&hash=" + hashText(leafHash), nil, http.StatusNotFound, ErrCodeNotFound},
+		{"GET", ProofByHashPath + "?tree_size=4&hash=" + hashText(leafHash), nil, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"GET", ProofByHashPath + "?tree_size=3&hash=abc", nil, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"GET", ConsistencyPath + "?first=1&second=4", nil, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"GET", ProofBySPDPath + "?tree_size=1&spd_hash=" + hashText(contentHash), nil, http.StatusNotFound, ErrCodeNotFound},
+		{"GET", ProofBySPDPath + "?tree_size=3&spd_hash=" + hashText(leafHash), nil, http.StatusNotFound, ErrCodeNotFound},
+		{"GET", ProofBySPDPath + "?tree_size=4&spd_hash=" + hashText(contentHash), nil, http.StatusBadRequest, ErrCodeInvalidRequest},
+	} {
+		rec := do(tt.method, tt.target, tt.body)
+		var resp ErrorResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != tt.status || resp.Error != tt.code {
+			t.Errorf("%s %.60s = %d %q, want %d %q", tt.method, tt.target, rec.Code, resp.Error, tt.status, tt.code)
+		}
+	}
+	if rec := do("GET", AddSPDPath, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET %s = %d", AddSPDPath, rec.Code)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Retention = MinRetention - 24*time.Hour
+	if _, err := s.Info(); !errors.Is(err, ErrShortRetention) {
+		t.Errorf("Info with a short retention = %v", err)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", InfoPath, nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("log info with a short retention = %d", rec.Code)
+	}
+}
+
+func hashText(h Hash) string {
+	text, _ := h.MarshalText()
+	return string(text)
+}
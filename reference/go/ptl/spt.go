@@ -0,0 +1,170 @@
+package ptl
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/jcs"
+	"github.com/aavp-protocol/aavp-go/spd"
+)
+
+// ErrLogIDMismatch is returned when an SPT was not issued by the log whose
+// key it is verified with.
+var ErrLogIDMismatch = errors.New("ptl: SPT log_id does not match the log key")
+
+// ErrInvalidEntry is returned for leaves that are not log entries.
+var ErrInvalidEntry = errors.New("ptl: invalid log entry")
+
+// sptContext separates SPT signatures from tree head signatures.
+const sptContext = "AAVP-PTL-SPT-v1\x00"
+
+// sptSignedData returns the bytes covered by an SPT signature: a context
+// string, the timestamp in Unix seconds as a big-endian uint64 and
+// spd.ContentHash of the SPD, which leaves out signature and spts so that
+// the SPT stays valid once the platform adds it to its SPD.
+func sptSignedData(timestamp time.Time, contentHash [32]byte) []byte {
+	b := make([]byte, 0, len(sptContext)+8+len(contentHash))
+	b = append(b, sptContext...)
+	b = binary.BigEndian.AppendUint64(b, uint64(timestamp.Unix()))
+	return append(b, contentHash[:]...)
+}
+
+// IssueSPT returns the Signed Policy Timestamp of the SPD data registered at
+// timestamp by the log with key (PROTOCOL.md section 8.3.2).
+func IssueSPT(key ed25519.PrivateKey, data []byte, timestamp time.Time) (*spd.SPT, error) {
+	h, err := spd.ContentHash(data)
+	if err != nil {
+		return nil, err
+	}
+	logID, err := LogID(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	timestamp = timestamp.UTC().Truncate(time.Second)
+	return &spd.SPT{
+		LogID:     base64.RawURLEncoding.EncodeToString(logID[:]),
+		Timestamp: timestamp.Format(time.RFC3339),
+		Signature: base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, sptSignedData(timestamp, h))),
+	}, nil
+}
+
+// VerifySPT checks that spt was issued for the SPD data by the log with
+// public key pub.
+func VerifySPT(spt *spd.SPT, data []byte, pub ed25519.PublicKey) error {
+	logID, err := LogID(pub)
+	if err != nil {
+		return err
+	}
+	if spt.LogID != base64.RawURLEncoding.EncodeToString(logID[:]) {
+		return ErrLogIDMismatch
+	}
+	timestamp, err := spt.Time()
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidSignature)
+	}
+	h, err := spd.ContentHash(data)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(spt.Signature)
+	if err != nil || !ed25519.Verify(pub, sptSignedData(timestamp, h), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Entry is a leaf of a Policy Transparency Log: the complete SPD as
+// submitted, in canonical form and with the VG signature (PROTOCOL.md section
+// 8.3.2), the time the log registered it and the signature of its SPT. The
+// leaf is the RFC 8785 canonical form of the entry. Monitors check that the
+// platform signed a logged policy with spd.Verify(e.SPD, vgKey).
+type Entry struct {
+	SPD       json.RawMessage `json:"spd"`
+	Timestamp string          `json:"timestamp"`
+	Signature string          `json:"signature"`
+}
+
+// NewEntry returns the entry registering the SPD data with spt.
+func NewEntry(data []byte, spt *spd.SPT) (*Entry, error) {
+	canonical, err := jcs.Canonicalize(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", spd.ErrInvalidDocument, err)
+	}
+	return &Entry{SPD: canonical, Timestamp: spt.Timestamp, Signature: spt.Signature}, nil
+}
+
+// SPDLeafHash returns the leaf hash of the entry registering the SPD data,
+// as submitted to the log, with spt. The SPD a platform serves has its SPTs
+// added and is signed again, so DAs holding it request the proof from
+// ProofBySPDPath and check it with VerifySPDProof instead.
+func SPDLeafHash(data []byte, spt *spd.SPT) (Hash, error) {
+	e, err := NewEntry(data, spt)
+	if err != nil {
+		return Hash{}, err
+	}
+	leaf, err := e.Leaf()
+	if err != nil {
+		return Hash{}, err
+	}
+	return LeafHash(leaf), nil
+}
+
+// VerifySPDProof checks a ProofBySPDPath response for the SPD data, as
+// served, and its spt against the root hash of a tree of treeSize leaves:
+// the entry of the response must hold the content of data (spd.ContentHash)
+// and the signature of spt, and be included at its leaf index.
+func VerifySPDProof(data []byte, spt *spd.SPT, proof *ProofResponse, treeSize uint64, root Hash) error {
+	if proof.Entry == nil {
+		return fmt.Errorf("%w: missing entry", ErrInvalidEntry)
+	}
+	want, err := spd.ContentHash(data)
+	if err != nil {
+		return err
+	}
+	got, err := spd.ContentHash(proof.Entry.SPD)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+	}
+	if got != want || proof.Entry.Timestamp != spt.Timestamp || proof.Entry.Signature != spt.Signature {
+		return fmt.Errorf("%w: entry does not match the SPD and its SPT", ErrInvalidEntry)
+	}
+	leaf, err := proof.Entry.Leaf()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+	}
+	return VerifyInclusion(LeafHash(leaf), proof.LeafIndex, treeSize, proof.AuditPath, root)
+}
+
+// ParseEntry decodes a leaf.
+func ParseEntry(leaf []byte) (*Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(leaf))
+	dec.DisallowUnknownFields()
+	var e Entry
+	if err := dec.Decode(&e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+	}
+	if len(e.SPD) == 0 || e.Timestamp == "" || e.Signature == "" {
+		return nil, fmt.Errorf("%w: missing field", ErrInvalidEntry)
+	}
+	return &e, nil
+}
+
+// Leaf returns the leaf data of e.
+func (e *Entry) Leaf() ([]byte, error) {
+	return jcs.Marshal(e)
+}
+
+// SPT returns the SPT of e issued by the log with logID.
+func (e *Entry) SPT(logID [32]byte) *spd.SPT {
+	return &spd.SPT{
+		LogID:     base64.RawURLEncoding.EncodeToString(logID[:]),
+		Timestamp: e.Timestamp,
+		Signature: e.Signature,
+	}
+}
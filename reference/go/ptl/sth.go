@@ -0,0 +1,86 @@
+package ptl
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a log signature does not verify.
+var ErrInvalidSignature = errors.New("ptl: log signature verification failed")
+
+// sthContext separates tree head signatures from any other signature made
+// with the log key.
+const sthContext = "AAVP-PTL-STH-v1\x00"
+
+// MarshalText encodes h in base64url without padding.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(base64.RawURLEncoding.EncodeToString(h[:])), nil
+}
+
+// UnmarshalText decodes a base64url hash.
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := base64.RawURLEncoding.DecodeString(string(text))
+	if err != nil || len(b) != HashSize {
+		return fmt.Errorf("ptl: invalid hash %q", text)
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// LogID returns the log_id of the log with public key pub: SHA-256 of its
+// SPKI DER encoding (PROTOCOL.md section 8.3.2).
+func LogID(pub ed25519.PublicKey) ([32]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("ptl: %w", err)
+	}
+	return sha256.Sum256(der), nil
+}
+
+// TreeHead is the state of a log at a given size. Timestamps have a
+// resolution of one second.
+type TreeHead struct {
+	TreeSize  uint64    `json:"tree_size"`
+	Timestamp time.Time `json:"timestamp"`
+	RootHash  Hash      `json:"root_hash"`
+}
+
+// SignedTreeHead is a TreeHead signed by the log with Ed25519. Signature is
+// base64url.
+type SignedTreeHead struct {
+	TreeHead
+	Signature string `json:"signature"`
+}
+
+// signedData returns the bytes covered by the signature: a context string,
+// the tree size and the timestamp in Unix seconds as big-endian uint64, and
+// the root hash.
+func (h *TreeHead) signedData() []byte {
+	b := make([]byte, 0, len(sthContext)+16+HashSize)
+	b = append(b, sthContext...)
+	b = binary.BigEndian.AppendUint64(b, h.TreeSize)
+	b = binary.BigEndian.AppendUint64(b, uint64(h.Timestamp.Unix()))
+	return append(b, h.RootHash[:]...)
+}
+
+// SignTreeHead signs h with the log key.
+func SignTreeHead(h TreeHead, key ed25519.PrivateKey) *SignedTreeHead {
+	h.Timestamp = h.Timestamp.UTC().Truncate(time.Second)
+	sig := ed25519.Sign(key, h.signedData())
+	return &SignedTreeHead{TreeHead: h, Signature: base64.RawURLEncoding.EncodeToString(sig)}
+}
+
+// Verify checks the signature of s against the log key pub.
+func (s *SignedTreeHead) Verify(pub ed25519.PublicKey) error {
+	sig, err := base64.RawURLEncoding.DecodeString(s.Signature)
+	if err != nil || !ed25519.Verify(pub, s.signedData(), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
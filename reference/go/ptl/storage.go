@@ -0,0 +1,176 @@
+package ptl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// MaxLeafSize bounds the size of a leaf.
+const MaxLeafSize = 1 << 20
+
+// ErrLeafTooLarge is returned when appending a leaf larger than MaxLeafSize.
+var ErrLeafTooLarge = errors.New("ptl: leaf larger than 1 MiB")
+
+// Storage keeps the leaves of a log in order. Leaves are never modified or
+// removed once Append has returned.
+type Storage interface {
+	// Append stores leaf at the next index and returns that index.
+	Append(leaf []byte) (uint64, error)
+	// Leaf returns the leaf at index.
+	Leaf(index uint64) ([]byte, error)
+	// Size returns the number of leaves.
+	Size() (uint64, error)
+}
+
+// MemoryStorage is a Storage kept in memory.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	leaves [][]byte
+}
+
+// NewMemoryStorage creates an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Append(leaf []byte) (uint64, error) {
+	if len(leaf) > MaxLeafSize {
+		return 0, ErrLeafTooLarge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaves = append(s.leaves, slices.Clone(leaf))
+	return uint64(len(s.leaves) - 1), nil
+}
+
+func (s *MemoryStorage) Leaf(index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index >= uint64(len(s.leaves)) {
+		return nil, ErrOutOfRange
+	}
+	return slices.Clone(s.leaves[index]), nil
+}
+
+func (s *MemoryStorage) Size() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.leaves)), nil
+}
+
+// FileStorage is a Storage backed by an append-only file of records, each a
+// 4-byte big-endian length followed by the leaf. Every Append is synced to
+// disk before it returns. The offsets of the records are kept in memory.
+type FileStorage struct {
+	mu      sync.RWMutex
+	f       *os.File
+	offsets []int64 // offset of each record
+	end     int64
+}
+
+// OpenFileStorage opens or creates the log file at path. A record left
+// incomplete by an interrupted Append, which was never acknowledged, is
+// discarded.
+func OpenFileStorage(path string) (*FileStorage, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStorage{f: f}
+	if err := s.scan(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// scan reads the record offsets and truncates a trailing partial record.
+func (s *FileStorage) scan() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.f, 0, info.Size()))
+	var off int64
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:]))
+		if n > MaxLeafSize {
+			return fmt.Errorf("ptl: %s: corrupt record at offset %d", s.f.Name(), off)
+		}
+		if off+4+n > info.Size() {
+			break
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return err
+		}
+		s.offsets = append(s.offsets, off)
+		off += 4 + n
+	}
+	s.end = off
+	if off < info.Size() {
+		return s.f.Truncate(off)
+	}
+	return nil
+}
+
+func (s *FileStorage) Append(leaf []byte) (uint64, error) {
+	if len(leaf) > MaxLeafSize {
+		return 0, ErrLeafTooLarge
+	}
+	rec := make([]byte, 4+len(leaf))
+	binary.BigEndian.PutUint32(rec, uint32(len(leaf)))
+	copy(rec[4:], leaf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.WriteAt(rec, s.end); err != nil {
+		s.f.Truncate(s.end)
+		return 0, err
+	}
+	if err := s.f.Sync(); err != nil {
+		s.f.Truncate(s.end)
+		return 0, err
+	}
+	s.offsets = append(s.offsets, s.end)
+	s.end += int64(len(rec))
+	return uint64(len(s.offsets) - 1), nil
+}
+
+func (s *FileStorage) Leaf(index uint64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index >= uint64(len(s.offsets)) {
+		return nil, ErrOutOfRange
+	}
+	off := s.offsets[index]
+	var hdr [4]byte
+	if _, err := s.f.ReadAt(hdr[:], off); err != nil {
+		return nil, err
+	}
+	leaf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	if _, err := s.f.ReadAt(leaf, off+4); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+func (s *FileStorage) Size() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.offsets)), nil
+}
+
+// Close closes the file.
+func (s *FileStorage) Close() error {
+	return s.f.Close()
+}
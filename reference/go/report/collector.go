@@ -0,0 +1,169 @@
+package report
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPeriodTooShort is returned by Collector.Build before MinPeriod has
+// elapsed since the start of the period.
+var ErrPeriodTooShort = errors.New("report: period shorter than 24 hours")
+
+// Counters are the outcome counts of one IM.
+type Counters struct {
+	Total    uint64
+	Valid    uint64
+	Failures Failures
+}
+
+func (c *Counters) add(o Outcome) {
+	c.Total++
+	switch o {
+	case Valid:
+		c.Valid++
+	case Expired:
+		c.Failures.Expired++
+	case BadSignature:
+		c.Failures.BadSignature++
+	case UnknownKey:
+		c.Failures.UnknownKey++
+	default:
+		c.Failures.Malformed++
+	}
+}
+
+// Collector counts verification outcomes per IM domain, and per token_key_id
+// within each IM, over a period. It keeps nothing but the counters. It is
+// safe for concurrent use.
+//
+// Tokens that cannot be attributed to an IM (they could not be decoded, or
+// their token_key_id was never in the trust store of a VG accepting several
+// IMs) are recorded with an empty domain; they are available from
+// Unattributed but are not part of any report. An IM therefore only sees
+// unknown_key for keys the VG failed to obtain when it is the single IM the
+// VG accepts; otherwise the count stays with the VG.
+type Collector struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]*imCounters
+}
+
+type imCounters struct {
+	Counters
+	keys map[[32]byte]*Counters
+}
+
+// NewCollector creates a Collector whose first period starts at start.
+func NewCollector(start time.Time) *Collector {
+	return &Collector{start: start.UTC().Truncate(time.Second), counts: make(map[string]*imCounters)}
+}
+
+// Record counts one outcome for the IM with the given domain.
+func (c *Collector) Record(imDomain string, o Outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.im(imDomain).add(o)
+}
+
+// RecordKey counts one outcome for the IM with the given domain and for its
+// key tokenKeyID.
+func (c *Collector) RecordKey(imDomain string, tokenKeyID [32]byte, o Outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.im(imDomain)
+	n.add(o)
+	k, ok := n.keys[tokenKeyID]
+	if !ok {
+		k = &Counters{}
+		n.keys[tokenKeyID] = k
+	}
+	k.add(o)
+}
+
+// im returns the counters of imDomain. c.mu must be held.
+func (c *Collector) im(imDomain string) *imCounters {
+	imDomain = strings.ToLower(imDomain)
+	n, ok := c.counts[imDomain]
+	if !ok {
+		n = &imCounters{keys: make(map[[32]byte]*Counters)}
+		c.counts[imDomain] = n
+	}
+	return n
+}
+
+// Start returns the start of the current period.
+func (c *Collector) Start() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.start
+}
+
+// Counts returns the counters of imDomain in the current period.
+func (c *Collector) Counts(imDomain string) Counters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n, ok := c.counts[strings.ToLower(imDomain)]; ok {
+		return n.Counters
+	}
+	return Counters{}
+}
+
+// Unattributed returns the counters of the tokens that could not be
+// attributed to an IM in the current period.
+func (c *Collector) Unattributed() Counters {
+	return c.Counts("")
+}
+
+// Build closes the current period at end and returns one report per IM that
+// presented tokens during it, ordered by IM domain. A new period starts at
+// end with all counters at zero. It fails with ErrPeriodTooShort, keeping the
+// current period open, if the period would be shorter than MinPeriod.
+func (c *Collector) Build(vgDomain string, end time.Time) ([]*Report, error) {
+	end = end.UTC().Truncate(time.Second)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if end.Sub(c.start) < MinPeriod {
+		return nil, ErrPeriodTooShort
+	}
+
+	var reports []*Report
+	for domain, n := range c.counts {
+		if domain == "" || n.Total == 0 {
+			continue
+		}
+		id, err := newReportID()
+		if err != nil {
+			return nil, fmt.Errorf("report: %w", err)
+		}
+		r := &Report{
+			ReportID:    id,
+			VGDomain:    vgDomain,
+			PeriodStart: c.start,
+			PeriodEnd:   end,
+			IMDomain:    domain,
+			TotalTokens: n.Total,
+			ValidTokens: n.Valid,
+			Failures:    n.Failures,
+		}
+		for kid, k := range n.keys {
+			r.Keys = append(r.Keys, KeyCounts{
+				TokenKeyID:  base64.RawURLEncoding.EncodeToString(kid[:]),
+				TotalTokens: k.Total,
+				ValidTokens: k.Valid,
+				Failures:    k.Failures,
+			})
+		}
+		sort.Slice(r.Keys, func(i, j int) bool { return r.Keys[i].TokenKeyID < r.Keys[j].TokenKeyID })
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].IMDomain < reports[j].IMDomain })
+
+	c.start = end
+	c.counts = make(map[string]*imCounters)
+	return reports, nil
+}
@@ -0,0 +1,161 @@
+// Package report implements the aggregate verification reports of PROTOCOL.md
+// section 9.5.3. A VG counts the outcomes of the tokens it verifies per IM and
+// periodically sends each IM a report with the totals; the IM uses them to
+// spot problems in its signing service or key distribution.
+//
+// Reports hold counters only. Nothing about individual tokens, requests or
+// times within the period is recorded, and a period must last at least
+// MinPeriod so that reports cannot be correlated with individual visits.
+package report
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MinPeriod is the shortest period a report may cover.
+const MinPeriod = 24 * time.Hour
+
+// ErrInvalidReport is returned for reports that do not follow the schema.
+var ErrInvalidReport = errors.New("report: invalid aggregate report")
+
+// Outcome classifies the result of verifying one token.
+type Outcome uint8
+
+const (
+	Valid        Outcome = iota // passed every check
+	Expired                     // expires_at in the past beyond the tolerance
+	BadSignature                // signature does not verify under a known key
+	Malformed                   // size, token_type or field values invalid
+	UnknownKey                  // token_key_id not trusted at verification time
+)
+
+// String returns the name of the outcome as used in the report.
+func (o Outcome) String() string {
+	switch o {
+	case Valid:
+		return "valid"
+	case Expired:
+		return "expired"
+	case BadSignature:
+		return "bad_signature"
+	case Malformed:
+		return "malformed"
+	case UnknownKey:
+		return "unknown_key"
+	default:
+		return "unknown"
+	}
+}
+
+// Report is an aggregate verification report for one IM.
+type Report struct {
+	ReportID    string    `json:"report_id"`
+	VGDomain    string    `json:"vg_domain"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	IMDomain    string    `json:"im_domain"`
+	TotalTokens uint64    `json:"total_tokens"`
+	ValidTokens uint64    `json:"valid_tokens"`
+	Failures    Failures  `json:"failures"`
+	// Keys optionally breaks the counters down by token_key_id, so that the
+	// IM can follow each of its keys. It is an extension of the schema of
+	// section 9.5.3 and, like the rest of the report, holds counters only.
+	Keys []KeyCounts `json:"keys,omitempty"`
+}
+
+// KeyCounts are the counters of one token_key_id (base64url). Tokens that
+// could not be decoded are not attributed to any key, so the key counters
+// may add up to less than the report totals.
+type KeyCounts struct {
+	TokenKeyID  string   `json:"token_key_id"`
+	TotalTokens uint64   `json:"total_tokens"`
+	ValidTokens uint64   `json:"valid_tokens"`
+	Failures    Failures `json:"failures"`
+}
+
+// Failures breaks down the rejected tokens by cause.
+type Failures struct {
+	Expired      uint64 `json:"expired"`
+	BadSignature uint64 `json:"bad_signature"`
+	Malformed    uint64 `json:"malformed"`
+	UnknownKey   uint64 `json:"unknown_key"`
+}
+
+// Total returns the number of rejected tokens.
+func (f *Failures) Total() uint64 {
+	return f.Expired + f.BadSignature + f.Malformed + f.UnknownKey
+}
+
+// Period returns the length of the period covered by r.
+func (r *Report) Period() time.Duration {
+	return r.PeriodEnd.Sub(r.PeriodStart)
+}
+
+// Validate checks the required fields, that the period lasts at least
+// MinPeriod and that the counters add up.
+func (r *Report) Validate() error {
+	if r.ReportID == "" || r.VGDomain == "" || r.IMDomain == "" {
+		return fmt.Errorf("%w: missing required field", ErrInvalidReport)
+	}
+	if r.PeriodStart.IsZero() || r.PeriodEnd.IsZero() {
+		return fmt.Errorf("%w: missing period", ErrInvalidReport)
+	}
+	if r.Period() < MinPeriod {
+		return fmt.Errorf("%w: period of %v is shorter than %v", ErrInvalidReport, r.Period(), MinPeriod)
+	}
+	if r.ValidTokens+r.Failures.Total() != r.TotalTokens {
+		return fmt.Errorf("%w: counters do not add up to total_tokens", ErrInvalidReport)
+	}
+	seen := make(map[string]bool)
+	var sum uint64
+	for _, k := range r.Keys {
+		if kid, err := base64.RawURLEncoding.DecodeString(k.TokenKeyID); err != nil || len(kid) != 32 {
+			return fmt.Errorf("%w: invalid token_key_id %q", ErrInvalidReport, k.TokenKeyID)
+		}
+		if seen[k.TokenKeyID] {
+			return fmt.Errorf("%w: duplicate token_key_id %q", ErrInvalidReport, k.TokenKeyID)
+		}
+		seen[k.TokenKeyID] = true
+		if k.ValidTokens+k.Failures.Total() != k.TotalTokens {
+			return fmt.Errorf("%w: counters of %s do not add up", ErrInvalidReport, k.TokenKeyID)
+		}
+		sum += k.TotalTokens
+	}
+	if sum > r.TotalTokens {
+		return fmt.Errorf("%w: key counters exceed total_tokens", ErrInvalidReport)
+	}
+	return nil
+}
+
+// Parse decodes a report and checks it with Validate. Unknown fields are
+// rejected.
+func Parse(data []byte) (*Report, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var r Report
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidReport)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// newReportID returns a random report identifier.
+func newReportID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,143 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCollectorBuild(t *testing.T) {
+	c := NewCollector(start)
+	outcomes := []Outcome{Valid, Valid, Valid, Expired, BadSignature, Malformed, UnknownKey}
+	var wg sync.WaitGroup
+	for _, o := range outcomes {
+		wg.Add(2)
+		go func() { defer wg.Done(); c.Record("IM1.example", o) }()
+		go func() { defer wg.Done(); c.Record("im2.example", o) }()
+	}
+	wg.Wait()
+	c.Record("", UnknownKey)
+
+	if _, err := c.Build("platform.example", start.Add(MinPeriod-time.Second)); !errors.Is(err, ErrPeriodTooShort) {
+		t.Fatalf("Build before MinPeriod: %v", err)
+	}
+	reports, err := c.Build("platform.example", start.Add(MinPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[0].IMDomain != "im1.example" || reports[1].IMDomain != "im2.example" {
+		t.Fatalf("reports = %+v", reports)
+	}
+	r := reports[0]
+	want := Failures{Expired: 1, BadSignature: 1, Malformed: 1, UnknownKey: 1}
+	if r.TotalTokens != 7 || r.ValidTokens != 3 || r.Failures != want || r.Period() != MinPeriod {
+		t.Errorf("report = %+v", r)
+	}
+	if err := r.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if reports[0].ReportID == reports[1].ReportID {
+		t.Error("report IDs are not unique")
+	}
+
+	// A new period starts with empty counters.
+	if c.Start() != start.Add(MinPeriod) || c.Counts("im1.example").Total != 0 || c.Unattributed().Total != 0 {
+		t.Error("counters were not reset")
+	}
+	if reports, _ := c.Build("platform.example", start.Add(2*MinPeriod)); len(reports) != 0 {
+		t.Errorf("empty period produced %d reports", len(reports))
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	c := NewCollector(start)
+	c.Record("im.example", Valid)
+	c.Record("im.example", BadSignature)
+	reports, err := c.Build("platform.example", start.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{
+		`"vg_domain":"platform.example"`,
+		`"period_start":"2026-03-01T00:00:00Z"`,
+		`"period_end":"2026-03-03T00:00:00Z"`,
+		`"im_domain":"im.example"`,
+		`"total_tokens":2`,
+		`"failures":{"expired":0,"bad_signature":1,"malformed":0,"unknown_key":0}`,
+	} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("JSON %s lacks %s", data, field)
+		}
+	}
+	back, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(back, reports[0]) {
+		t.Errorf("round trip: %+v != %+v", back, reports[0])
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	valid := `{"report_id":"r1","vg_domain":"p.example","period_start":"2026-03-01T00:00:00Z","period_end":"2026-03-02T00:00:00Z","im_domain":"im.example","total_tokens":3,"valid_tokens":2,"failures":{"expired":1,"bad_signature":0,"malformed":0,"unknown_key":0}}`
+	if _, err := Parse([]byte(valid)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	for name, data := range map[string]string{
+		"short period":  strings.Replace(valid, "2026-03-02T00:00:00Z", "2026-03-01T23:59:59Z", 1),
+		"inconsistent":  strings.Replace(valid, `"total_tokens":3`, `"total_tokens":4`, 1),
+		"missing im":    strings.Replace(valid, `"im_domain":"im.example"`, `"im_domain":""`, 1),
+		"unknown field": strings.Replace(valid, `"report_id"`, `"token":"x","report_id"`, 1),
+		"trailing":      valid + `{}`,
+		"not json":      `{`,
+	} {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrInvalidReport) {
+			t.Errorf("%s: Parse = %v, want ErrInvalidReport", name, err)
+		}
+	}
+}
+
+func TestCollectorKeys(t *testing.T) {
+	c := NewCollector(start)
+	c.RecordKey("im.example", [32]byte{2}, BadSignature)
+	c.RecordKey("im.example", [32]byte{1}, Valid)
+	c.RecordKey("im.example", [32]byte{2}, Valid)
+	c.Record("im.example", Malformed)
+	reports, err := c.Build("platform.example", start.Add(MinPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := reports[0]
+	if r.TotalTokens != 4 || len(r.Keys) != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+	if k := r.Keys[1]; k.TotalTokens != 2 || k.ValidTokens != 1 || k.Failures.BadSignature != 1 {
+		t.Errorf("keys[1] = %+v", k)
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	r.Keys[1].TotalTokens = 3
+	if err := r.Validate(); !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("inconsistent key counters: %v", err)
+	}
+	r.Keys[1] = r.Keys[0]
+	if err := r.Validate(); !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("duplicate key: %v", err)
+	}
+	r.Keys = []KeyCounts{{TokenKeyID: "short", TotalTokens: 1, ValidTokens: 1}}
+	if err := r.Validate(); !errors.Is(err, ErrInvalidReport) {
+		t.Errorf("invalid token_key_id: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/edge"
+)
+
+// Export returns the Ed25519 verification keys of ks that have not expired at
+// now as an edge.SignedKeyset signed with distributionKey, for distribution
+// to edge nodes (PROTOCOL.md section 7.9). HMAC keys are never exported;
+// exported keys must have both validity bounds set.
+func (ks *Keyset) Export(distributionKey ed25519.PrivateKey, now time.Time) ([]byte, error) {
+	doc := &edge.KeysetDocument{
+		Version:  edge.KeysetVersion,
+		IssuedAt: now.UTC().Format(time.RFC3339),
+		Keys:     []edge.KeyEntry{},
+	}
+	for _, k := range ks.Keys() {
+		if k.Algorithm != AlgEd25519 || (!k.NotAfter.IsZero() && !now.Before(k.NotAfter)) {
+			continue
+		}
+		if k.NotBefore.IsZero() || k.NotAfter.IsZero() {
+			return nil, fmt.Errorf("session: key %s has no validity window", k.ID)
+		}
+		doc.Keys = append(doc.Keys, edge.NewKeyEntry(k.public, k.NotBefore, k.NotAfter))
+	}
+	return edge.SignKeyset(doc, distributionKey)
+}
+
+// ImportKeyset verifies an edge.SignedKeyset against distributionKey and
+// returns its keys as a verification-only Keyset.
+func ImportKeyset(data []byte, distributionKey ed25519.PublicKey) (*Keyset, error) {
+	parsed, err := edge.ParseKeyset(data, distributionKey)
+	if err != nil {
+		return nil, err
+	}
+	ks := NewKeyset()
+	for _, k := range parsed.Keys {
+		ks.Add(NewEd25519VerifyKey(k.PublicKey, k.NotBefore, k.NotAfter))
+	}
+	return ks, nil
+}
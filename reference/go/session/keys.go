@@ -0,0 +1,223 @@
+package session
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/edge"
+)
+
+// Algorithm identifies how vg_signature is computed.
+type Algorithm uint8
+
+const (
+	AlgEd25519    Algorithm = 0x01 // Ed25519 (RFC 8032)
+	AlgHMACSHA256 Algorithm = 0x02 // HMAC-SHA256 (RFC 2104)
+)
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	switch a {
+	case AlgEd25519:
+		return "Ed25519"
+	case AlgHMACSHA256:
+		return "HMAC-SHA256"
+	default:
+		return "unknown"
+	}
+}
+
+// MinHMACKeySize is the shortest accepted HMAC secret.
+const MinHMACKeySize = 32
+
+// KeyIDSize is the length of a key identifier.
+const KeyIDSize = edge.KeyIDSize
+
+// KeyID identifies a VG credential key. It is derived from the key material,
+// so every credential signed with the same key carries the same KeyID.
+type KeyID [KeyIDSize]byte
+
+// String returns the hexadecimal form of the key ID.
+func (id KeyID) String() string { return hex.EncodeToString(id[:]) }
+
+// Key is a VG credential key. An Ed25519 key holding only the public half can
+// verify but not sign; HMAC keys always do both.
+type Key struct {
+	ID        KeyID
+	Algorithm Algorithm
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+	secret  []byte
+}
+
+// NewEd25519Key creates a signing key from an Ed25519 private key.
+func NewEd25519Key(priv ed25519.PrivateKey, notBefore, notAfter time.Time) *Key {
+	k := NewEd25519VerifyKey(priv.Public().(ed25519.PublicKey), notBefore, notAfter)
+	k.private = priv
+	return k
+}
+
+// NewEd25519VerifyKey creates a verification-only key from an Ed25519 public
+// key, as distributed to edge nodes (PROTOCOL.md section 7.9).
+func NewEd25519VerifyKey(pub ed25519.PublicKey, notBefore, notAfter time.Time) *Key {
+	return &Key{ID: edge.KeyID(pub), Algorithm: AlgEd25519, NotBefore: notBefore, NotAfter: notAfter, public: pub}
+}
+
+// GenerateEd25519Key creates a new random Ed25519 signing key.
+func GenerateEd25519Key(notBefore, notAfter time.Time) (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewEd25519Key(priv, notBefore, notAfter), nil
+}
+
+// NewHMACKey creates a key from an HMAC-SHA256 secret of at least
+// MinHMACKeySize bytes.
+func NewHMACKey(secret []byte, notBefore, notAfter time.Time) (*Key, error) {
+	if len(secret) < MinHMACKeySize {
+		return nil, errors.New("session: HMAC secret must be at least 32 bytes")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("aavp-session-key-id"))
+	k := &Key{Algorithm: AlgHMACSHA256, NotBefore: notBefore, NotAfter: notAfter, secret: secret}
+	copy(k.ID[:], mac.Sum(nil))
+	return k, nil
+}
+
+// CanSign reports whether the key can sign credentials.
+func (k *Key) CanSign() bool {
+	return k.private != nil || k.secret != nil
+}
+
+// PublicKey returns the Ed25519 public key, or nil for HMAC keys.
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.public
+}
+
+// validAt reports whether now is inside [NotBefore, NotAfter). Zero bounds
+// are open.
+func (k *Key) validAt(now time.Time) bool {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return false
+	}
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
+
+func (k *Key) sign(msg []byte) []byte {
+	if k.Algorithm == AlgEd25519 {
+		return ed25519.Sign(k.private, msg)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(msg, sig []byte) bool {
+	if k.Algorithm == AlgEd25519 {
+		return len(sig) == ed25519.SignatureSize && ed25519.Verify(k.public, msg, sig)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(msg)
+	return hmac.Equal(mac.Sum(nil), sig)
+}
+
+// Keyset holds the VG credential keys. Several keys may be valid at once so
+// that credentials signed before a rotation keep verifying until they expire.
+// It is safe for concurrent use.
+type Keyset struct {
+	mu   sync.RWMutex
+	keys []*Key // ordered by NotBefore
+}
+
+// NewKeyset creates a Keyset holding keys.
+func NewKeyset(keys ...*Key) *Keyset {
+	ks := &Keyset{}
+	for _, k := range keys {
+		ks.Add(k)
+	}
+	return ks
+}
+
+// Add inserts k, replacing any key with the same ID.
+func (ks *Keyset) Add(k *Key) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, existing := range ks.keys {
+		if existing.ID == k.ID {
+			ks.keys = append(ks.keys[:i], ks.keys[i+1:]...)
+			break
+		}
+	}
+	ks.keys = append(ks.keys, k)
+	sort.SliceStable(ks.keys, func(i, j int) bool { return ks.keys[i].NotBefore.Before(ks.keys[j].NotBefore) })
+}
+
+// Remove deletes the key with the given ID.
+func (ks *Keyset) Remove(id KeyID) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, k := range ks.keys {
+		if k.ID == id {
+			ks.keys = append(ks.keys[:i], ks.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Prune deletes the keys whose NotAfter has passed and returns how many were
+// removed.
+func (ks *Keyset) Prune(now time.Time) int {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	kept := ks.keys[:0]
+	for _, k := range ks.keys {
+		if k.NotAfter.IsZero() || now.Before(k.NotAfter) {
+			kept = append(kept, k)
+		}
+	}
+	n := len(ks.keys) - len(kept)
+	ks.keys = kept
+	return n
+}
+
+// Keys returns the keys in the set, ordered by NotBefore.
+func (ks *Keyset) Keys() []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return append([]*Key(nil), ks.keys...)
+}
+
+// SigningKey returns the newest signing key valid at now.
+func (ks *Keyset) SigningKey(now time.Time) (*Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].CanSign() && ks.keys[i].validAt(now) {
+			return ks.keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// Lookup returns the key with the given ID if it is valid at now.
+func (ks *Keyset) Lookup(id KeyID, now time.Time) (*Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.ID == id {
+			return k, k.validAt(now)
+		}
+	}
+	return nil, false
+}
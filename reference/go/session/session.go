@@ -0,0 +1,140 @@
+// Package session implements the self-contained session credential a VG
+// issues after a successful handshake (PROTOCOL.md section 7).
+//
+// A credential carries only age_bracket, session_expires_at and vg_signature,
+// plus the version, algorithm and key ID needed to verify it:
+//
+//	version (1) || algorithm (1) || key_id (8) || age_bracket (1) ||
+//	session_expires_at (8, big-endian Unix seconds) || vg_signature
+//
+// vg_signature covers every preceding byte and is 64 bytes for Ed25519 and
+// 32 bytes for HMAC-SHA256. Both algorithms are deterministic and the format
+// has no random or per-user field, so two credentials for the same bracket
+// signed with the same key differ only in session_expires_at.
+package session
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+)
+
+// Credential parameters (PROTOCOL.md section 7.4).
+const (
+	Version = 0x01
+
+	MinTTL     = 15 * time.Minute
+	MaxTTL     = 30 * time.Minute
+	DefaultTTL = 20 * time.Minute
+
+	headerSize = 1 + 1 + KeyIDSize + 1 + 8
+)
+
+// Credential errors.
+var (
+	ErrMalformed    = errors.New("session: malformed credential")
+	ErrUnknownKey   = errors.New("session: unknown or invalid key")
+	ErrBadSignature = errors.New("session: invalid vg_signature")
+	ErrExpired      = errors.New("session: credential expired")
+	ErrNoSigningKey = errors.New("session: no signing key valid at this time")
+
+	// ErrTokenExpired is a client error: the token must be renewed. The
+	// validator accepts tokens up to its past clock skew tolerance after
+	// expires_at, but a credential never outlives its token, so such tokens
+	// get no credential. It matches validation.ErrTokenExpired with
+	// errors.Is.
+	ErrTokenExpired = fmt.Errorf("session: token expires before a credential can be issued: %w", validation.ErrTokenExpired)
+)
+
+// Credential is a verified session credential.
+type Credential struct {
+	AgeBracket uint8
+	ExpiresAt  time.Time
+	KeyID      KeyID
+}
+
+// Issuer mints session credentials. It implements vg.SessionIssuer.
+type Issuer struct {
+	Keys *Keyset
+	// TTL is the credential lifetime, between MinTTL and MaxTTL. The
+	// credential is shortened to the token's expires_at when that comes first.
+	TTL time.Duration
+}
+
+// NewIssuer creates an Issuer signing with the keys of ks and DefaultTTL.
+func NewIssuer(ks *Keyset) *Issuer {
+	return &Issuer{Keys: ks, TTL: DefaultTTL}
+}
+
+// Issue returns a credential for ageBracket, encoded for transport, and its
+// session_expires_at: now + TTL, or tokenExpiresAt if that is earlier
+// (PROTOCOL.md section 7.4). A token that has already expired, even within
+// the validator's clock skew tolerance, gets ErrTokenExpired.
+func (is *Issuer) Issue(ageBracket uint8, tokenExpiresAt, now time.Time) (string, time.Time, error) {
+	if is.TTL < MinTTL || is.TTL > MaxTTL {
+		return "", time.Time{}, fmt.Errorf("session: TTL %v outside [%v, %v]", is.TTL, MinTTL, MaxTTL)
+	}
+	if !token.ValidAgeBracket(ageBracket) {
+		return "", time.Time{}, errors.New("session: invalid age bracket")
+	}
+	expiresAt := now.Add(is.TTL).Truncate(time.Second)
+	if tokenExpiresAt.Before(expiresAt) {
+		expiresAt = tokenExpiresAt.Truncate(time.Second)
+	}
+	if !expiresAt.After(now) {
+		return "", time.Time{}, ErrTokenExpired
+	}
+	key, ok := is.Keys.SigningKey(now)
+	if !ok {
+		return "", time.Time{}, ErrNoSigningKey
+	}
+
+	b := make([]byte, headerSize, headerSize+64)
+	b[0] = Version
+	b[1] = byte(key.Algorithm)
+	copy(b[2:], key.ID[:])
+	b[2+KeyIDSize] = ageBracket
+	binary.BigEndian.PutUint64(b[3+KeyIDSize:], uint64(expiresAt.Unix()))
+	b = append(b, key.sign(b)...)
+	return base64.RawURLEncoding.EncodeToString(b), expiresAt.UTC(), nil
+}
+
+// IssueSession implements vg.SessionIssuer.
+func (is *Issuer) IssueSession(ageBracket uint8, tokenExpiresAt, now time.Time) (string, time.Time, error) {
+	return is.Issue(ageBracket, tokenExpiresAt, now)
+}
+
+// Verify decodes a credential and checks its signature against ks and its
+// expiry against now.
+func (ks *Keyset) Verify(encoded string, now time.Time) (*Credential, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(b) < headerSize || b[0] != Version {
+		return nil, ErrMalformed
+	}
+	var id KeyID
+	copy(id[:], b[2:])
+	key, ok := ks.Lookup(id, now)
+	if !ok || byte(key.Algorithm) != b[1] {
+		return nil, ErrUnknownKey
+	}
+	if !key.verify(b[:headerSize], b[headerSize:]) {
+		return nil, ErrBadSignature
+	}
+	cred := &Credential{
+		AgeBracket: b[2+KeyIDSize],
+		ExpiresAt:  time.Unix(int64(binary.BigEndian.Uint64(b[3+KeyIDSize:])), 0).UTC(),
+		KeyID:      id,
+	}
+	if !token.ValidAgeBracket(cred.AgeBracket) {
+		return nil, ErrMalformed
+	}
+	if !now.Before(cred.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return cred, nil
+}
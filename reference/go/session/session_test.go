@@ -0,0 +1,203 @@
+package session
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/edge"
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+	"github.com/aavp-protocol/aavp-go/vg"
+)
+
+var _ vg.SessionIssuer = (*Issuer)(nil)
+
+func testKeys(t *testing.T, now time.Time) (*Key, *Key) {
+	t.Helper()
+	ed, err := GenerateEd25519Key(now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := NewHMACKey(bytes.Repeat([]byte{0x42}, 32), now.Add(-time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ed, mac
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ed, mac := testKeys(t, now)
+	for _, key := range []*Key{ed, mac} {
+		t.Run(key.Algorithm.String(), func(t *testing.T) {
+			ks := NewKeyset(key)
+			is := NewIssuer(ks)
+			cred, exp, err := is.Issue(token.AgeBracketAge13_15, now.Add(3*time.Hour), now)
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if exp != now.Add(DefaultTTL) {
+				t.Errorf("session_expires_at = %v", exp)
+			}
+			c, err := ks.Verify(cred, now.Add(10*time.Minute))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if c.AgeBracket != token.AgeBracketAge13_15 || !c.ExpiresAt.Equal(exp) || c.KeyID != key.ID {
+				t.Errorf("unexpected credential %+v", c)
+			}
+			if _, err := ks.Verify(cred, exp); !errors.Is(err, ErrExpired) {
+				t.Errorf("got %v, want ErrExpired", err)
+			}
+
+			raw, _ := base64.RawURLEncoding.DecodeString(cred)
+			raw[headerSize-1] ^= 1 // extend session_expires_at
+			if _, err := ks.Verify(base64.RawURLEncoding.EncodeToString(raw), now); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("tampered: got %v, want ErrBadSignature", err)
+			}
+		})
+	}
+}
+
+func TestTTLRules(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ed, _ := testKeys(t, now)
+	is := NewIssuer(NewKeyset(ed))
+
+	// The credential never outlives the token.
+	_, exp, err := is.Issue(token.AgeBracketOver18, now.Add(7*time.Minute), now)
+	if err != nil || !exp.Equal(now.Add(7*time.Minute)) {
+		t.Errorf("got %v, %v; want token expiry", exp, err)
+	}
+	// A token expired within the validator's past skew tolerance passes
+	// validation but gets no credential; the error is the validation one.
+	skewed := now.Add(-validation.ClockSkewTolerancePast * time.Second / 2)
+	if _, _, err := is.Issue(token.AgeBracketOver18, skewed, now); !errors.Is(err, ErrTokenExpired) || !errors.Is(err, validation.ErrTokenExpired) {
+		t.Errorf("got %v, want ErrTokenExpired", err)
+	}
+	for _, ttl := range []time.Duration{10 * time.Minute, 45 * time.Minute} {
+		is.TTL = ttl
+		if _, _, err := is.Issue(token.AgeBracketOver18, now.Add(time.Hour), now); err == nil {
+			t.Errorf("TTL %v accepted", ttl)
+		}
+	}
+}
+
+func TestUnlinkable(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ed, mac := testKeys(t, now)
+	for _, key := range []*Key{ed, mac} {
+		is := NewIssuer(NewKeyset(key))
+		a, _, _ := is.Issue(token.AgeBracketUnder13, now.Add(time.Hour), now)
+		b, _, _ := is.Issue(token.AgeBracketUnder13, now.Add(2*time.Hour), now)
+		if a != b {
+			t.Errorf("%v: credentials for the same bracket and time differ", key.Algorithm)
+		}
+		c, _, _ := is.Issue(token.AgeBracketUnder13, now.Add(time.Hour), now.Add(time.Second))
+		ra, _ := base64.RawURLEncoding.DecodeString(a)
+		rc, _ := base64.RawURLEncoding.DecodeString(c)
+		if !bytes.Equal(ra[:headerSize-8], rc[:headerSize-8]) {
+			t.Errorf("%v: credentials differ outside session_expires_at and vg_signature", key.Algorithm)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldKey, _ := GenerateEd25519Key(now.Add(-24*time.Hour), now.Add(time.Hour))
+	newKey, _ := GenerateEd25519Key(now.Add(30*time.Minute), now.Add(48*time.Hour))
+	ks := NewKeyset(newKey, oldKey)
+	is := NewIssuer(ks)
+
+	before, _, _ := is.Issue(token.AgeBracketOver18, now.Add(2*time.Hour), now)
+	after, _, _ := is.Issue(token.AgeBracketOver18, now.Add(2*time.Hour), now.Add(40*time.Minute))
+	c1, err1 := ks.Verify(before, now.Add(15*time.Minute))
+	c2, err2 := ks.Verify(after, now.Add(45*time.Minute))
+	if err1 != nil || err2 != nil || c1.KeyID != oldKey.ID || c2.KeyID != newKey.ID {
+		t.Fatalf("rotation: %v %v", err1, err2)
+	}
+
+	// A verification-only keyset (edge node) accepts the credential but
+	// cannot sign.
+	edge := NewKeyset(NewEd25519VerifyKey(newKey.PublicKey(), newKey.NotBefore, newKey.NotAfter))
+	if _, err := edge.Verify(after, now.Add(45*time.Minute)); err != nil {
+		t.Errorf("edge Verify: %v", err)
+	}
+	if _, _, err := NewIssuer(edge).Issue(token.AgeBracketOver18, now.Add(2*time.Hour), now.Add(45*time.Minute)); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("got %v, want ErrNoSigningKey", err)
+	}
+
+	ks.Prune(now.Add(2 * time.Hour))
+	if _, err := ks.Verify(before, now.Add(15*time.Minute)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("pruned key: got %v, want ErrUnknownKey", err)
+	}
+	if _, err := NewHMACKey(make([]byte, 16), now, now.Add(time.Hour)); err == nil {
+		t.Error("short HMAC secret accepted")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	exp := time.Date(2026, 3, 1, 12, 20, 0, 0, time.UTC)
+	rec := httptest.NewRecorder()
+	SetCookie(rec, "abc", exp)
+	c := rec.Result().Cookies()[0]
+	if c.Name != CookieName || !c.Secure || !c.HttpOnly || c.Path != "/" || c.Domain != "" {
+		t.Errorf("unexpected cookie %+v", c)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(c)
+	if v, ok := FromRequest(req); !ok || v != "abc" {
+		t.Errorf("cookie: got %q", v)
+	}
+	req.Header.Set(Header, "def")
+	if v, _ := FromRequest(req); v != "def" {
+		t.Errorf("header: got %q", v)
+	}
+	if _, ok := FromRequest(httptest.NewRequest(http.MethodGet, "/", nil)); ok {
+		t.Error("credential found in empty request")
+	}
+}
+
+func TestExportToEdge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ed, mac := testKeys(t, now)
+	ks := NewKeyset(ed, mac)
+	distPub, dist, _ := ed25519.GenerateKey(rand.Reader)
+
+	data, err := ks.Export(dist, now)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if bytes.Contains(data, mac.secret) || bytes.Contains(data, []byte(base64.RawURLEncoding.EncodeToString(mac.secret))) {
+		t.Error("HMAC secret exported")
+	}
+
+	cred, _, _ := NewIssuer(NewKeyset(ed)).Issue(token.AgeBracketAge16_17, now.Add(time.Hour), now)
+	v := edge.NewVerifier(distPub)
+	if err := v.Update(data); err != nil {
+		t.Fatalf("edge Update: %v", err)
+	}
+	c, err := v.Verify(cred, now.Add(time.Minute))
+	if err != nil || c.Bracket() != "AGE_16_17" {
+		t.Fatalf("edge Verify: %+v, %v", c, err)
+	}
+
+	imported, err := ImportKeyset(data, distPub)
+	if err != nil {
+		t.Fatalf("ImportKeyset: %v", err)
+	}
+	if _, err := imported.Verify(cred, now.Add(time.Minute)); err != nil {
+		t.Errorf("imported Verify: %v", err)
+	}
+	if _, ok := imported.SigningKey(now); ok {
+		t.Error("imported keyset can sign")
+	}
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Transport names for the credential.
+const (
+	// CookieName uses the __Host- prefix: the cookie is Secure, has Path=/
+	// and no Domain, so it is bound to the VG host.
+	CookieName = "__Host-aavp_session"
+	// Header carries the credential in requests that do not use cookies.
+	Header = "AAVP-Session"
+)
+
+// Cookie returns the cookie carrying credential until expiresAt.
+func Cookie(credential string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    credential,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// SetCookie adds the credential cookie to the response.
+func SetCookie(w http.ResponseWriter, credential string, expiresAt time.Time) {
+	http.SetCookie(w, Cookie(credential, expiresAt))
+}
+
+// ClearCookie removes the credential cookie from the client.
+func ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// FromRequest returns the credential sent in the Header header or, failing
+// that, in the CookieName cookie.
+func FromRequest(r *http.Request) (string, bool) {
+	if v := strings.TrimSpace(r.Header.Get(Header)); v != "" {
+		return v, true
+	}
+	if c, err := r.Cookie(CookieName); err == nil && c.Value != "" {
+		return c.Value, true
+	}
+	return "", false
+}
@@ -0,0 +1,171 @@
+package spd
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aavp-protocol/aavp-go/jcs"
+)
+
+// MinKeySize is the smallest RSA modulus, in bits, accepted for SPD
+// signatures.
+const MinKeySize = 2048
+
+// SPD signature errors.
+var (
+	ErrMissingSignature = errors.New("spd: missing signature")
+	ErrInvalidSignature = errors.New("spd: signature verification failed")
+	ErrWeakKey          = errors.New("spd: RSA key shorter than 2048 bits")
+)
+
+// Canonical returns the canonical form of the SPD data (PROTOCOL.md section
+// 8.2.4): the document without its signature member, canonicalized with
+// RFC 8785. It is what the signature covers and what spd_hash digests.
+//
+// Received documents must be verified and hashed from the bytes as served:
+// decoding into a Document and encoding it again may change the canonical
+// form (lists left out of a bracket are written as []).
+func Canonical(data []byte) ([]byte, error) {
+	canonical, _, err := split(data)
+	return canonical, err
+}
+
+// Hash returns the spd_hash of the SPD data: SHA-256 of its canonical form
+// (PROTOCOL.md section 8.5.1).
+func Hash(data []byte) ([32]byte, error) {
+	canonical, err := Canonical(data)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(canonical), nil
+}
+
+// Verify checks the signature of the SPD data against the VG key pub.
+func Verify(data []byte, pub *rsa.PublicKey) error {
+	canonical, signature, err := split(data)
+	if err != nil {
+		return err
+	}
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	if pub.N.BitLen() < MinKeySize {
+		return ErrWeakKey
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: signature is not base64url", ErrInvalidSignature)
+	}
+	digest := sha256.Sum256(canonical)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Content returns the canonical form of data without signature and spts. It
+// is the policy itself, so it does not change when the platform adds the
+// SPTs it obtains and signs the document again.
+func Content(data []byte) ([]byte, error) {
+	members, err := members(data)
+	if err != nil {
+		return nil, err
+	}
+	delete(members, "signature")
+	delete(members, "spts")
+	canonical, err := jcs.Marshal(members)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	return canonical, nil
+}
+
+// ContentHash returns the hash covered by Signed Policy Timestamps: SHA-256
+// of Content(data).
+func ContentHash(data []byte) ([32]byte, error) {
+	content, err := Content(data)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
+
+// split canonicalizes data and returns the canonical form without the
+// signature member together with the signature.
+func split(data []byte) ([]byte, string, error) {
+	members, err := members(data)
+	if err != nil {
+		return nil, "", err
+	}
+	var signature string
+	if raw, ok := members["signature"]; ok {
+		if err := json.Unmarshal(raw, &signature); err != nil {
+			return nil, "", fmt.Errorf("%w: signature is not a string", ErrInvalidDocument)
+		}
+		delete(members, "signature")
+	}
+	canonical, err := jcs.Marshal(members)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	return canonical, signature, nil
+}
+
+// members checks that data is I-JSON and returns its top-level members.
+func members(data []byte) (map[string]json.RawMessage, error) {
+	whole, err := jcs.Canonicalize(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(whole, &m); err != nil || m == nil {
+		return nil, fmt.Errorf("%w: not a JSON object", ErrInvalidDocument)
+	}
+	return m, nil
+}
+
+// Canonical returns the canonical form of d without its signature.
+func (d *Document) Canonical() ([]byte, error) {
+	unsigned := *d
+	unsigned.Signature = ""
+	return jcs.Marshal(&unsigned)
+}
+
+// Hash returns the spd_hash of d.
+func (d *Document) Hash() ([32]byte, error) {
+	canonical, err := d.Canonical()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(canonical), nil
+}
+
+// Sign checks d with Validate and sets its signature with the VG key priv
+// (RSASSA-PKCS1-v1_5 with SHA-256, base64url without padding). Publishing
+// json.Marshal(d) gives a document that Verify accepts. Adding or changing
+// any field, including spts, requires signing again.
+func (d *Document) Sign(priv *rsa.PrivateKey) error {
+	if priv.N.BitLen() < MinKeySize {
+		return ErrWeakKey
+	}
+	if err := d.Validate(""); err != nil {
+		return err
+	}
+	canonical, err := d.Canonical()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(canonical)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		return fmt.Errorf("spd: %w", err)
+	}
+	d.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	return nil
+}
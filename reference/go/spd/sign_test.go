@@ -0,0 +1,121 @@
+package spd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Parse([]byte(exampleDocument), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Sign(key); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(data, &key.PublicKey); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := Parse(data, "example.com"); err != nil {
+		t.Fatalf("Parse signed document: %v", err)
+	}
+
+	// The hash covers the document as served, without its signature.
+	h, err := Hash(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dh, _ := d.Hash(); dh != h {
+		t.Error("Document.Hash differs from Hash of the served document")
+	}
+	canonical, _ := Canonical(data)
+	if strings.Contains(string(canonical), d.Signature) || strings.Contains(string(canonical), "\n") {
+		t.Errorf("canonical form = %s", canonical)
+	}
+
+	for name, tampered := range map[string]string{
+		"category": strings.Replace(string(data), `"adapted": [
+        "profanity"
+      ]`, `"adapted": []`, 1),
+		"signature": strings.Replace(string(data), d.Signature, d.Signature[:len(d.Signature)-2]+"AA", 1),
+	} {
+		if err := Verify([]byte(tampered), &key.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(data, &other.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other key: Verify = %v", err)
+	}
+	d.Signature = ""
+	unsigned, _ := json.Marshal(d)
+	if err := Verify(unsigned, &key.PublicKey); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("unsigned: Verify = %v", err)
+	}
+	if err := Verify([]byte(`{"a":1,"a":2}`), &key.PublicKey); !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("duplicate member: Verify = %v", err)
+	}
+}
+
+func TestSignRejects(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := Parse([]byte(exampleDocument), "")
+	if err := d.Sign(weak); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("1024-bit key: Sign = %v", err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := Parse([]byte(exampleDocument), "")
+	d.SPTs = nil
+	if err := d.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := json.Marshal(d)
+	h1, err := ContentHash(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding an SPT and signing again keeps the content hash.
+	d.SPTs = []SPT{{LogID: "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8", Timestamp: "2026-02-01T00:01:00Z", Signature: "c2lnbmF0dXJl"}}
+	if err := d.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := json.Marshal(d)
+	if h2, _ := ContentHash(second); h2 != h1 {
+		t.Error("content hash changed with the SPTs")
+	}
+	if a, _ := Hash(second); a == h1 {
+		t.Error("spd_hash of the document with SPTs equals the content hash")
+	}
+
+	d.PolicyURL = "https://example.com/other-policy"
+	third, _ := json.Marshal(d)
+	if h3, _ := ContentHash(third); h3 == h1 {
+		t.Error("content hash unchanged with the policy")
+	}
+}
@@ -0,0 +1,215 @@
+// Package spd implements the Segmentation Policy Declaration of PROTOCOL.md
+// section 8.2: the signed JSON document in which a platform declares, per age
+// bracket, which content categories are restricted, adapted or unrestricted.
+package spd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+const (
+	// WellKnownPath is the path of the SPD endpoint.
+	WellKnownPath = "/.well-known/aavp-age-policy.json"
+	// Version is the spd_version implemented by this package.
+	Version = "1.0"
+	// TaxonomyVersion identifies the content taxonomy of section 8.2.3.
+	TaxonomyVersion = "aavp-content-taxonomy-v1"
+)
+
+// Content categories of the minimum taxonomy (PROTOCOL.md section 8.2.3).
+const (
+	CategoryExplicitSexual  = "explicit-sexual"
+	CategoryViolenceGraphic = "violence-graphic"
+	CategoryGambling        = "gambling"
+	CategorySubstances      = "substances"
+	CategorySelfHarm        = "self-harm"
+	CategoryProfanity       = "profanity"
+)
+
+// ExtensionPrefix starts the platform-defined categories.
+const ExtensionPrefix = "x-"
+
+// All in an unrestricted list stands for every category.
+const All = "*"
+
+// Moderation approaches of ugc_handling.
+const (
+	ModerationAutomated = "automated"
+	ModerationHuman     = "human"
+	ModerationHybrid    = "hybrid"
+)
+
+// ErrInvalidDocument is returned for documents that do not follow the schema
+// of section 8.2.2.
+var ErrInvalidDocument = errors.New("spd: invalid SPD document")
+
+// Categories returns the categories of the minimum taxonomy.
+func Categories() []string {
+	return []string{
+		CategoryExplicitSexual,
+		CategoryViolenceGraphic,
+		CategoryGambling,
+		CategorySubstances,
+		CategorySelfHarm,
+		CategoryProfanity,
+	}
+}
+
+// IsExtension reports whether category is a platform-defined x- category:
+// the prefix followed by lowercase ASCII letters and digits, in groups
+// separated by single hyphens (x-de-jugendschutz, x-uk-vsc).
+func IsExtension(category string) bool {
+	name, ok := strings.CutPrefix(category, ExtensionPrefix)
+	if !ok || name == "" {
+		return false
+	}
+	for _, group := range strings.Split(name, "-") {
+		if group == "" {
+			return false
+		}
+		for _, c := range group {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidCategory reports whether category belongs to the minimum taxonomy or
+// is an extension.
+func ValidCategory(category string) bool {
+	return slices.Contains(Categories(), category) || IsExtension(category)
+}
+
+// Action is the level of action a platform applies to a category for a
+// bracket. Higher values are more restrictive.
+type Action uint8
+
+const (
+	Unrestricted Action = iota // no restrictions
+	Adapted                    // modified or reduced content
+	Restricted                 // blocked
+)
+
+// String returns the name of the action as used in the SPD.
+func (a Action) String() string {
+	switch a {
+	case Unrestricted:
+		return "unrestricted"
+	case Adapted:
+		return "adapted"
+	case Restricted:
+		return "restricted"
+	default:
+		return "unknown"
+	}
+}
+
+// Document is a Segmentation Policy Declaration (PROTOCOL.md section 8.2.2).
+// Published and the SPT timestamps are kept as sent so that the document
+// keeps its canonical form.
+type Document struct {
+	SPDVersion      string           `json:"spd_version"`
+	Platform        string           `json:"platform"`
+	Published       string           `json:"published"`
+	TaxonomyVersion string           `json:"taxonomy_version"`
+	Segmentation    map[string]Rules `json:"segmentation"`
+	PolicyURL       string           `json:"policy_url"`
+	UGCHandling     *UGCHandling     `json:"ugc_handling,omitempty"`
+	SPTs            []SPT            `json:"spts,omitempty"`
+	Signature       string           `json:"signature,omitempty"`
+}
+
+// Rules are the segmentation rules of one age bracket. A missing list is
+// read as empty (the OVER_18 entry of the example in section 8.2.2 only
+// lists unrestricted); all three are always written.
+type Rules struct {
+	Restricted   []string `json:"restricted"`
+	Adapted      []string `json:"adapted"`
+	Unrestricted []string `json:"unrestricted"`
+}
+
+// MarshalJSON writes nil lists as [].
+func (r Rules) MarshalJSON() ([]byte, error) {
+	type rules Rules
+	out := rules(r)
+	for _, l := range []*[]string{&out.Restricted, &out.Adapted, &out.Unrestricted} {
+		if *l == nil {
+			*l = []string{}
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UGCHandling declares how the platform moderates user-generated content.
+type UGCHandling struct {
+	Moderation     string `json:"moderation"`
+	ResponseTarget string `json:"response_target"` // ISO 8601 duration
+	Description    string `json:"description,omitempty"`
+}
+
+// SPT is a Signed Policy Timestamp issued by a Policy Transparency Log
+// (PROTOCOL.md section 8.3). LogID and Signature are base64url.
+type SPT struct {
+	LogID     string `json:"log_id"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// Parse decodes a published SPD served by host and checks it with Validate.
+// Unknown fields are rejected and the signature must be present; it is not
+// verified. An empty host skips the platform check.
+func Parse(data []byte, host string) (*Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var d Document
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%w: trailing data", ErrInvalidDocument)
+	}
+	if d.Signature == "" {
+		return nil, fmt.Errorf("%w: missing signature", ErrInvalidDocument)
+	}
+	if err := d.Validate(host); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Action returns the action the document declares for category in bracket.
+// If the category is listed more than once the most restrictive action wins.
+// A category the document does not declare for the bracket, or a bracket
+// without rules, is Restricted: the platform cannot serve more than it has
+// published. All in the unrestricted list opts every other category out.
+func (d *Document) Action(bracket uint8, category string) Action {
+	rules, ok := d.Segmentation[token.AgeBracketName(bracket)]
+	if !ok {
+		return Restricted
+	}
+	return rules.Action(category)
+}
+
+// Action returns the action the rules declare for category; undeclared
+// categories are Restricted unless the unrestricted list holds All.
+func (r *Rules) Action(category string) Action {
+	switch {
+	case slices.Contains(r.Restricted, category):
+		return Restricted
+	case slices.Contains(r.Adapted, category):
+		return Adapted
+	case slices.Contains(r.Unrestricted, category), slices.Contains(r.Unrestricted, All):
+		return Unrestricted
+	default:
+		return Restricted
+	}
+}
@@ -0,0 +1,184 @@
+package spd
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// exampleDocument is the example of PROTOCOL.md section 8.2.2 with
+// well-formed placeholders for the SPT and the signature.
+const exampleDocument = `{
+  "spd_version": "1.0",
+  "platform": "example.com",
+  "published": "2026-02-01T00:00:00Z",
+  "taxonomy_version": "aavp-content-taxonomy-v1",
+  "segmentation": {
+    "UNDER_13": {
+      "restricted": ["explicit-sexual", "violence-graphic", "gambling", "substances", "self-harm"],
+      "adapted": ["profanity"],
+      "unrestricted": []
+    },
+    "AGE_13_15": {
+      "restricted": ["explicit-sexual", "violence-graphic", "gambling"],
+      "adapted": ["substances", "self-harm", "profanity"],
+      "unrestricted": []
+    },
+    "AGE_16_17": {
+      "restricted": ["explicit-sexual"],
+      "adapted": ["violence-graphic", "gambling"],
+      "unrestricted": ["substances", "self-harm", "profanity"]
+    },
+    "OVER_18": {
+      "unrestricted": ["*"]
+    }
+  },
+  "policy_url": "https://example.com/age-policy",
+  "ugc_handling": {
+    "moderation": "hybrid",
+    "response_target": "PT4H",
+    "description": "ML classification pre-publish + human review queue"
+  },
+  "spts": [
+    {
+      "log_id": "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8",
+      "timestamp": "2026-02-01T00:01:00Z",
+      "signature": "c2lnbmF0dXJl"
+    }
+  ],
+  "signature": "c2lnbmF0dXJl"
+}`
+
+func TestAction(t *testing.T) {
+	d, err := Parse([]byte(exampleDocument), "example.com")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		bracket  uint8
+		category string
+		want     Action
+	}{
+		{token.AgeBracketUnder13, CategoryGambling, Restricted},
+		{token.AgeBracketUnder13, CategoryProfanity, Adapted},
+		{token.AgeBracketAge13_15, CategorySubstances, Adapted},
+		{token.AgeBracketAge16_17, CategoryGambling, Adapted},
+		{token.AgeBracketAge16_17, CategoryProfanity, Unrestricted},
+		{token.AgeBracketOver18, CategoryExplicitSexual, Unrestricted},
+		{token.AgeBracketOver18, "x-uk-vsc", Unrestricted},
+		// Categories not declared for a bracket are restricted.
+		{token.AgeBracketAge16_17, "x-de-jugendschutz", Restricted},
+		{4, CategoryProfanity, Restricted},
+	}
+	for _, tt := range tests {
+		if got := d.Action(tt.bracket, tt.category); got != tt.want {
+			t.Errorf("Action(%s, %s) = %s, want %s", token.AgeBracketName(tt.bracket), tt.category, got, tt.want)
+		}
+	}
+
+	// The most restrictive listing wins, and All opts the other categories out.
+	r := Rules{Adapted: []string{"x-a"}, Unrestricted: []string{All}}
+	if got := r.Action("x-a"); got != Adapted {
+		t.Errorf("Action(x-a) = %s, want adapted", got)
+	}
+	if got := r.Action("x-b"); got != Unrestricted {
+		t.Errorf("Action(x-b) = %s, want unrestricted", got)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	if _, err := Parse([]byte(exampleDocument), "EXAMPLE.com:443"); err != nil {
+		t.Fatalf("Parse with port: %v", err)
+	}
+	replace := func(old, new string) string { return strings.Replace(exampleDocument, old, new, 1) }
+	for name, tt := range map[string]struct{ data, host string }{
+		"version":      {replace(`"1.0"`, `"2.0"`), ""},
+		"taxonomy":     {replace(`aavp-content-taxonomy-v1`, `aavp-content-taxonomy-v2`), ""},
+		"other host":   {exampleDocument, "other.example"},
+		"platform url": {replace(`"platform": "example.com"`, `"platform": "https://example.com"`), ""},
+		"published":    {replace(`"2026-02-01T00:00:00Z"`, `"1 Feb 2026"`), ""},
+		"policy_url":   {replace(`https://example.com/age-policy`, `http://example.com/age-policy`), ""},
+		"bracket":      {replace(`"AGE_16_17"`, `"AGE_16_18"`), ""},
+		"missing bracket": {replace(`},
+    "OVER_18": {
+      "unrestricted": ["*"]
+    }`, `}`), ""},
+		"category":        {replace(`"gambling", "substances"`, `"gaming", "substances"`), ""},
+		"extension":       {replace(`"profanity"]`, `"x-Profanity"]`), ""},
+		"two lists":       {replace(`"adapted": ["profanity"]`, `"adapted": ["gambling"]`), ""},
+		"wildcard":        {replace(`"adapted": ["profanity"]`, `"adapted": ["*"]`), ""},
+		"moderation":      {replace(`"hybrid"`, `"manual"`), ""},
+		"response_target": {replace(`"PT4H"`, `"4 hours"`), ""},
+		"months":          {replace(`"PT4H"`, `"P1M"`), ""},
+		"spt log_id":      {replace(`"AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"`, `"AAEC"`), ""},
+		"spt timestamp":   {replace(`"2026-02-01T00:01:00Z"`, `""`), ""},
+		"missing signature": {replace(`,
+  "signature": "c2lnbmF0dXJl"`, ``), ""},
+		"signature encoding": {replace(`"signature": "c2lnbmF0dXJl"
+}`, `"signature": "c2lnbmF0dXJl=="
+}`), ""},
+		"unknown field": {replace(`"spd_version"`, `"x_field": 1, "spd_version"`), ""},
+		"missing field": {replace(`"policy_url": "https://example.com/age-policy",`, ``), ""},
+		"trailing data": {exampleDocument + `{}`, ""},
+		"not json":      {`{`, ""},
+	} {
+		if _, err := Parse([]byte(tt.data), tt.host); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("%s: Parse = %v, want ErrInvalidDocument", name, err)
+		}
+	}
+}
+
+func TestRulesJSON(t *testing.T) {
+	data, err := json.Marshal(Rules{Unrestricted: []string{All}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `{"restricted":[],"adapted":[],"unrestricted":["*"]}` {
+		t.Errorf("Marshal = %s", got)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"PT4H":       4 * time.Hour,
+		"P1DT12H":    36 * time.Hour,
+		"P2W":        14 * 24 * time.Hour,
+		"PT1H30M":    90 * time.Minute,
+		"PT0.5S":     500 * time.Millisecond,
+		"PT1,5S":     1500 * time.Millisecond,
+		"P0D":        0,
+		"PT36H":      36 * time.Hour,
+		"P1DT0H0M1S": 24*time.Hour + time.Second,
+	} {
+		if got, err := ParseDuration(s); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "P", "PT", "4H", "PT4", "PH", "P1Y", "P1M", "PT1M1H", "P1.5D", "PT1.5H", "P1DT", "pt4h", "PT-1H"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q) accepted", s)
+		}
+	}
+}
+
+func TestIsExtension(t *testing.T) {
+	for c, want := range map[string]bool{
+		"x-uk-vsc":          true,
+		"x-de-jugendschutz": true,
+		"x-pegi18":          true,
+		"x-":                false,
+		"x-a--b":            false,
+		"x-a-":              false,
+		"x-Foo":             false,
+		"gambling":          false,
+		"X-foo":             false,
+	} {
+		if got := IsExtension(c); got != want {
+			t.Errorf("IsExtension(%q) = %v", c, got)
+		}
+	}
+}
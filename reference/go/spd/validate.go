@@ -0,0 +1,223 @@
+package spd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+// Validate checks d against the schema of section 8.2.2: required fields,
+// spd_version and taxonomy_version, that platform is a hostname equal to host
+// (unless host is empty), that published and the SPT timestamps are RFC 3339
+// times, that policy_url is an HTTPS URI, the segmentation rules, ugc_handling
+// and the encoding of the SPTs and of the signature if present.
+//
+// Segmentation must have rules for each of the four bracket names
+// (token.AgeBracketName) and no other key. Each
+// category must belong to the taxonomy of section 8.2.3 or be an extension,
+// may appear in only one list of a bracket, and "*" is only allowed in
+// unrestricted.
+func (d *Document) Validate(host string) error {
+	if d.SPDVersion == "" || d.Platform == "" || d.Published == "" || d.TaxonomyVersion == "" ||
+		d.Segmentation == nil || d.PolicyURL == "" {
+		return fmt.Errorf("%w: missing required field", ErrInvalidDocument)
+	}
+	if d.SPDVersion != Version {
+		return fmt.Errorf("%w: unsupported spd_version %q", ErrInvalidDocument, d.SPDVersion)
+	}
+	if d.TaxonomyVersion != TaxonomyVersion {
+		return fmt.Errorf("%w: unsupported taxonomy_version %q", ErrInvalidDocument, d.TaxonomyVersion)
+	}
+	if !validHostname(d.Platform) {
+		return fmt.Errorf("%w: platform %q is not a hostname", ErrInvalidDocument, d.Platform)
+	}
+	if host != "" {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, d.Platform) {
+			return fmt.Errorf("%w: platform %q does not match %q", ErrInvalidDocument, d.Platform, host)
+		}
+	}
+	if _, err := d.PublishedAt(); err != nil {
+		return fmt.Errorf("%w: invalid published: %v", ErrInvalidDocument, err)
+	}
+	if u, err := url.Parse(d.PolicyURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: policy_url is not an HTTPS URI", ErrInvalidDocument)
+	}
+
+	for b := token.AgeBracketUnder13; b <= token.AgeBracketOver18; b++ {
+		if _, ok := d.Segmentation[token.AgeBracketName(b)]; !ok {
+			return fmt.Errorf("%w: segmentation has no rules for %s", ErrInvalidDocument, token.AgeBracketName(b))
+		}
+	}
+	for bracket, rules := range d.Segmentation {
+		if _, ok := token.ParseAgeBracket(bracket); !ok {
+			return fmt.Errorf("%w: unknown age bracket %q", ErrInvalidDocument, bracket)
+		}
+		if err := rules.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDocument, bracket, err)
+		}
+	}
+
+	if u := d.UGCHandling; u != nil {
+		switch u.Moderation {
+		case ModerationAutomated, ModerationHuman, ModerationHybrid:
+		default:
+			return fmt.Errorf("%w: invalid ugc_handling.moderation %q", ErrInvalidDocument, u.Moderation)
+		}
+		if _, err := ParseDuration(u.ResponseTarget); err != nil {
+			return fmt.Errorf("%w: invalid ugc_handling.response_target: %v", ErrInvalidDocument, err)
+		}
+	}
+	for i, spt := range d.SPTs {
+		if err := spt.validate(); err != nil {
+			return fmt.Errorf("%w: spts[%d]: %v", ErrInvalidDocument, i, err)
+		}
+	}
+	if d.Signature != "" {
+		if _, err := base64.RawURLEncoding.DecodeString(d.Signature); err != nil {
+			return fmt.Errorf("%w: signature is not base64url", ErrInvalidDocument)
+		}
+	}
+	return nil
+}
+
+// PublishedAt returns the published time.
+func (d *Document) PublishedAt() (time.Time, error) {
+	return time.Parse(time.RFC3339, d.Published)
+}
+
+func (r *Rules) validate() error {
+	seen := make(map[string]string)
+	for _, list := range []struct {
+		name       string
+		categories []string
+	}{
+		{"restricted", r.Restricted},
+		{"adapted", r.Adapted},
+		{"unrestricted", r.Unrestricted},
+	} {
+		for _, c := range list.categories {
+			if c == All {
+				if list.name != "unrestricted" {
+					return fmt.Errorf("%q in %s", All, list.name)
+				}
+			} else if !ValidCategory(c) {
+				return fmt.Errorf("unknown category %q", c)
+			}
+			if prev, ok := seen[c]; ok {
+				return fmt.Errorf("category %q listed in %s and %s", c, prev, list.name)
+			}
+			seen[c] = list.name
+		}
+	}
+	return nil
+}
+
+// Time returns the timestamp of the SPT.
+func (s *SPT) Time() (time.Time, error) {
+	return time.Parse(time.RFC3339, s.Timestamp)
+}
+
+func (s *SPT) validate() error {
+	if id, err := base64.RawURLEncoding.DecodeString(s.LogID); err != nil || len(id) != 32 {
+		return fmt.Errorf("invalid log_id %q", s.LogID)
+	}
+	if _, err := s.Time(); err != nil {
+		return fmt.Errorf("invalid timestamp: %v", err)
+	}
+	if sig, err := base64.RawURLEncoding.DecodeString(s.Signature); err != nil || len(sig) == 0 {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// ParseDuration parses an ISO 8601 duration such as PT4H or P1DT12H. Only
+// components of fixed length are accepted: weeks, days (of 24 hours), hours,
+// minutes and seconds, the last one with an optional decimal fraction. Years
+// and months are rejected.
+func ParseDuration(s string) (time.Duration, error) {
+	rest, ok := strings.CutPrefix(s, "P")
+	if !ok || rest == "" {
+		return 0, fmt.Errorf("spd: invalid duration %q", s)
+	}
+	date, clock, hasTime := strings.Cut(rest, "T")
+	if hasTime && clock == "" {
+		return 0, fmt.Errorf("spd: invalid duration %q", s)
+	}
+	var total float64
+	for _, part := range []struct {
+		s     string
+		units string
+	}{{date, "YMWD"}, {clock, "HMS"}} {
+		last := -1
+		for p := part.s; p != ""; {
+			i := strings.IndexFunc(p, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != ',' })
+			if i <= 0 {
+				return 0, fmt.Errorf("spd: invalid duration %q", s)
+			}
+			unit := strings.IndexByte(part.units, p[i])
+			if unit <= last {
+				return 0, fmt.Errorf("spd: invalid duration %q", s)
+			}
+			last = unit
+			num := strings.Replace(p[:i], ",", ".", 1)
+			designator := p[i]
+			p = p[i+1:]
+			if strings.Contains(num, ".") && (designator != 'S' || part.units != "HMS") {
+				return 0, fmt.Errorf("spd: fractional component in duration %q", s)
+			}
+			v, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("spd: invalid duration %q", s)
+			}
+			var unitLen time.Duration
+			switch {
+			case part.units == "YMWD" && (designator == 'Y' || designator == 'M'):
+				return 0, fmt.Errorf("spd: duration %q uses years or months, which have no fixed length", s)
+			case designator == 'W':
+				unitLen = 7 * 24 * time.Hour
+			case designator == 'D':
+				unitLen = 24 * time.Hour
+			case designator == 'H':
+				unitLen = time.Hour
+			case designator == 'M':
+				unitLen = time.Minute
+			default:
+				unitLen = time.Second
+			}
+			total += v * float64(unitLen)
+		}
+	}
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("spd: duration %q out of range", s)
+	}
+	return time.Duration(total), nil
+}
+
+// validHostname reports whether s is a DNS hostname: dot-separated labels of
+// letters, digits and hyphens that do not start or end with a hyphen.
+func validHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		if strings.ContainsFunc(label, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-')
+		}) {
+			return false
+		}
+	}
+	return true
+}
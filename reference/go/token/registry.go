@@ -0,0 +1,148 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TypeStatus is the registry status of a token_type value (PROTOCOL.md section 5.4).
+type TypeStatus uint8
+
+const (
+	// StatusReserved marks values that must never appear in a token (0x0000, 0xFFFF).
+	StatusReserved TypeStatus = iota
+	// StatusActive marks schemes that may be generated and accepted.
+	StatusActive
+	// StatusDeprecated marks retired schemes (migration phase 5). Tokens of a
+	// deprecated type can still be parsed but must not be generated or accepted.
+	StatusDeprecated
+)
+
+// String returns the registry name of the status.
+func (s TypeStatus) String() string {
+	switch s {
+	case StatusReserved:
+		return "Reserved"
+	case StatusActive:
+		return "Active"
+	case StatusDeprecated:
+		return "Deprecated"
+	default:
+		return fmt.Sprintf("TypeStatus(%d)", uint8(s))
+	}
+}
+
+// TypeInfo holds the parameters fixed by a token_type value. Each value fully
+// determines the scheme; there is no parameter negotiation within a type.
+type TypeInfo struct {
+	Value             uint16
+	Scheme            string
+	Hash              string
+	KeyBits           int
+	AuthenticatorSize int
+	Status            TypeStatus
+}
+
+// Size returns the total encoded token size for this token_type.
+func (ti TypeInfo) Size() int {
+	return OffsetAuthenticator + ti.AuthenticatorSize
+}
+
+// TokenTypeReservedMax is the reserved value at the top of the token_type space.
+const TokenTypeReservedMax uint16 = 0xFFFF
+
+// Registry errors.
+var (
+	ErrTypeAlreadyRegistered = errors.New("token: token_type already registered")
+	ErrInvalidTypeInfo       = errors.New("token: invalid token_type parameters")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[uint16]TypeInfo{
+		TokenTypeReserved: {
+			Value:  TokenTypeReserved,
+			Scheme: "Reserved",
+			Status: StatusReserved,
+		},
+		TokenTypeRSAPBSSASHA384: {
+			Value:             TokenTypeRSAPBSSASHA384,
+			Scheme:            "RSAPBSSA-SHA384",
+			Hash:              "SHA-384",
+			KeyBits:           2048,
+			AuthenticatorSize: SizeAuthenticator,
+			Status:            StatusActive,
+		},
+		TokenTypeReservedMax: {
+			Value:  TokenTypeReservedMax,
+			Scheme: "Reserved",
+			Status: StatusReserved,
+		},
+	}
+)
+
+// LookupType returns the registry entry for a token_type value.
+func LookupType(tt uint16) (TypeInfo, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	info, ok := registry[tt]
+	return info, ok
+}
+
+// RegisterType adds a new token_type to the registry. Registered values are
+// immutable: an existing value cannot be reassigned or have its parameters changed.
+func RegisterType(info TypeInfo) error {
+	if info.AuthenticatorSize <= 0 || info.Scheme == "" || info.Status == StatusReserved {
+		return ErrInvalidTypeInfo
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[info.Value]; exists {
+		return fmt.Errorf("%w: 0x%04x", ErrTypeAlreadyRegistered, info.Value)
+	}
+	registry[info.Value] = info
+	return nil
+}
+
+// DeprecateType marks an Active token_type as Deprecated (migration phase 5).
+func DeprecateType(tt uint16) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	info, ok := registry[tt]
+	if !ok || info.Status != StatusActive {
+		return fmt.Errorf("token: token_type 0x%04x is not active", tt)
+	}
+	info.Status = StatusDeprecated
+	registry[tt] = info
+	return nil
+}
+
+// RegisteredTypes returns all registry entries ordered by value.
+func RegisteredTypes() []TypeInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]TypeInfo, 0, len(registry))
+	for _, info := range registry {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Value < out[j].Value })
+	return out
+}
+
+// IsActiveType returns true if the token_type is registered with status Active.
+func IsActiveType(tt uint16) bool {
+	info, ok := LookupType(tt)
+	return ok && info.Status == StatusActive
+}
+
+// SizeForType returns the expected encoded token size for a token_type.
+// Reserved and unregistered values have no defined size.
+func SizeForType(tt uint16) (int, error) {
+	info, ok := LookupType(tt)
+	if !ok || info.Status == StatusReserved {
+		return 0, fmt.Errorf("%w: 0x%04x", ErrUnknownTokenType, tt)
+	}
+	return info.Size(), nil
+}
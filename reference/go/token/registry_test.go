@@ -0,0 +1,132 @@
+package token
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestRegistryDefaults(t *testing.T) {
+	info, ok := LookupType(TokenTypeRSAPBSSASHA384)
+	if !ok {
+		t.Fatal("0x0001 not registered")
+	}
+	if info.Status != StatusActive {
+		t.Errorf("0x0001 status: got %s, want Active", info.Status)
+	}
+	if info.Size() != TokenSize {
+		t.Errorf("0x0001 size: got %d, want %d", info.Size(), TokenSize)
+	}
+	for _, tt := range []uint16{TokenTypeReserved, TokenTypeReservedMax} {
+		info, ok := LookupType(tt)
+		if !ok || info.Status != StatusReserved {
+			t.Errorf("0x%04x should be registered as Reserved", tt)
+		}
+		if _, err := SizeForType(tt); !errors.Is(err, ErrUnknownTokenType) {
+			t.Errorf("SizeForType(0x%04x): expected ErrUnknownTokenType, got %v", tt, err)
+		}
+	}
+	if _, ok := LookupType(0x0002); ok {
+		t.Error("0x0002 should not be registered")
+	}
+}
+
+func TestRegisterTypeImmutable(t *testing.T) {
+	err := RegisterType(TypeInfo{
+		Value:             TokenTypeRSAPBSSASHA384,
+		Scheme:            "RSAPBSSA-SHA512",
+		AuthenticatorSize: 256,
+		Status:            StatusActive,
+	})
+	if !errors.Is(err, ErrTypeAlreadyRegistered) {
+		t.Errorf("expected ErrTypeAlreadyRegistered, got %v", err)
+	}
+	if err := RegisterType(TypeInfo{Value: 0x02fe, Scheme: "x", Status: StatusActive}); !errors.Is(err, ErrInvalidTypeInfo) {
+		t.Errorf("expected ErrInvalidTypeInfo for zero authenticator size, got %v", err)
+	}
+}
+
+func TestDecodeDispatchesOnTokenType(t *testing.T) {
+	// A hypothetical post-quantum scheme with a larger authenticator.
+	const pqType uint16 = 0x02ff
+	if err := RegisterType(TypeInfo{
+		Value:             pqType,
+		Scheme:            "TEST-PQ",
+		Hash:              "SHA-512",
+		AuthenticatorSize: 3309,
+		Status:            StatusActive,
+	}); err != nil {
+		t.Fatalf("RegisterType: %v", err)
+	}
+
+	tok := &Token{
+		TokenType:     pqType,
+		AgeBracket:    AgeBracketAge16_17,
+		ExpiresAt:     1772330400,
+		Authenticator: make([]byte, 3309),
+	}
+	tok.Authenticator[0] = 0xaa
+	tok.Authenticator[3308] = 0xbb
+
+	encoded := Encode(tok)
+	if len(encoded) != OffsetAuthenticator+3309 {
+		t.Fatalf("encoded size: got %d", len(encoded))
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if decoded.TokenType != pqType || len(decoded.Authenticator) != 3309 {
+		t.Fatalf("decoded type 0x%04x with %d-byte authenticator", decoded.TokenType, len(decoded.Authenticator))
+	}
+	if decoded.Authenticator[0] != 0xaa || decoded.Authenticator[3308] != 0xbb {
+		t.Error("authenticator content mismatch")
+	}
+
+	// A 331-byte buffer claiming the new type has the wrong size for it.
+	wrong := make([]byte, TokenSize)
+	binary.BigEndian.PutUint16(wrong, pqType)
+	if _, err := Decode(wrong); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("expected ErrInvalidSize, got %v", err)
+	}
+
+	// 0x0001 tokens keep decoding at 331 bytes.
+	legacy := make([]byte, TokenSize)
+	binary.BigEndian.PutUint16(legacy, TokenTypeRSAPBSSASHA384)
+	if _, err := Decode(legacy); err != nil {
+		t.Errorf("Decode 0x0001: %v", err)
+	}
+}
+
+func TestDecodeRejectsUnregisteredType(t *testing.T) {
+	b := make([]byte, TokenSize)
+	binary.BigEndian.PutUint16(b, 0x0003)
+	if _, err := Decode(b); !errors.Is(err, ErrUnknownTokenType) {
+		t.Errorf("expected ErrUnknownTokenType, got %v", err)
+	}
+	if _, err := Decode([]byte{0x00}); !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("expected ErrInvalidSize for 1-byte input, got %v", err)
+	}
+}
+
+func TestDeprecateType(t *testing.T) {
+	const oldType uint16 = 0x00fe
+	if err := RegisterType(TypeInfo{Value: oldType, Scheme: "TEST-OLD", AuthenticatorSize: 128, Status: StatusActive}); err != nil {
+		t.Fatalf("RegisterType: %v", err)
+	}
+	if err := DeprecateType(oldType); err != nil {
+		t.Fatalf("DeprecateType: %v", err)
+	}
+	if IsActiveType(oldType) {
+		t.Error("deprecated type reported as active")
+	}
+	if err := DeprecateType(oldType); err == nil {
+		t.Error("expected error deprecating an already deprecated type")
+	}
+	// Deprecated tokens still parse, so linters and migration tooling can inspect them.
+	b := make([]byte, OffsetAuthenticator+128)
+	binary.BigEndian.PutUint16(b, oldType)
+	if _, err := Decode(b); err != nil {
+		t.Errorf("Decode deprecated type: %v", err)
+	}
+}
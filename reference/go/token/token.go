@@ -1,5 +1,6 @@
-// Package token implements encoding and decoding of the AAVP 331-byte binary token format
-// as specified in PROTOCOL.md section 2.
+// Package token implements encoding and decoding of the AAVP binary token format
+// as specified in PROTOCOL.md section 2. The token size depends on the token_type
+// (331 bytes for 0x0001); see the registry in registry.go (PROTOCOL.md section 5.4).
 package token
 
 import (
@@ -9,7 +10,7 @@ import (
 )
 
 const (
-	// TokenSize is the fixed size of an AAVP token in bytes.
+	// TokenSize is the size of a token_type 0x0001 token in bytes.
 	TokenSize = 331
 
 	// Field offsets within the token.
@@ -26,7 +27,7 @@ const (
 	SizeTokenKeyID    = 32
 	SizeAgeBracket    = 1
 	SizeExpiresAt     = 8
-	SizeAuthenticator = 256
+	SizeAuthenticator = 256 // token_type 0x0001
 
 	// MessageToSignSize is the size of the portion signed (everything except authenticator).
 	MessageToSignSize = 75
@@ -65,45 +66,83 @@ func AgeBracketName(b uint8) string {
 	}
 }
 
+// ParseAgeBracket returns the age bracket value for a canonical name as
+// returned by AgeBracketName.
+func ParseAgeBracket(name string) (uint8, bool) {
+	for b := AgeBracketUnder13; b <= AgeBracketOver18; b++ {
+		if AgeBracketName(b) == name {
+			return b, true
+		}
+	}
+	return 0, false
+}
+
 // ValidAgeBracket returns true if the given value is a valid age bracket.
 func ValidAgeBracket(b uint8) bool {
 	return b <= AgeBracketOver18
 }
 
+// Decoding errors.
+var (
+	ErrInvalidSize      = errors.New("invalid token size")
+	ErrUnknownTokenType = errors.New("unknown token_type")
+)
+
 // Token represents an AAVP token with its six fields.
+// The length of Authenticator is fixed by TokenType (256 bytes for 0x0001).
 type Token struct {
 	TokenType     uint16
 	Nonce         [SizeNonce]byte
 	TokenKeyID    [SizeTokenKeyID]byte
 	AgeBracket    uint8
 	ExpiresAt     uint64
-	Authenticator [SizeAuthenticator]byte
+	Authenticator []byte
 }
 
-// Encode serializes a Token into the 331-byte binary format.
-func Encode(t *Token) [TokenSize]byte {
-	var buf [TokenSize]byte
+// Encode serializes a Token into the binary format.
+func Encode(t *Token) []byte {
+	buf := make([]byte, OffsetAuthenticator+len(t.Authenticator))
 	binary.BigEndian.PutUint16(buf[OffsetTokenType:], t.TokenType)
 	copy(buf[OffsetNonce:], t.Nonce[:])
 	copy(buf[OffsetTokenKeyID:], t.TokenKeyID[:])
 	buf[OffsetAgeBracket] = t.AgeBracket
 	binary.BigEndian.PutUint64(buf[OffsetExpiresAt:], t.ExpiresAt)
-	copy(buf[OffsetAuthenticator:], t.Authenticator[:])
+	copy(buf[OffsetAuthenticator:], t.Authenticator)
 	return buf
 }
 
-// Decode deserializes a byte slice into a Token. Returns an error if the size is not exactly 331 bytes.
+// PeekTokenType reads the token_type from the first two bytes without parsing the rest.
+func PeekTokenType(b []byte) (uint16, error) {
+	if len(b) < SizeTokenType {
+		return 0, fmt.Errorf("%w: %d bytes", ErrInvalidSize, len(b))
+	}
+	return binary.BigEndian.Uint16(b[OffsetTokenType:]), nil
+}
+
+// Decode deserializes a byte slice into a Token. The expected size is determined
+// from the token_type in the first two bytes before the rest is parsed.
+// Returns an error if the token_type is reserved or unregistered, or if the size
+// does not match the size defined for that token_type.
 func Decode(b []byte) (*Token, error) {
-	if len(b) != TokenSize {
-		return nil, errors.New("invalid token size: expected 331 bytes")
+	tt, err := PeekTokenType(b)
+	if err != nil {
+		return nil, err
+	}
+	size, err := SizeForType(tt)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("%w: expected %d bytes for token_type 0x%04x, got %d", ErrInvalidSize, size, tt, len(b))
 	}
 	t := &Token{}
-	t.TokenType = binary.BigEndian.Uint16(b[OffsetTokenType:])
+	t.TokenType = tt
 	copy(t.Nonce[:], b[OffsetNonce:OffsetNonce+SizeNonce])
 	copy(t.TokenKeyID[:], b[OffsetTokenKeyID:OffsetTokenKeyID+SizeTokenKeyID])
 	t.AgeBracket = b[OffsetAgeBracket]
 	t.ExpiresAt = binary.BigEndian.Uint64(b[OffsetExpiresAt:])
-	copy(t.Authenticator[:], b[OffsetAuthenticator:OffsetAuthenticator+SizeAuthenticator])
+	t.Authenticator = make([]byte, size-OffsetAuthenticator)
+	copy(t.Authenticator, b[OffsetAuthenticator:])
 	return t, nil
 }
 
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"os"
@@ -61,15 +62,13 @@ func hexToArray32(t *testing.T, s string) [32]byte {
 	return arr
 }
 
-func hexToArray256(t *testing.T, s string) [256]byte {
+func hexToAuthenticator(t *testing.T, s string) []byte {
 	t.Helper()
 	b := hexToBytes(t, s)
-	if len(b) != 256 {
-		t.Fatalf("expected 256 bytes, got %d", len(b))
+	if len(b) != SizeAuthenticator {
+		t.Fatalf("expected %d bytes, got %d", SizeAuthenticator, len(b))
 	}
-	var arr [256]byte
-	copy(arr[:], b)
-	return arr
+	return b
 }
 
 func TestEncodeDecodeVectors(t *testing.T) {
@@ -82,7 +81,7 @@ func TestEncodeDecodeVectors(t *testing.T) {
 				TokenKeyID:    hexToArray32(t, v.Fields.TokenKeyID),
 				AgeBracket:    v.Fields.AgeBracketVal,
 				ExpiresAt:     v.Fields.ExpiresAt,
-				Authenticator: hexToArray256(t, v.Fields.Authenticator),
+				Authenticator: hexToAuthenticator(t, v.Fields.Authenticator),
 			}
 
 			// Encode and compare with expected hex.
@@ -120,13 +119,13 @@ func TestEncodeDecodeVectors(t *testing.T) {
 			if decoded.ExpiresAt != v.Fields.ExpiresAt {
 				t.Errorf("ExpiresAt: got %d, want %d", decoded.ExpiresAt, v.Fields.ExpiresAt)
 			}
-			if hex.EncodeToString(decoded.Authenticator[:]) != v.Fields.Authenticator {
+			if hex.EncodeToString(decoded.Authenticator) != v.Fields.Authenticator {
 				t.Errorf("Authenticator mismatch")
 			}
 
 			// Re-encode the decoded token and verify byte-for-byte.
 			reencoded := Encode(decoded)
-			if reencoded != encoded {
+			if !bytes.Equal(reencoded, encoded) {
 				t.Error("re-encoded token does not match original encoding")
 			}
 		})
@@ -192,5 +191,11 @@ func TestAgeBracketName(t *testing.T) {
 		if got := AgeBracketName(tt.val); got != tt.name {
 			t.Errorf("AgeBracketName(%d) = %q, want %q", tt.val, got, tt.name)
 		}
+		if got, ok := ParseAgeBracket(tt.name); !ok || got != tt.val {
+			t.Errorf("ParseAgeBracket(%q) = %d, %v", tt.name, got, ok)
+		}
+	}
+	if _, ok := ParseAgeBracket("UNKNOWN(4)"); ok {
+		t.Error("ParseAgeBracket accepted an undefined name")
 	}
 }
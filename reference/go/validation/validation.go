@@ -4,29 +4,45 @@ package validation
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/aavp-protocol/aavp-go/token"
 )
 
-// Protocol constants.
+// Protocol constants. These are the canonical defaults and also the maxima
+// that a Validator may be configured with (PROTOCOL.md section 3).
 const (
-	ClockSkewTolerancePast   = 300   // seconds (5 minutes)
-	ClockSkewToleranceFuture = 60    // seconds (1 minute)
-	MaxTTLHours              = 4     // hours
+	ClockSkewTolerancePast   = 300 // seconds (5 minutes)
+	ClockSkewToleranceFuture = 60  // seconds (1 minute)
+	MaxTTLHours              = 4   // hours
 	MaxTTLSeconds            = MaxTTLHours * 3600
 )
 
 // Validation errors.
 var (
-	ErrInvalidTokenSize           = errors.New("invalid_token_size")
-	ErrUnsupportedTokenType       = errors.New("unsupported_token_type")
-	ErrInvalidAgeBracket          = errors.New("invalid_age_bracket")
-	ErrTokenExpired               = errors.New("token_expired")
-	ErrExpiresAtTooFarFuture      = errors.New("expires_at_too_far_future")
+	ErrInvalidTokenSize            = errors.New("invalid_token_size")
+	ErrUnsupportedTokenType        = errors.New("unsupported_token_type")
+	ErrInvalidAgeBracket           = errors.New("invalid_age_bracket")
+	ErrTokenExpired                = errors.New("token_expired")
+	ErrExpiresAtTooFarFuture       = errors.New("expires_at_too_far_future")
 	ErrSignatureVerificationFailed = errors.New("signature_verification_failed")
 )
 
+// signatureError reports a failed signature verification. Its message is
+// that of ErrSignatureVerificationFailed, and it matches both that error and
+// the error of the verification callback with errors.Is, so that callers can
+// tell the causes apart without changing the reported error code.
+type signatureError struct {
+	cause error
+}
+
+func (e *signatureError) Error() string   { return ErrSignatureVerificationFailed.Error() }
+func (e *signatureError) Unwrap() []error { return []error{ErrSignatureVerificationFailed, e.cause} }
+
+// ErrInvalidConfig is returned by NewValidator for configurations outside the spec limits.
+var ErrInvalidConfig = errors.New("validation: invalid configuration")
+
 // ValidationResult contains the validated token information.
 type ValidationResult struct {
 	AgeBracket uint8
@@ -34,51 +50,143 @@ type ValidationResult struct {
 	TokenType  uint16
 }
 
-// AcceptedTokenTypes is the default set of accepted token types.
-var AcceptedTokenTypes = []uint16{token.TokenTypeRSAPBSSASHA384}
+// Config holds the validation policy of a Verification Gate.
+type Config struct {
+	// AcceptedTokenTypes lists the accepted token_type values. Each must be
+	// registered with status Active.
+	AcceptedTokenTypes []uint16
+	// ClockSkewPast is how long after expires_at a token is still accepted.
+	ClockSkewPast time.Duration
+	// ClockSkewFuture is the tolerance added on top of MaxTTL for expires_at
+	// values in the future.
+	ClockSkewFuture time.Duration
+	// MaxTTL is the longest token lifetime accepted.
+	MaxTTL time.Duration
+}
+
+// DefaultConfig returns the canonical configuration: token_type 0x0001,
+// 300s past tolerance, 60s future tolerance and a 4h TTL ceiling.
+func DefaultConfig() Config {
+	return Config{
+		AcceptedTokenTypes: []uint16{token.TokenTypeRSAPBSSASHA384},
+		ClockSkewPast:      ClockSkewTolerancePast * time.Second,
+		ClockSkewFuture:    ClockSkewToleranceFuture * time.Second,
+		MaxTTL:             MaxTTLSeconds * time.Second,
+	}
+}
+
+// Validator applies a fixed validation policy. The configuration cannot be
+// changed after construction, so a Validator is safe for concurrent use and
+// several Validators with different policies can coexist in one process.
+type Validator struct {
+	accepted   []uint16
+	skewPast   uint64
+	skewFuture uint64
+	maxTTL     uint64
+}
+
+// NewValidator creates a Validator from cfg. It refuses configurations that
+// exceed the maxima of PROTOCOL.md section 3 or accept non-active token types.
+func NewValidator(cfg Config) (*Validator, error) {
+	if len(cfg.AcceptedTokenTypes) == 0 {
+		return nil, fmt.Errorf("%w: no accepted token types", ErrInvalidConfig)
+	}
+	for _, tt := range cfg.AcceptedTokenTypes {
+		if !token.IsActiveType(tt) {
+			return nil, fmt.Errorf("%w: token_type 0x%04x is not an active registered type", ErrInvalidConfig, tt)
+		}
+	}
+	if cfg.ClockSkewPast < 0 || cfg.ClockSkewPast > ClockSkewTolerancePast*time.Second {
+		return nil, fmt.Errorf("%w: past clock skew %v outside [0, %ds]", ErrInvalidConfig, cfg.ClockSkewPast, ClockSkewTolerancePast)
+	}
+	if cfg.ClockSkewFuture < 0 || cfg.ClockSkewFuture > ClockSkewToleranceFuture*time.Second {
+		return nil, fmt.Errorf("%w: future clock skew %v outside [0, %ds]", ErrInvalidConfig, cfg.ClockSkewFuture, ClockSkewToleranceFuture)
+	}
+	if cfg.MaxTTL <= 0 || cfg.MaxTTL > MaxTTLSeconds*time.Second {
+		return nil, fmt.Errorf("%w: max TTL %v outside (0, %dh]", ErrInvalidConfig, cfg.MaxTTL, MaxTTLHours)
+	}
+	return &Validator{
+		accepted:   append([]uint16(nil), cfg.AcceptedTokenTypes...),
+		skewPast:   uint64(cfg.ClockSkewPast / time.Second),
+		skewFuture: uint64(cfg.ClockSkewFuture / time.Second),
+		maxTTL:     uint64(cfg.MaxTTL / time.Second),
+	}, nil
+}
 
-// Validate checks a raw token according to VG validation rules.
+var defaultValidator = func() *Validator {
+	v, err := NewValidator(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return v
+}()
+
+// Default returns the shared Validator with the canonical configuration.
+func Default() *Validator {
+	return defaultValidator
+}
+
+// Config returns a copy of the Validator's configuration.
+func (v *Validator) Config() Config {
+	return Config{
+		AcceptedTokenTypes: append([]uint16(nil), v.accepted...),
+		ClockSkewPast:      time.Duration(v.skewPast) * time.Second,
+		ClockSkewFuture:    time.Duration(v.skewFuture) * time.Second,
+		MaxTTL:             time.Duration(v.maxTTL) * time.Second,
+	}
+}
+
+// Validate checks a raw token according to VG validation rules using the
+// default configuration. See Validator.Validate.
+func Validate(tokenBytes []byte, now time.Time, verifySignature func([]byte) error) (*ValidationResult, error) {
+	return defaultValidator.Validate(tokenBytes, now, verifySignature)
+}
+
+// Validate checks a raw token according to the Validator's policy.
 // verifySignature is a callback that verifies the token's cryptographic signature.
 // If verifySignature is nil, signature verification is skipped.
-func Validate(tokenBytes []byte, now time.Time, verifySignature func([]byte) error) (*ValidationResult, error) {
-	// 1. Size check.
-	if len(tokenBytes) != token.TokenSize {
+func (v *Validator) Validate(tokenBytes []byte, now time.Time, verifySignature func([]byte) error) (*ValidationResult, error) {
+	// 1. token_type check. The scheme, and therefore the expected size,
+	// is determined from the token_type before parsing the rest.
+	tt, err := token.PeekTokenType(tokenBytes)
+	if err != nil {
 		return nil, ErrInvalidTokenSize
 	}
+	if !v.Accepts(tt) {
+		return nil, ErrUnsupportedTokenType
+	}
 
-	// 2. Decode fields.
+	// 2. Size check and field decoding.
 	tok, err := token.Decode(tokenBytes)
 	if err != nil {
+		if errors.Is(err, token.ErrUnknownTokenType) {
+			return nil, ErrUnsupportedTokenType
+		}
 		return nil, ErrInvalidTokenSize
 	}
 
-	// 3. token_type check.
-	if !isAcceptedTokenType(tok.TokenType) {
-		return nil, ErrUnsupportedTokenType
-	}
-
-	// 4. age_bracket check.
+	// 3. age_bracket check.
 	if !token.ValidAgeBracket(tok.AgeBracket) {
 		return nil, ErrInvalidAgeBracket
 	}
 
-	// 5. Expiration (past) check.
+	// 4. Expiration (past) check.
 	nowUnix := uint64(now.Unix())
 	expiresAt := tok.ExpiresAt
-	if nowUnix > expiresAt && (nowUnix-expiresAt) > ClockSkewTolerancePast {
+	if nowUnix > expiresAt && (nowUnix-expiresAt) > v.skewPast {
 		return nil, ErrTokenExpired
 	}
 
-	// 6. Expiration (future) check.
-	maxFuture := uint64(MaxTTLSeconds + ClockSkewToleranceFuture)
+	// 5. Expiration (future) check.
+	maxFuture := v.maxTTL + v.skewFuture
 	if expiresAt > nowUnix && (expiresAt-nowUnix) > maxFuture {
 		return nil, ErrExpiresAtTooFarFuture
 	}
 
-	// 7. Signature verification (if callback provided).
+	// 6. Signature verification (if callback provided).
 	if verifySignature != nil {
 		if err := verifySignature(tokenBytes); err != nil {
-			return nil, ErrSignatureVerificationFailed
+			return nil, &signatureError{cause: err}
 		}
 	}
 
@@ -89,8 +197,13 @@ func Validate(tokenBytes []byte, now time.Time, verifySignature func([]byte) err
 	}, nil
 }
 
-func isAcceptedTokenType(tt uint16) bool {
-	for _, accepted := range AcceptedTokenTypes {
+// Accepts reports whether the token_type is accepted by this Validator.
+// A type deprecated in the registry after construction is no longer accepted.
+func (v *Validator) Accepts(tt uint16) bool {
+	if !token.IsActiveType(tt) {
+		return false
+	}
+	for _, accepted := range v.accepted {
 		if tt == accepted {
 			return true
 		}
@@ -115,3 +115,88 @@ func TestValidationVectors(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultConfigMatchesConstants(t *testing.T) {
+	cfg := Default().Config()
+	if cfg.ClockSkewPast != ClockSkewTolerancePast*time.Second {
+		t.Errorf("ClockSkewPast: got %v", cfg.ClockSkewPast)
+	}
+	if cfg.ClockSkewFuture != ClockSkewToleranceFuture*time.Second {
+		t.Errorf("ClockSkewFuture: got %v", cfg.ClockSkewFuture)
+	}
+	if cfg.MaxTTL != MaxTTLHours*time.Hour {
+		t.Errorf("MaxTTL: got %v", cfg.MaxTTL)
+	}
+	if len(cfg.AcceptedTokenTypes) != 1 || cfg.AcceptedTokenTypes[0] != token.TokenTypeRSAPBSSASHA384 {
+		t.Errorf("AcceptedTokenTypes: got %v", cfg.AcceptedTokenTypes)
+	}
+}
+
+func TestNewValidatorRejectsOutOfSpecConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"no token types", func(c *Config) { c.AcceptedTokenTypes = nil }},
+		{"reserved token type", func(c *Config) { c.AcceptedTokenTypes = []uint16{token.TokenTypeReserved} }},
+		{"unregistered token type", func(c *Config) { c.AcceptedTokenTypes = []uint16{0x0002} }},
+		{"past skew above maximum", func(c *Config) { c.ClockSkewPast = 301 * time.Second }},
+		{"future skew above maximum", func(c *Config) { c.ClockSkewFuture = 61 * time.Second }},
+		{"negative past skew", func(c *Config) { c.ClockSkewPast = -time.Second }},
+		{"TTL above maximum", func(c *Config) { c.MaxTTL = 4*time.Hour + time.Second }},
+		{"zero TTL", func(c *Config) { c.MaxTTL = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			if _, err := NewValidator(cfg); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatorsWithDifferentPolicies(t *testing.T) {
+	f := loadValidationVectors(t)
+	var tokenBytes []byte
+	var now time.Time
+	for _, v := range f.Vectors {
+		// Valid token expiring 3 hours after vg_current_time.
+		if v.ExpectedResult == "valid" && v.ParsedFields != nil &&
+			v.ParsedFields.ExpiresAt == uint64(v.VGCurrentTime)+3*3600 {
+			tokenBytes, _ = hex.DecodeString(v.TokenHex)
+			now = time.Unix(v.VGCurrentTime, 0)
+			break
+		}
+	}
+	if tokenBytes == nil {
+		t.Fatal("no 3-hour valid vector found")
+	}
+
+	strict, err := NewValidator(Config{
+		AcceptedTokenTypes: []uint16{token.TokenTypeRSAPBSSASHA384},
+		ClockSkewPast:      30 * time.Second,
+		ClockSkewFuture:    0,
+		MaxTTL:             2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+
+	if _, err := Default().Validate(tokenBytes, now, nil); err != nil {
+		t.Errorf("default validator: %v", err)
+	}
+	if _, err := strict.Validate(tokenBytes, now, nil); !errors.Is(err, ErrExpiresAtTooFarFuture) {
+		t.Errorf("strict validator: expected %v, got %v", ErrExpiresAtTooFarFuture, err)
+	}
+
+	// 60 seconds past expiry: within the default tolerance, outside the strict one.
+	late := now.Add(3*time.Hour + time.Minute)
+	if _, err := Default().Validate(tokenBytes, late, nil); err != nil {
+		t.Errorf("default validator after expiry: %v", err)
+	}
+	if _, err := strict.Validate(tokenBytes, late, nil); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("strict validator after expiry: expected %v, got %v", ErrTokenExpired, err)
+	}
+}
@@ -185,7 +185,7 @@ func main() {
 		}
 
 		// Build complete token
-		copy(tok.Authenticator[:], sig)
+		tok.Authenticator = sig
 		fullToken := token.Encode(tok)
 
 		fmt.Printf("  authenticator: %s...\n", hex.EncodeToString(sig[:16]))
@@ -3,15 +3,22 @@
 package vectors
 
 import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"math"
 	"math/big"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/aavp-protocol/aavp-go/jcs"
 	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/spd"
 	"github.com/aavp-protocol/aavp-go/token"
 	"github.com/aavp-protocol/aavp-go/validation"
 )
@@ -81,7 +88,7 @@ func TestTokenEncodingVectors(t *testing.T) {
 				t.Fatalf("decode: %v", err)
 			}
 			reencoded := token.Encode(decoded)
-			if reencoded != encoded {
+			if !bytes.Equal(reencoded, encoded) {
 				t.Error("re-encoded mismatch")
 			}
 		})
@@ -363,9 +370,7 @@ func TestIssuanceVectorsCrypto(t *testing.T) {
 			}
 
 			// Expected token: assemble and compare
-			var auth [256]byte
-			copy(auth[:], authenticator)
-			tok.Authenticator = auth
+			tok.Authenticator = authenticator
 			encoded := token.Encode(tok)
 			if hex.EncodeToString(encoded[:]) != v.ExpectedToken.TokenHex {
 				t.Error("expected_token: hex mismatch")
@@ -377,6 +382,139 @@ func TestIssuanceVectorsCrypto(t *testing.T) {
 	}
 }
 
+// --- JSON Canonicalization Vectors ---
+
+type jcsVectorFile struct {
+	Vectors []struct {
+		Name        string `json:"name"`
+		Input       string `json:"input"`
+		Expected    string `json:"expected"`
+		ExpectedHex string `json:"expected_hex"`
+	} `json:"vectors"`
+	NumberVectors []struct {
+		IEEE754  string `json:"ieee754_hex"`
+		Expected string `json:"expected"`
+	} `json:"number_vectors"`
+	InvalidVectors []struct {
+		Name     string `json:"name"`
+		Input    string `json:"input"`
+		InputHex string `json:"input_hex"`
+	} `json:"invalid_vectors"`
+}
+
+func TestJCSVectors(t *testing.T) {
+	data, err := os.ReadFile("../../../test-vectors/jcs-canonicalization.json")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var f jcsVectorFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	for _, v := range f.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			got, err := jcs.Canonicalize([]byte(v.Input))
+			if err != nil {
+				t.Fatalf("Canonicalize: %v", err)
+			}
+			if string(got) != v.Expected || hex.EncodeToString(got) != v.ExpectedHex {
+				t.Errorf("got %s, want %s", got, v.Expected)
+			}
+		})
+	}
+	for _, v := range f.NumberVectors {
+		bits := hexToBytes(t, v.IEEE754)
+		got, err := jcs.FormatNumber(math.Float64frombits(binary.BigEndian.Uint64(bits)))
+		if err != nil || got != v.Expected {
+			t.Errorf("number %s: got %q (%v), want %q", v.IEEE754, got, err, v.Expected)
+		}
+	}
+	for _, v := range f.InvalidVectors {
+		input := []byte(v.Input)
+		if v.InputHex != "" {
+			input = hexToBytes(t, v.InputHex)
+		}
+		if _, err := jcs.Canonicalize(input); err == nil {
+			t.Errorf("%s: accepted", v.Name)
+		}
+	}
+}
+
+// --- SPD Signature Vectors ---
+
+type spdVectorFile struct {
+	TestVGKey struct {
+		N string `json:"n"`
+		E string `json:"e"`
+		D string `json:"d"`
+		P string `json:"p"`
+		Q string `json:"q"`
+	} `json:"test_vg_key"`
+	Vectors []struct {
+		Name           string `json:"name"`
+		SPD            string `json:"spd"`
+		Canonical      string `json:"canonical"`
+		SPDHash        string `json:"spd_hash"`
+		ExpectedResult string `json:"expected_result"`
+	} `json:"vectors"`
+}
+
+func TestSPDSignatureVectors(t *testing.T) {
+	data, err := os.ReadFile("../../../test-vectors/spd-signature.json")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var f spdVectorFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: hexToBigInt(t, f.TestVGKey.N), E: int(hexToBigInt(t, f.TestVGKey.E).Int64())},
+		D:         hexToBigInt(t, f.TestVGKey.D),
+		Primes:    []*big.Int{hexToBigInt(t, f.TestVGKey.P), hexToBigInt(t, f.TestVGKey.Q)},
+	}
+	if err := key.Validate(); err != nil {
+		t.Fatalf("test key: %v", err)
+	}
+
+	for _, v := range f.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			err := spd.Verify([]byte(v.SPD), &key.PublicKey)
+			if v.ExpectedResult == "invalid" {
+				if !errors.Is(err, spd.ErrInvalidSignature) {
+					t.Fatalf("Verify = %v, want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			canonical, err := spd.Canonical([]byte(v.SPD))
+			if err != nil || string(canonical) != v.Canonical {
+				t.Fatalf("canonical form mismatch: %v", err)
+			}
+			hash, _ := spd.Hash([]byte(v.SPD))
+			if base64.RawURLEncoding.EncodeToString(hash[:]) != v.SPDHash {
+				t.Error("spd_hash mismatch")
+			}
+
+			// PKCS1-v1_5 is deterministic: signing again reproduces the signature.
+			d, err := spd.Parse([]byte(v.SPD), "")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			want := d.Signature
+			if err := d.Sign(key); err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if d.Signature != want {
+				t.Error("signature is not reproducible")
+			}
+		})
+	}
+}
+
 // Helpers
 
 func hexToBigInt(t *testing.T, s string) *big.Int {
@@ -407,10 +545,11 @@ func hexTo32(t *testing.T, s string) [32]byte {
 	return arr
 }
 
-func hexTo256(t *testing.T, s string) [256]byte {
+func hexTo256(t *testing.T, s string) []byte {
 	t.Helper()
 	b := hexToBytes(t, s)
-	var arr [256]byte
-	copy(arr[:], b)
-	return arr
+	if len(b) != 256 {
+		t.Fatalf("expected 256 bytes, got %d", len(b))
+	}
+	return b
 }
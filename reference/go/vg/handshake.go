@@ -0,0 +1,170 @@
+package vg
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+)
+
+// Handshake transport parameters.
+const (
+	// TokenHeader carries the base64url-encoded token when it is not sent as
+	// the request body.
+	TokenHeader = "AAVP-Token"
+	// MaxHandshakeRequestSize bounds the body of a handshake request.
+	MaxHandshakeRequestSize = 4 * padding.BlockSize
+)
+
+// Handshake error codes not produced by token validation. Validation failures
+// are reported with the name of the validation error (for example
+// "token_expired").
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeInternal       = "internal_error"
+)
+
+// validationErrors are the errors of validation.Validate whose names are
+// returned as handshake error codes.
+var validationErrors = []error{
+	validation.ErrInvalidTokenSize,
+	validation.ErrUnsupportedTokenType,
+	validation.ErrInvalidAgeBracket,
+	validation.ErrTokenExpired,
+	validation.ErrExpiresAtTooFarFuture,
+	validation.ErrSignatureVerificationFailed,
+}
+
+// SessionIssuer creates the session credential returned after a successful
+// handshake (PROTOCOL.md section 7.3). The credential must not outlive
+// tokenExpiresAt; when the token has already expired, within the clock skew
+// tolerated by the validator, the error must match
+// validation.ErrTokenExpired (errors.Is).
+type SessionIssuer interface {
+	IssueSession(ageBracket uint8, tokenExpiresAt, now time.Time) (credential string, expiresAt time.Time, err error)
+}
+
+// HandshakeResponse is the body of a successful handshake.
+type HandshakeResponse struct {
+	Status            string `json:"status"` // always "ok"
+	SessionCredential string `json:"session_credential"`
+	SessionExpiresAt  int64  `json:"session_expires_at"` // Unix seconds
+}
+
+// HandshakeError is the body of a failed handshake.
+type HandshakeError struct {
+	Error string `json:"error"`
+}
+
+// HandshakeHandler serves the vg_endpoint: it verifies the presented token,
+// discards it and returns a session credential.
+//
+// The token is accepted either as the raw request body, optionally followed by
+// padding up to a multiple of padding.BlockSize, or base64url-encoded in the
+// TokenHeader header, in which case the body is ignored. Responses are padded
+// to 2 KiB multiples and marked Cache-Control: no-store (PROTOCOL.md sections
+// 4.5.2 and 7.9).
+//
+// In line with section 7.2, only the age_bracket and expires_at of a valid
+// token are passed on to Sessions; the token bytes are zeroed once verified
+// and nothing about the request is logged or kept.
+type HandshakeHandler struct {
+	Gate     *VerificationGate
+	Sessions SessionIssuer
+	Now      func() time.Time
+}
+
+// NewHandshakeHandler creates a HandshakeHandler verifying tokens with gate.
+func NewHandshakeHandler(gate *VerificationGate, sessions SessionIssuer) *HandshakeHandler {
+	return &HandshakeHandler{Gate: gate, Sessions: sessions, Now: time.Now}
+}
+
+func (h *HandshakeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHandshake(w, http.StatusMethodNotAllowed, &HandshakeError{Error: ErrCodeInvalidRequest})
+		return
+	}
+	tokenBytes, ok := readToken(r)
+	if !ok {
+		writeHandshake(w, http.StatusBadRequest, &HandshakeError{Error: ErrCodeInvalidRequest})
+		return
+	}
+
+	now := h.Now()
+	result, err := h.Gate.Verify(tokenBytes, now)
+	clear(tokenBytes)
+	if err != nil {
+		writeHandshake(w, http.StatusBadRequest, &HandshakeError{Error: errorCode(err)})
+		return
+	}
+
+	credential, expiresAt, err := h.Sessions.IssueSession(result.AgeBracket, result.ExpiresAt, now)
+	switch {
+	case errors.Is(err, validation.ErrTokenExpired):
+		writeHandshake(w, http.StatusBadRequest, &HandshakeError{Error: validation.ErrTokenExpired.Error()})
+		return
+	case err != nil:
+		writeHandshake(w, http.StatusInternalServerError, &HandshakeError{Error: ErrCodeInternal})
+		return
+	}
+	writeHandshake(w, http.StatusOK, &HandshakeResponse{
+		Status:            "ok",
+		SessionCredential: credential,
+		SessionExpiresAt:  expiresAt.Unix(),
+	})
+}
+
+// readToken extracts the token from the TokenHeader header or the body.
+func readToken(r *http.Request) ([]byte, bool) {
+	if v := r.Header.Get(TokenHeader); v != "" {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(v), "="))
+		return b, err == nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxHandshakeRequestSize+1))
+	if err != nil || len(body) > MaxHandshakeRequestSize {
+		return nil, false
+	}
+	// A padded body carries the token followed by random bytes; the token
+	// size follows from its token_type.
+	if size, err := tokenSize(body); err == nil && len(body) > size && len(body)%padding.BlockSize == 0 {
+		return body[:size], true
+	}
+	return body, true
+}
+
+func tokenSize(b []byte) (int, error) {
+	tt, err := token.PeekTokenType(b)
+	if err != nil {
+		return 0, err
+	}
+	return token.SizeForType(tt)
+}
+
+// errorCode returns the handshake error code for a verification error.
+func errorCode(err error) string {
+	for _, e := range validationErrors {
+		if errors.Is(err, e) {
+			return e.Error()
+		}
+	}
+	return ErrCodeInvalidRequest
+}
+
+func writeHandshake(w http.ResponseWriter, status int, v any) {
+	body, err := padding.Marshal(v)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
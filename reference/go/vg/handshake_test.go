@@ -0,0 +1,141 @@
+package vg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/padding"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
+)
+
+type fakeSessions struct {
+	bracket        uint8
+	tokenExpiresAt time.Time
+	fail           bool
+}
+
+func (f *fakeSessions) IssueSession(ageBracket uint8, tokenExpiresAt, now time.Time) (string, time.Time, error) {
+	if f.fail {
+		return "", time.Time{}, errors.New("no signing key")
+	}
+	if !tokenExpiresAt.After(now) {
+		return "", time.Time{}, fmt.Errorf("session: %w", validation.ErrTokenExpired)
+	}
+	f.bracket, f.tokenExpiresAt = ageBracket, tokenExpiresAt
+	return "credential", now.Add(20 * time.Minute), nil
+}
+
+func TestHandshakeHandler(t *testing.T) {
+	agent, gate, sk := setupProtocol(t)
+	tok, err := agent.IssueToken(token.AgeBracketAge13_15, 2*time.Hour, func(blindedMsg, metadata []byte) ([]byte, error) {
+		return pbrsa.BlindSign(sk, blindedMsg, metadata)
+	})
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	encoded := token.Encode(tok)
+	sessions := &fakeSessions{}
+	h := NewHandshakeHandler(gate, sessions)
+
+	padded := make([]byte, padding.BlockSize)
+	copy(padded, encoded)
+	rand.Read(padded[len(encoded):])
+
+	requests := map[string]*http.Request{
+		"raw body":    httptest.NewRequest(http.MethodPost, "/aavp/verify", bytes.NewReader(encoded)),
+		"padded body": httptest.NewRequest(http.MethodPost, "/aavp/verify", bytes.NewReader(padded)),
+	}
+	hdr := httptest.NewRequest(http.MethodPost, "/aavp/verify", bytes.NewReader(make([]byte, padding.BlockSize)))
+	hdr.Header.Set(TokenHeader, base64.RawURLEncoding.EncodeToString(encoded))
+	requests["header"] = hdr
+
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			*sessions = fakeSessions{}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" || rec.Body.Len()%padding.BlockSize != 0 {
+				t.Error("response not padded or cacheable")
+			}
+			var resp HandshakeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Status != "ok" || resp.SessionCredential != "credential" || resp.SessionExpiresAt == 0 {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			if sessions.bracket != token.AgeBracketAge13_15 || sessions.tokenExpiresAt.Unix() != int64(tok.ExpiresAt) {
+				t.Errorf("session issued for bracket %d, expiry %v", sessions.bracket, sessions.tokenExpiresAt)
+			}
+		})
+	}
+}
+
+func TestHandshakeHandlerErrors(t *testing.T) {
+	agent, gate, sk := setupProtocol(t)
+	tok, _ := agent.IssueToken(token.AgeBracketOver18, 2*time.Hour, func(blindedMsg, metadata []byte) ([]byte, error) {
+		return pbrsa.BlindSign(sk, blindedMsg, metadata)
+	})
+	valid := token.Encode(tok)
+	tampered := bytes.Clone(valid)
+	tampered[len(tampered)-1] ^= 0xff
+	sessions := &fakeSessions{}
+	h := NewHandshakeHandler(gate, sessions)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		now    time.Time
+		status int
+		code   string
+	}{
+		{"short body", valid[:100], time.Now(), http.StatusBadRequest, "invalid_token_size"},
+		{"bad signature", tampered, time.Now(), http.StatusBadRequest, "signature_verification_failed"},
+		{"expired", valid, time.Now().Add(5 * time.Hour), http.StatusBadRequest, "token_expired"},
+		// Within the past clock skew the token is valid but gets no session.
+		{"expired within skew", valid, time.Unix(int64(tok.ExpiresAt), 0).Add(time.Minute), http.StatusBadRequest, "token_expired"},
+		{"oversized body", make([]byte, MaxHandshakeRequestSize+1), time.Now(), http.StatusBadRequest, ErrCodeInvalidRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h.Now = func() time.Time { return tc.now }
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/aavp/verify", bytes.NewReader(tc.body)))
+			var resp HandshakeError
+			json.Unmarshal(rec.Body.Bytes(), &resp)
+			if rec.Code != tc.status || resp.Error != tc.code {
+				t.Errorf("got %d %q, want %d %q", rec.Code, resp.Error, tc.status, tc.code)
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" {
+				t.Error("error response cacheable")
+			}
+		})
+	}
+
+	h.Now = time.Now
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/aavp/verify", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+
+	sessions.fail = true
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/aavp/verify", bytes.NewReader(valid)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("session failure: status %d", rec.Code)
+	}
+}
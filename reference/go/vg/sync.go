@@ -0,0 +1,202 @@
+package vg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+)
+
+// Trust synchronisation parameters (PROTOCOL.md section 5.2.5).
+const (
+	// WellKnownIssuerPath is the path of the IM key publication endpoint.
+	WellKnownIssuerPath = im.WellKnownIssuerPath
+	// MaxSyncInterval is the longest time between two fetches of an IM document.
+	MaxSyncInterval = 24 * time.Hour
+	// MinSyncInterval bounds how often a short max-age can trigger a refetch.
+	MinSyncInterval = 5 * time.Minute
+	// SyncRetryInterval is the delay before retrying a failed fetch.
+	SyncRetryInterval = 15 * time.Minute
+
+	maxIssuerDocumentSize = 1 << 20
+)
+
+// Syncer keeps a TrustStore in line with the .well-known/aavp-issuer documents
+// of the accepted IMs. Keys that expire or disappear from an IM's document stop
+// being trusted; IMs not listed in Issuers are never added.
+type Syncer struct {
+	Store   *TrustStore
+	Issuers []string // accepted IM domains
+	Client  *http.Client
+	Now     func() time.Time
+	// OnError, if set, receives fetch and key errors. It is called without locks held.
+	OnError func(domain string, err error)
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// NewSyncer creates a Syncer for the given accepted IM domains.
+func NewSyncer(store *TrustStore, issuers []string) *Syncer {
+	return &Syncer{
+		Store:   store,
+		Issuers: issuers,
+		Client:  http.DefaultClient,
+		Now:     time.Now,
+	}
+}
+
+// SyncIssuer fetches one IM document and applies it to the trust store.
+// It returns the time at which the document should be fetched again, derived
+// from Cache-Control max-age and capped at MaxSyncInterval.
+//
+// A document that cannot be fetched, decoded, or whose issuer does not match
+// domain is rejected as a whole and the current keys are kept. Individual keys
+// failing the checks of im.WellKnownKey.ParseKey are skipped; their errors are
+// returned after the valid keys have been applied.
+func (s *Syncer) SyncIssuer(ctx context.Context, domain string) (time.Time, error) {
+	now := s.Now()
+	doc, maxAge, err := s.fetch(ctx, domain)
+	if err != nil {
+		return now.Add(SyncRetryInterval), err
+	}
+	if !strings.EqualFold(doc.Issuer, domain) {
+		return now.Add(SyncRetryInterval), fmt.Errorf("vg: issuer %q does not match domain %q", doc.Issuer, domain)
+	}
+
+	var keys []TrustedKey
+	var keyErrs []error
+	for i := range doc.Keys {
+		ik, err := doc.Keys[i].ParseKey()
+		if err != nil {
+			keyErrs = append(keyErrs, fmt.Errorf("key %d: %w", i, err))
+			continue
+		}
+		if !now.Before(ik.NotAfter) {
+			continue // expired
+		}
+		keys = append(keys, TrustedKey{
+			TokenKeyID: ik.TokenKeyID,
+			PublicKey:  ik.PublicKey,
+			TokenType:  ik.TokenType,
+			NotBefore:  ik.NotBefore,
+			NotAfter:   ik.NotAfter,
+		})
+	}
+	s.Store.ReplaceIssuer(domain, keys)
+
+	return now.Add(refreshInterval(maxAge)), errors.Join(keyErrs...)
+}
+
+// SyncDue syncs every accepted IM whose next fetch time has been reached and
+// returns the earliest upcoming fetch time.
+func (s *Syncer) SyncDue(ctx context.Context) time.Time {
+	now := s.Now()
+	s.mu.Lock()
+	if s.next == nil {
+		s.next = make(map[string]time.Time)
+	}
+	var due []string
+	for _, d := range s.Issuers {
+		if !now.Before(s.next[d]) {
+			due = append(due, d)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range due {
+		next, err := s.SyncIssuer(ctx, d)
+		if err != nil && s.OnError != nil {
+			s.OnError(d, err)
+		}
+		s.mu.Lock()
+		s.next[d] = next
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	earliest := now.Add(MaxSyncInterval)
+	for _, d := range s.Issuers {
+		if t := s.next[d]; t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// Run syncs the accepted IMs until ctx is done.
+func (s *Syncer) Run(ctx context.Context) {
+	for {
+		next := s.SyncDue(ctx)
+		wait := next.Sub(s.Now())
+		if wait < time.Second {
+			wait = time.Second
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Syncer) fetch(ctx context.Context, domain string) (*im.WellKnownIssuer, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+WellKnownIssuerPath, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("vg: %s%s returned %s", domain, WellKnownIssuerPath, resp.Status)
+	}
+	var doc im.WellKnownIssuer
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIssuerDocumentSize)).Decode(&doc); err != nil {
+		return nil, 0, fmt.Errorf("vg: invalid issuer document from %s: %w", domain, err)
+	}
+	return &doc, cacheMaxAge(resp.Header), nil
+}
+
+// cacheMaxAge returns the max-age of a Cache-Control header, 0 for
+// no-cache/no-store, and -1 if the header carries no freshness information.
+func cacheMaxAge(h http.Header) time.Duration {
+	maxAge := time.Duration(-1)
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if secs, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64); err == nil && secs >= 0 {
+				maxAge = time.Duration(min(secs, int64(MaxSyncInterval/time.Second))) * time.Second
+			}
+		}
+	}
+	return maxAge
+}
+
+func refreshInterval(maxAge time.Duration) time.Duration {
+	switch {
+	case maxAge < 0, maxAge > MaxSyncInterval:
+		return MaxSyncInterval
+	case maxAge < MinSyncInterval:
+		return MinSyncInterval
+	default:
+		return maxAge
+	}
+}
@@ -0,0 +1,217 @@
+package vg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/internal/testkeys"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// handlerClient returns an HTTP client that serves every request with h.
+func handlerClient(h http.Handler) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Result(), nil
+	})}
+}
+
+func issuerKey(t *testing.T, sk *pbrsa.PrivateKey, domain string, notBefore, notAfter time.Time) im.WellKnownKey {
+	t.Helper()
+	spkiDER, err := im.MarshalSPKIDER(&sk.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalSPKIDER: %v", err)
+	}
+	return im.NewImplementor(sk, spkiDER, domain).WellKnownResponse(notBefore, notAfter).Keys[0]
+}
+
+type fakeIssuer struct {
+	doc          im.WellKnownIssuer
+	cacheControl string
+	status       int
+	requests     []string
+}
+
+func (f *fakeIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Host+r.URL.Path)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	if f.cacheControl != "" {
+		w.Header().Set("Cache-Control", f.cacheControl)
+	}
+	json.NewEncoder(w).Encode(&f.doc)
+}
+
+func TestSyncerRotationAndWithdrawal(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	keyA := issuerKey(t, testkeys.SafePrimeKey(), "im.example", now.Add(-30*24*time.Hour), now.Add(60*24*time.Hour))
+	keyB := issuerKey(t, testkeys.VectorKey(), "im.example", now.Add(24*time.Hour), now.Add(120*24*time.Hour))
+	parsedA, _ := keyA.ParseKey()
+	parsedB, _ := keyB.ParseKey()
+
+	fake := &fakeIssuer{
+		doc:          im.WellKnownIssuer{Issuer: "im.example", AAVPVersion: "0.11", Keys: []im.WellKnownKey{keyA}},
+		cacheControl: "public, max-age=86400",
+	}
+	store := NewTrustStore()
+	var unrelated [32]byte
+	unrelated[0] = 9
+	store.Add(TrustedKey{TokenKeyID: unrelated, PublicKey: &testkeys.SafePrimeKey().PublicKey, Issuer: "other.example"})
+
+	s := NewSyncer(store, []string{"im.example"})
+	s.Client = handlerClient(fake)
+	s.Now = func() time.Time { return now }
+
+	next, err := s.SyncIssuer(context.Background(), "im.example")
+	if err != nil {
+		t.Fatalf("SyncIssuer: %v", err)
+	}
+	if want := now.Add(24 * time.Hour); !next.Equal(want) {
+		t.Errorf("next sync: got %v, want %v", next, want)
+	}
+	if fake.requests[0] != "im.example/.well-known/aavp-issuer" {
+		t.Errorf("fetched %q", fake.requests[0])
+	}
+	if _, ok := store.Lookup(parsedA.TokenKeyID, now); !ok {
+		t.Fatal("key A not trusted after sync")
+	}
+
+	// Rotation: B published with a future not_before alongside A.
+	fake.doc.Keys = []im.WellKnownKey{keyA, keyB}
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err != nil {
+		t.Fatalf("SyncIssuer: %v", err)
+	}
+	if _, ok := store.Lookup(parsedB.TokenKeyID, now); ok {
+		t.Error("key B trusted before its not_before")
+	}
+	if _, ok := store.Lookup(parsedB.TokenKeyID, now.Add(48*time.Hour)); !ok {
+		t.Error("key B not trusted after its not_before")
+	}
+
+	// Withdrawal: A disappears from the document.
+	fake.doc.Keys = []im.WellKnownKey{keyB}
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err != nil {
+		t.Fatalf("SyncIssuer: %v", err)
+	}
+	if _, ok := store.Lookup(parsedA.TokenKeyID, now); ok {
+		t.Error("withdrawn key A still trusted")
+	}
+	if _, ok := store.Lookup(unrelated, now); !ok {
+		t.Error("sync of im.example removed a key of another issuer")
+	}
+}
+
+func TestSyncerRejectsBadDocuments(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	good := issuerKey(t, testkeys.SafePrimeKey(), "im.example", now.Add(-time.Hour), now.Add(90*24*time.Hour))
+	parsed, _ := good.ParseKey()
+
+	fake := &fakeIssuer{doc: im.WellKnownIssuer{Issuer: "im.example", Keys: []im.WellKnownKey{good}}}
+	store := NewTrustStore()
+	s := NewSyncer(store, []string{"im.example"})
+	s.Client = handlerClient(fake)
+	s.Now = func() time.Time { return now }
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err != nil {
+		t.Fatalf("SyncIssuer: %v", err)
+	}
+
+	// Issuer mismatch: rejected as a whole, current keys kept.
+	fake.doc.Issuer = "evil.example"
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err == nil {
+		t.Error("expected error for issuer mismatch")
+	}
+	if _, ok := store.Lookup(parsed.TokenKeyID, now); !ok {
+		t.Error("issuer mismatch dropped existing keys")
+	}
+
+	// Server error: rejected, retried later.
+	fake.doc.Issuer = "im.example"
+	fake.status = http.StatusServiceUnavailable
+	next, err := s.SyncIssuer(context.Background(), "im.example")
+	if err == nil {
+		t.Error("expected error for 503")
+	}
+	if want := now.Add(SyncRetryInterval); !next.Equal(want) {
+		t.Errorf("retry time: got %v, want %v", next, want)
+	}
+	fake.status = 0
+
+	// A key valid for more than 180 days is skipped; the others are applied.
+	tooLong := issuerKey(t, testkeys.VectorKey(), "im.example", now.Add(-time.Hour), now.Add(181*24*time.Hour))
+	fake.doc.Keys = []im.WellKnownKey{good, tooLong}
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err == nil {
+		t.Error("expected error for key with validity above 180 days")
+	}
+	if store.Snapshot().Len() != 1 {
+		t.Errorf("expected only the valid key, got %d keys", store.Snapshot().Len())
+	}
+
+	// An expired key is not trusted.
+	expired := issuerKey(t, testkeys.VectorKey(), "im.example", now.Add(-100*24*time.Hour), now.Add(-time.Hour))
+	fake.doc.Keys = []im.WellKnownKey{expired}
+	if _, err := s.SyncIssuer(context.Background(), "im.example"); err != nil {
+		t.Fatalf("SyncIssuer: %v", err)
+	}
+	if store.Snapshot().Len() != 0 {
+		t.Error("expired key added to trust store")
+	}
+}
+
+func TestSyncDueRespectsCacheControl(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := issuerKey(t, testkeys.SafePrimeKey(), "im.example", now.Add(-time.Hour), now.Add(90*24*time.Hour))
+	fake := &fakeIssuer{
+		doc:          im.WellKnownIssuer{Issuer: "im.example", Keys: []im.WellKnownKey{key}},
+		cacheControl: "max-age=3600",
+	}
+	s := NewSyncer(NewTrustStore(), []string{"im.example"})
+	s.Client = handlerClient(fake)
+	s.Now = func() time.Time { return now }
+
+	if next := s.SyncDue(context.Background()); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("next: got %v, want %v", next, now.Add(time.Hour))
+	}
+	now = now.Add(30 * time.Minute)
+	s.SyncDue(context.Background())
+	if len(fake.requests) != 1 {
+		t.Errorf("refetched before max-age: %d requests", len(fake.requests))
+	}
+	now = now.Add(31 * time.Minute)
+	s.SyncDue(context.Background())
+	if len(fake.requests) != 2 {
+		t.Errorf("not refetched after max-age: %d requests", len(fake.requests))
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"public, max-age=86400", MaxSyncInterval},
+		{"max-age=600", 10 * time.Minute},
+		{"max-age=10", MinSyncInterval},
+		{"no-store", MinSyncInterval},
+		{"max-age=31536000", MaxSyncInterval},
+		{"", MaxSyncInterval},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		h.Set("Cache-Control", tt.header)
+		if got := refreshInterval(cacheMaxAge(h)); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package vg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+)
+
+// TrustedKey is an IM public key accepted by the VG, together with its validity window.
+type TrustedKey struct {
+	TokenKeyID [32]byte
+	PublicKey  *pbrsa.PublicKey
+	Issuer     string // IM domain; empty for keys added without one
+	TokenType  uint16
+	NotBefore  time.Time // zero means no lower bound
+	NotAfter   time.Time // zero means no upper bound
+}
+
+// ValidAt returns true if the key may be used to verify signatures at t.
+func (k *TrustedKey) ValidAt(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && !t.Before(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// Snapshot is an immutable view of the trust store at one point in time.
+type Snapshot struct {
+	keys map[[32]byte]*TrustedKey
+}
+
+// Lookup returns the key for tokenKeyID if it is present and valid at now.
+func (s *Snapshot) Lookup(tokenKeyID [32]byte, now time.Time) (*TrustedKey, bool) {
+	k, ok := s.keys[tokenKeyID]
+	if !ok || !k.ValidAt(now) {
+		return nil, false
+	}
+	return k, true
+}
+
+// Keys returns all keys in the snapshot, including those outside their window.
+func (s *Snapshot) Keys() []*TrustedKey {
+	out := make([]*TrustedKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		out = append(out, k)
+	}
+	return out
+}
+
+// Len returns the number of keys in the snapshot.
+func (s *Snapshot) Len() int {
+	return len(s.keys)
+}
+
+// Issuers returns the distinct issuer domains present in the snapshot.
+func (s *Snapshot) Issuers() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, k := range s.keys {
+		if k.Issuer != "" && !seen[k.Issuer] {
+			seen[k.Issuer] = true
+			out = append(out, k.Issuer)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TrustStore is the VG's set of trusted IM keys (PROTOCOL.md section 5.2.5).
+// It is safe for concurrent use. Readers load an immutable snapshot; writers
+// build a new snapshot and swap it in atomically, so verifications already in
+// flight keep using the snapshot they started with.
+type TrustStore struct {
+	mu   sync.Mutex // serialises writers
+	snap atomic.Pointer[Snapshot]
+}
+
+// NewTrustStore creates an empty trust store.
+func NewTrustStore() *TrustStore {
+	ts := &TrustStore{}
+	ts.snap.Store(&Snapshot{keys: map[[32]byte]*TrustedKey{}})
+	return ts
+}
+
+// Snapshot returns the current snapshot.
+func (ts *TrustStore) Snapshot() *Snapshot {
+	return ts.snap.Load()
+}
+
+// Lookup returns the key for tokenKeyID if it is trusted and valid at now.
+func (ts *TrustStore) Lookup(tokenKeyID [32]byte, now time.Time) (*TrustedKey, bool) {
+	return ts.Snapshot().Lookup(tokenKeyID, now)
+}
+
+// update applies fn to a copy of the current key map and swaps it in.
+func (ts *TrustStore) update(fn func(keys map[[32]byte]*TrustedKey)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	cur := ts.snap.Load()
+	next := make(map[[32]byte]*TrustedKey, len(cur.keys)+1)
+	for id, k := range cur.keys {
+		next[id] = k
+	}
+	fn(next)
+	ts.snap.Store(&Snapshot{keys: next})
+}
+
+// Add adds or replaces a key.
+func (ts *TrustStore) Add(k TrustedKey) {
+	ts.update(func(keys map[[32]byte]*TrustedKey) {
+		keys[k.TokenKeyID] = &k
+	})
+}
+
+// Remove deletes a key immediately. Returns false if the key was not present.
+func (ts *TrustStore) Remove(tokenKeyID [32]byte) bool {
+	var found bool
+	ts.update(func(keys map[[32]byte]*TrustedKey) {
+		_, found = keys[tokenKeyID]
+		delete(keys, tokenKeyID)
+	})
+	return found
+}
+
+// Retire stops trusting a key from at onwards by moving its not_after back.
+// Passing now plus the maximum token TTL lets tokens already signed with the
+// key expire naturally. Returns false if the key was not present.
+func (ts *TrustStore) Retire(tokenKeyID [32]byte, at time.Time) bool {
+	var found bool
+	ts.update(func(keys map[[32]byte]*TrustedKey) {
+		k, ok := keys[tokenKeyID]
+		if !ok {
+			return
+		}
+		found = true
+		if k.NotAfter.IsZero() || at.Before(k.NotAfter) {
+			retired := *k
+			retired.NotAfter = at
+			keys[tokenKeyID] = &retired
+		}
+	})
+	return found
+}
+
+// Replace atomically replaces the whole key set.
+func (ts *TrustStore) Replace(keys []TrustedKey) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	next := make(map[[32]byte]*TrustedKey, len(keys))
+	for i := range keys {
+		k := keys[i]
+		next[k.TokenKeyID] = &k
+	}
+	ts.snap.Store(&Snapshot{keys: next})
+}
+
+// ReplaceIssuer atomically replaces every key belonging to issuer with keys.
+// Keys of other issuers are left untouched.
+func (ts *TrustStore) ReplaceIssuer(issuer string, keys []TrustedKey) {
+	ts.update(func(cur map[[32]byte]*TrustedKey) {
+		for id, k := range cur {
+			if k.Issuer == issuer {
+				delete(cur, id)
+			}
+		}
+		for i := range keys {
+			k := keys[i]
+			k.Issuer = issuer
+			cur[k.TokenKeyID] = &k
+		}
+	})
+}
+
+// TrustFile is the on-disk trust store format. Each entry has the shape of a
+// .well-known/aavp-issuer key plus the issuer domain it belongs to.
+type TrustFile struct {
+	Keys []TrustFileKey `json:"keys"`
+}
+
+// TrustFileKey is one entry of a TrustFile.
+type TrustFileKey struct {
+	Issuer string `json:"issuer"`
+	im.WellKnownKey
+}
+
+// ParseTrustFile decodes and checks a trust file. Every key must pass the
+// checks of im.WellKnownKey.ParseKey; a single invalid key rejects the file.
+func ParseTrustFile(data []byte) ([]TrustedKey, error) {
+	var f TrustFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("vg: invalid trust file: %w", err)
+	}
+	keys := make([]TrustedKey, 0, len(f.Keys))
+	for i := range f.Keys {
+		entry := &f.Keys[i]
+		ik, err := entry.ParseKey()
+		if err != nil {
+			return nil, fmt.Errorf("vg: trust file key %d: %w", i, err)
+		}
+		keys = append(keys, TrustedKey{
+			TokenKeyID: ik.TokenKeyID,
+			PublicKey:  ik.PublicKey,
+			Issuer:     entry.Issuer,
+			TokenType:  ik.TokenType,
+			NotBefore:  ik.NotBefore,
+			NotAfter:   ik.NotAfter,
+		})
+	}
+	return keys, nil
+}
+
+// LoadFile reads a trust file and atomically replaces the key set with its
+// contents. On error the current key set is left untouched.
+func (ts *TrustStore) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseTrustFile(data)
+	if err != nil {
+		return err
+	}
+	ts.Replace(keys)
+	return nil
+}
+
+// DefaultWatchInterval is the polling interval Watch uses when given none.
+const DefaultWatchInterval = time.Minute
+
+// Watch reloads the trust file whenever its modification time or size
+// changes, polling every interval (DefaultWatchInterval if interval is not
+// positive) until ctx is done. Reload errors are passed to onError (if not
+// nil) and the previous key set stays in place.
+func (ts *TrustStore) Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	var lastMod time.Time
+	var lastSize int64 = -1
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fi, err := os.Stat(path)
+		if err == nil && (!fi.ModTime().Equal(lastMod) || fi.Size() != lastSize) {
+			lastMod, lastSize = fi.ModTime(), fi.Size()
+			err = ts.LoadFile(path)
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package vg
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/im"
+	"github.com/aavp-protocol/aavp-go/internal/testkeys"
+	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+func TestTrustStoreValidityWindow(t *testing.T) {
+	sk := testkeys.SafePrimeKey()
+	ts := NewTrustStore()
+	var kid [32]byte
+	kid[0] = 1
+
+	nb := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	na := nb.Add(90 * 24 * time.Hour)
+	ts.Add(TrustedKey{TokenKeyID: kid, PublicKey: &sk.PublicKey, NotBefore: nb, NotAfter: na})
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{nb.Add(-time.Second), false},
+		{nb, true},
+		{na.Add(-time.Second), true},
+		{na, false},
+	}
+	for _, tt := range tests {
+		if _, ok := ts.Lookup(kid, tt.at); ok != tt.want {
+			t.Errorf("Lookup at %v: got %v, want %v", tt.at, ok, tt.want)
+		}
+	}
+}
+
+func TestTrustStoreRetireAndRemove(t *testing.T) {
+	sk := testkeys.SafePrimeKey()
+	ts := NewTrustStore()
+	var kid [32]byte
+	kid[0] = 2
+	ts.Add(TrustedKey{TokenKeyID: kid, PublicKey: &sk.PublicKey})
+
+	now := time.Now()
+	before := ts.Snapshot()
+	if !ts.Retire(kid, now.Add(4*time.Hour)) {
+		t.Fatal("Retire: key not found")
+	}
+	if _, ok := ts.Lookup(kid, now.Add(3*time.Hour)); !ok {
+		t.Error("retired key should verify until its new not_after")
+	}
+	if _, ok := ts.Lookup(kid, now.Add(5*time.Hour)); ok {
+		t.Error("retired key should not verify after its new not_after")
+	}
+	// The snapshot taken before retiring is unaffected.
+	if _, ok := before.Lookup(kid, now.Add(5*time.Hour)); !ok {
+		t.Error("earlier snapshot was mutated")
+	}
+
+	if !ts.Remove(kid) {
+		t.Fatal("Remove: key not found")
+	}
+	if ts.Remove(kid) {
+		t.Error("Remove of absent key returned true")
+	}
+	if ts.Snapshot().Len() != 0 {
+		t.Error("store not empty after Remove")
+	}
+}
+
+func writeTrustFile(t *testing.T, path string, keys ...TrustFileKey) {
+	t.Helper()
+	data, err := json.Marshal(TrustFile{Keys: keys})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func testTrustFileKey(t *testing.T, sk *pbrsa.PrivateKey, domain string) TrustFileKey {
+	t.Helper()
+	spkiDER, err := im.MarshalSPKIDER(&sk.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalSPKIDER: %v", err)
+	}
+	nb := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	doc := im.NewImplementor(sk, spkiDER, domain).WellKnownResponse(nb, nb.Add(90*24*time.Hour))
+	return TrustFileKey{Issuer: domain, WellKnownKey: doc.Keys[0]}
+}
+
+func TestTrustStoreLoadFile(t *testing.T) {
+	sk := testkeys.SafePrimeKey()
+	path := filepath.Join(t.TempDir(), "trust.json")
+	entry := testTrustFileKey(t, sk, "im.example")
+	writeTrustFile(t, path, entry)
+
+	ts := NewTrustStore()
+	if err := ts.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	keys := ts.Snapshot().Keys()
+	if len(keys) != 1 || keys[0].Issuer != "im.example" || keys[0].TokenType != token.TokenTypeRSAPBSSASHA384 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	// A file with an inconsistent token_key_id is rejected and the old set kept.
+	bad := entry
+	bad.TokenKeyID = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	writeTrustFile(t, path, bad)
+	if err := ts.LoadFile(path); err == nil {
+		t.Fatal("expected error for inconsistent token_key_id")
+	}
+	if ts.Snapshot().Len() != 1 {
+		t.Error("failed reload replaced the key set")
+	}
+}
+
+func TestTrustStoreWatchReloads(t *testing.T) {
+	sk := testkeys.SafePrimeKey()
+	path := filepath.Join(t.TempDir(), "trust.json")
+	writeTrustFile(t, path)
+
+	ts := NewTrustStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ts.Watch(ctx, path, 10*time.Millisecond, nil)
+
+	entry := testTrustFileKey(t, sk, "im.example")
+	// Ensure a different size so the change is seen even on coarse mtime filesystems.
+	writeTrustFile(t, path, entry)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for ts.Snapshot().Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("trust file change not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTrustStoreWatchZeroInterval(t *testing.T) {
+	// A non-positive interval falls back to the default instead of panicking;
+	// the file is still loaded once before the first tick.
+	sk := testkeys.SafePrimeKey()
+	path := filepath.Join(t.TempDir(), "trust.json")
+	writeTrustFile(t, path, testTrustFileKey(t, sk, "im.example"))
+
+	ts := NewTrustStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ts.Watch(ctx, path, 0, nil)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for ts.Snapshot().Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("trust file not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestTrustStoreConcurrentVerifyDuringSwap(t *testing.T) {
+	agent, gate, sk := setupProtocol(t)
+	signer := func(blindedMsg, metadata []byte) ([]byte, error) {
+		return pbrsa.BlindSign(sk, blindedMsg, metadata)
+	}
+	tok, err := agent.IssueToken(token.AgeBracketOver18, 3*time.Hour, signer)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	encoded := token.Encode(tok)
+	trusted := gate.TrustStore.Snapshot().Keys()[0]
+
+	var other [32]byte
+	other[0] = 0xff
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// Swap in a set that always contains the issuing key plus a rotating one.
+			gate.TrustStore.Replace([]TrustedKey{*trusted, {TokenKeyID: other, PublicKey: &sk.PublicKey}})
+			gate.TrustStore.Remove(other)
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := gate.Verify(encoded, now); err != nil {
+					t.Errorf("Verify during swap: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
@@ -6,26 +6,48 @@ import (
 	"time"
 
 	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/report"
 	"github.com/aavp-protocol/aavp-go/token"
 	"github.com/aavp-protocol/aavp-go/validation"
 )
 
 // VerificationGate holds the trust store and configuration for a VG.
 type VerificationGate struct {
-	// TrustStore maps token_key_id (hex) to the IM's master public key.
-	TrustStore map[[32]byte]*pbrsa.PublicKey
+	// TrustStore holds the IM keys accepted by this VG, indexed by token_key_id.
+	TrustStore *TrustStore
+	// Validator holds the VG's validation policy.
+	Validator *validation.Validator
+	// Reports, if set, counts the outcome of every verification per IM for
+	// aggregate reports (PROTOCOL.md section 9.5.3).
+	Reports *report.Collector
 }
 
-// NewVerificationGate creates a new VG with the given trust store entries.
+// Signature verification errors. They are wrapped in
+// validation.ErrSignatureVerificationFailed and can be told apart with
+// errors.Is.
+var (
+	ErrUnknownKey      = errors.New("vg: unknown token_key_id")
+	ErrNoTokenVerifier = errors.New("vg: no verifier for token_type")
+)
+
+// NewVerificationGate creates a new VG with an empty trust store and the
+// default validation policy.
 func NewVerificationGate() *VerificationGate {
+	return NewVerificationGateWithValidator(validation.Default())
+}
+
+// NewVerificationGateWithValidator creates a new VG with an empty trust store
+// and the given validation policy.
+func NewVerificationGateWithValidator(v *validation.Validator) *VerificationGate {
 	return &VerificationGate{
-		TrustStore: make(map[[32]byte]*pbrsa.PublicKey),
+		TrustStore: NewTrustStore(),
+		Validator:  v,
 	}
 }
 
-// AddTrustedIM adds an IM's master public key to the trust store.
+// AddTrustedIM adds an IM's master public key to the trust store with no validity bounds.
 func (vg *VerificationGate) AddTrustedIM(tokenKeyID [32]byte, pk *pbrsa.PublicKey) {
-	vg.TrustStore[tokenKeyID] = pk
+	vg.TrustStore.Add(TrustedKey{TokenKeyID: tokenKeyID, PublicKey: pk})
 }
 
 // VerificationResult contains the result of a successful token verification.
@@ -38,10 +60,13 @@ type VerificationResult struct {
 // and cryptographic signature verification.
 func (vg *VerificationGate) Verify(tokenBytes []byte, now time.Time) (*VerificationResult, error) {
 	sigVerifier := func(tb []byte) error {
-		return vg.verifySignature(tb)
+		return vg.verifySignature(tb, now)
 	}
 
-	result, err := validation.Validate(tokenBytes, now, sigVerifier)
+	result, err := vg.Validator.Validate(tokenBytes, now, sigVerifier)
+	if vg.Reports != nil {
+		vg.record(tokenBytes, Classify(err))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -53,23 +78,73 @@ func (vg *VerificationGate) Verify(tokenBytes []byte, now time.Time) (*Verificat
 }
 
 // verifySignature performs the cryptographic signature verification.
-func (vg *VerificationGate) verifySignature(tokenBytes []byte) error {
+func (vg *VerificationGate) verifySignature(tokenBytes []byte, now time.Time) error {
 	tok, err := token.Decode(tokenBytes)
 	if err != nil {
 		return err
 	}
 
-	// Look up the IM's master public key
-	pk, ok := vg.TrustStore[tok.TokenKeyID]
+	// The scheme is fixed by token_type; never attempt more than one.
+	if tok.TokenType != token.TokenTypeRSAPBSSASHA384 {
+		return ErrNoTokenVerifier
+	}
+
+	// Look up the IM's master public key; keys outside their window are not trusted.
+	key, ok := vg.TrustStore.Lookup(tok.TokenKeyID, now)
 	if !ok {
-		return errors.New("unknown token_key_id")
+		return ErrUnknownKey
 	}
 
 	// Extract message_to_sign (first 75 bytes) and metadata
 	msg := tokenBytes[:token.MessageToSignSize]
 	metadata := tok.PublicMetadata()
-	sig := tok.Authenticator[:]
+	sig := tok.Authenticator
 
 	// Verify the partially blind RSA signature
-	return pbrsa.Verify(pk, msg, metadata, sig)
+	return pbrsa.Verify(key.PublicKey, msg, metadata, sig)
+}
+
+// record counts an outcome in Reports. Tokens whose key is in the trust
+// store, valid now or not, are attributed to the key and its IM. A token
+// whose key the VG never obtained names no IM, so it is attributed, without
+// its key, only when the trust store holds the keys of a single IM; this
+// lets that IM see unknown_key when the VG fails to fetch a new key. The
+// other tokens are recorded without an IM.
+func (vg *VerificationGate) record(tokenBytes []byte, o report.Outcome) {
+	tok, err := token.Decode(tokenBytes)
+	if err != nil {
+		vg.Reports.Record("", o)
+		return
+	}
+	snap := vg.TrustStore.Snapshot()
+	k, ok := snap.keys[tok.TokenKeyID]
+	if ok && k.Issuer != "" {
+		vg.Reports.RecordKey(k.Issuer, tok.TokenKeyID, o)
+		return
+	}
+	if issuers := snap.Issuers(); !ok && len(issuers) == 1 {
+		vg.Reports.Record(issuers[0], o)
+		return
+	}
+	vg.Reports.Record("", o)
+}
+
+// Classify maps an error returned by Verify to the outcome classes of the
+// aggregate reports. Tokens with an expires_at too far in the future count as
+// malformed.
+func Classify(err error) report.Outcome {
+	switch {
+	case err == nil:
+		return report.Valid
+	case errors.Is(err, validation.ErrTokenExpired):
+		return report.Expired
+	case errors.Is(err, ErrUnknownKey):
+		return report.UnknownKey
+	case errors.Is(err, ErrNoTokenVerifier):
+		return report.Malformed
+	case errors.Is(err, validation.ErrSignatureVerificationFailed):
+		return report.BadSignature
+	default:
+		return report.Malformed
+	}
 }
@@ -2,6 +2,7 @@ package vg
 
 import (
 	"crypto/sha256"
+	"slices"
 	"testing"
 	"time"
 
@@ -9,7 +10,9 @@ import (
 	"github.com/aavp-protocol/aavp-go/im"
 	"github.com/aavp-protocol/aavp-go/internal/testkeys"
 	"github.com/aavp-protocol/aavp-go/pbrsa"
+	"github.com/aavp-protocol/aavp-go/report"
 	"github.com/aavp-protocol/aavp-go/token"
+	"github.com/aavp-protocol/aavp-go/validation"
 )
 
 func setupProtocol(t *testing.T) (*da.DeviceAgent, *VerificationGate, *pbrsa.PrivateKey) {
@@ -123,3 +126,105 @@ func TestVerifyRejectsExpiredToken(t *testing.T) {
 		t.Error("expected verification to fail for expired token")
 	}
 }
+
+func TestVerifyUsesGateValidator(t *testing.T) {
+	agent, gate, sk := setupProtocol(t)
+
+	strict, err := validation.NewValidator(validation.Config{
+		AcceptedTokenTypes: []uint16{token.TokenTypeRSAPBSSASHA384},
+		ClockSkewPast:      time.Minute,
+		MaxTTL:             time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewValidator: %v", err)
+	}
+	strictGate := NewVerificationGateWithValidator(strict)
+	strictGate.TrustStore = gate.TrustStore
+
+	signer := func(blindedMsg, metadata []byte) ([]byte, error) {
+		return pbrsa.BlindSign(sk, blindedMsg, metadata)
+	}
+	tok, err := agent.IssueToken(token.AgeBracketOver18, 3*time.Hour, signer)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+
+	encoded := token.Encode(tok)
+	now := time.Now().UTC()
+	if _, err := gate.Verify(encoded, now); err != nil {
+		t.Fatalf("default gate: %v", err)
+	}
+	if _, err := strictGate.Verify(encoded, now); err != validation.ErrExpiresAtTooFarFuture {
+		t.Errorf("strict gate: expected %v, got %v", validation.ErrExpiresAtTooFarFuture, err)
+	}
+}
+
+func TestVerifyReportsOutcomes(t *testing.T) {
+	agent, gate, sk := setupProtocol(t)
+	kid := agent.TokenKeyID
+	gate.TrustStore.Replace([]TrustedKey{{TokenKeyID: kid, PublicKey: &sk.PublicKey, Issuer: "im.example", TokenType: token.TokenTypeRSAPBSSASHA384}})
+	now := time.Now().UTC()
+	gate.Reports = report.NewCollector(now)
+
+	signer := func(blindedMsg, metadata []byte) ([]byte, error) {
+		return pbrsa.BlindSign(sk, blindedMsg, metadata)
+	}
+	tok, err := agent.IssueToken(token.AgeBracketAge16_17, time.Hour, signer)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	valid := token.Encode(tok)
+
+	tampered := slices.Clone(valid)
+	tampered[token.MessageToSignSize] ^= 0x80
+	badBracket := slices.Clone(valid)
+	badBracket[token.OffsetAgeBracket] = 9
+
+	check := func(name string, b []byte, at time.Time, want report.Outcome) {
+		t.Helper()
+		_, err := gate.Verify(b, at)
+		if got := Classify(err); got != want {
+			t.Errorf("%s: outcome = %s (%v), want %s", name, got, err, want)
+		}
+	}
+	check("valid", valid, now, report.Valid)
+	check("tampered", tampered, now, report.BadSignature)
+	check("expired", valid, now.Add(24*time.Hour), report.Expired)
+	check("bad bracket", badBracket, now, report.Malformed)
+	check("truncated", valid[:100], now, report.Malformed)
+
+	// The code sent to clients does not reveal the finer classification.
+	_, err = gate.Verify(tampered, now)
+	if err.Error() != validation.ErrSignatureVerificationFailed.Error() || errorCode(err) != "signature_verification_failed" {
+		t.Errorf("error = %q, code = %q", err, errorCode(err))
+	}
+
+	gate.TrustStore.Retire(kid, now.Add(-time.Minute))
+	check("retired key", valid, now, report.UnknownKey)
+
+	c := gate.Reports.Counts("im.example")
+	want := report.Counters{Total: 6, Valid: 1, Failures: report.Failures{Expired: 1, BadSignature: 2, Malformed: 1, UnknownKey: 1}}
+	if c != want {
+		t.Errorf("counts = %+v, want %+v", c, want)
+	}
+	if u := gate.Reports.Unattributed(); u.Total != 1 || u.Failures.Malformed != 1 {
+		t.Errorf("unattributed = %+v", u)
+	}
+
+	// A key the VG never obtained is attributed to the only IM it trusts,
+	// without a per-key entry.
+	gate.Reports = report.NewCollector(now)
+	gate.TrustStore.Remove(kid)
+	gate.TrustStore.Add(TrustedKey{TokenKeyID: [32]byte{1}, PublicKey: &sk.PublicKey, Issuer: "im.example", TokenType: token.TokenTypeRSAPBSSASHA384})
+	check("missing key", valid, now, report.UnknownKey)
+	if c := gate.Reports.Counts("im.example"); c.Total != 1 || c.Failures.UnknownKey != 1 {
+		t.Errorf("single IM: counts = %+v", c)
+	}
+
+	// With several IMs the token cannot be attributed.
+	gate.TrustStore.Add(TrustedKey{TokenKeyID: [32]byte{2}, PublicKey: &sk.PublicKey, Issuer: "im2.example", TokenType: token.TokenTypeRSAPBSSASHA384})
+	check("missing key, two IMs", valid, now, report.UnknownKey)
+	if u := gate.Reports.Unattributed(); u.Total != 1 || u.Failures.UnknownKey != 1 {
+		t.Errorf("two IMs: unattributed = %+v", u)
+	}
+}
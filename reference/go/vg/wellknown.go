@@ -0,0 +1,104 @@
+package vg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+)
+
+// WellKnownPath is the path of the VG discovery document.
+const WellKnownPath = discovery.WellKnownPath
+
+// Discovery builds the .well-known/aavp document of a VG (PROTOCOL.md section
+// 5.3.1) from the live trust store and validation policy of Gate, so that the
+// published document always matches what the VG accepts. It also serves the
+// document and derives the _aavp TXT record from it.
+//
+// Endpoint is the vg_endpoint. IMs lists the accepted IM domains; if empty,
+// the issuers present in the trust store are used. With PublishKeyIDs, each
+// IM entry lists the token_key_ids of its keys valid now and IMs without such
+// keys are left out; otherwise token_key_ids is omitted and every active key
+// of the IM is accepted. AgePolicy is the optional SPD URI.
+type Discovery struct {
+	Gate          *VerificationGate
+	Endpoint      string
+	IMs           []string
+	AgePolicy     string
+	PublishKeyIDs bool
+	Now           func() time.Time
+}
+
+// NewDiscovery creates a Discovery for gate serving endpoint as vg_endpoint.
+func NewDiscovery(gate *VerificationGate, endpoint string, ims []string) *Discovery {
+	return &Discovery{Gate: gate, Endpoint: endpoint, IMs: ims, Now: time.Now}
+}
+
+// Document returns the discovery document as of now.
+func (d *Discovery) Document() *discovery.Document {
+	now := d.Now()
+	accepted := d.Gate.Validator.Config().AcceptedTokenTypes
+	snap := d.Gate.TrustStore.Snapshot()
+
+	ims := d.IMs
+	if len(ims) == 0 {
+		ims = snap.Issuers()
+	}
+	keyIDs := make(map[string][]string)
+	if d.PublishKeyIDs {
+		for _, k := range snap.Keys() {
+			if k.ValidAt(now) && slices.Contains(accepted, k.TokenType) {
+				issuer := strings.ToLower(k.Issuer)
+				keyIDs[issuer] = append(keyIDs[issuer], base64.RawURLEncoding.EncodeToString(k.TokenKeyID[:]))
+			}
+		}
+	}
+
+	doc := &discovery.Document{
+		AAVPVersion:        discovery.ProtocolVersion,
+		VGEndpoint:         d.Endpoint,
+		AcceptedIMs:        []discovery.AcceptedIM{},
+		AcceptedTokenTypes: accepted,
+		AgePolicy:          d.AgePolicy,
+	}
+	for _, domain := range ims {
+		entry := discovery.AcceptedIM{Domain: domain}
+		if d.PublishKeyIDs {
+			entry.TokenKeyIDs = keyIDs[strings.ToLower(domain)]
+			if len(entry.TokenKeyIDs) == 0 {
+				continue
+			}
+			slices.Sort(entry.TokenKeyIDs)
+		}
+		doc.AcceptedIMs = append(doc.AcceptedIMs, entry)
+	}
+	return doc
+}
+
+// TXTRecord returns the _aavp TXT record matching Document.
+func (d *Discovery) TXTRecord() *discovery.TXTRecord {
+	return d.Document().TXTRecord()
+}
+
+// ServeHTTP serves the document with the caching and CORS headers of
+// PROTOCOL.md section 5.3.1.
+func (d *Discovery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := json.Marshal(d.Document())
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(body)
+}
@@ -0,0 +1,81 @@
+package vg
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aavp-protocol/aavp-go/discovery"
+	"github.com/aavp-protocol/aavp-go/token"
+)
+
+func TestDiscoveryDocument(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	gate := NewVerificationGate()
+	gate.TrustStore.Replace([]TrustedKey{
+		{TokenKeyID: [32]byte{1}, Issuer: "im1.example", TokenType: token.TokenTypeRSAPBSSASHA384},
+		{TokenKeyID: [32]byte{2}, Issuer: "im1.example", TokenType: token.TokenTypeRSAPBSSASHA384, NotAfter: now},
+		{TokenKeyID: [32]byte{3}, Issuer: "im2.example", TokenType: token.TokenTypeRSAPBSSASHA384, NotBefore: now.Add(time.Hour)},
+	})
+	d := NewDiscovery(gate, "https://platform.example/aavp/verify", nil)
+	d.AgePolicy = "https://platform.example/.well-known/aavp-age-policy.json"
+	d.Now = func() time.Time { return now }
+
+	// Without IMs, the issuers of the trust store are published.
+	doc := d.Document()
+	if err := doc.Validate("platform.example"); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(doc.AcceptedIMs) != 2 || doc.AcceptedIMs[0].TokenKeyIDs != nil || !doc.AcceptsTokenType(token.TokenTypeRSAPBSSASHA384) {
+		t.Errorf("document = %+v", doc)
+	}
+
+	// With PublishKeyIDs only the keys valid now are listed.
+	d.PublishKeyIDs = true
+	doc = d.Document()
+	want := base64.RawURLEncoding.EncodeToString(append([]byte{1}, make([]byte, 31)...))
+	if len(doc.AcceptedIMs) != 1 || doc.AcceptedIMs[0].Domain != "im1.example" ||
+		len(doc.AcceptedIMs[0].TokenKeyIDs) != 1 || doc.AcceptedIMs[0].TokenKeyIDs[0] != want {
+		t.Errorf("accepted_ims = %+v", doc.AcceptedIMs)
+	}
+
+	// The TXT record is derived from the same document.
+	if got := d.TXTRecord().String(); got != "v=aavp1; e=https://platform.example/aavp/verify; im=im1.example" {
+		t.Errorf("TXTRecord = %q", got)
+	}
+}
+
+func TestDiscoveryServeHTTP(t *testing.T) {
+	gate := NewVerificationGate()
+	d := NewDiscovery(gate, "https://platform.example/aavp/verify", []string{"im.example"})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, WellKnownPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	for h, want := range map[string]string{
+		"Content-Type":                "application/json",
+		"Cache-Control":               "public, max-age=3600",
+		"Access-Control-Allow-Origin": "*",
+	} {
+		if got := w.Header().Get(h); got != want {
+			t.Errorf("%s = %q, want %q", h, got, want)
+		}
+	}
+	doc, err := discovery.ParseDocument(w.Body.Bytes(), "platform.example")
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	if _, ok := doc.FindIM("im.example"); !ok {
+		t.Errorf("document = %+v", doc)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodPost, WellKnownPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d", w.Code)
+	}
+}